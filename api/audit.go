@@ -0,0 +1,439 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+const (
+	AuditAddMovie     = "add_movie"
+	AuditRateMovie    = "rate_movie"
+	AuditQueueAdd     = "queue_add"
+	AuditQueueRemove  = "queue_remove"
+	AuditQueueReorder = "queue_reorder"
+	AuditQueueRepair  = "queue_repair"
+	AuditPlanMovie    = "plan_movie"
+	AuditFinishMovie  = "finish_movie"
+	AuditCastVote     = "cast_vote"
+	AuditAddAlias     = "add_alias"
+	AuditDeleteMovie  = "delete_movie"
+	AuditRestoreMovie = "restore_movie"
+	AuditPurgeMovie   = "purge_movie"
+	AuditMergeMovies  = "merge_movies"
+	AuditVotingMethod = "voting_method"
+	AuditVisibility   = "vote_visibility"
+	AuditVeto         = "veto_candidate"
+	AuditNominate     = "nominate"
+	AuditImport       = "import"
+	AuditCreateGroup  = "create_group"
+	AuditUpdateGroup  = "update_group"
+	AuditCreateQueue  = "create_queue"
+	AuditUpdateQueue  = "update_queue"
+	AuditDeleteQueue  = "delete_queue"
+)
+
+// AuditEntry records one mutation. Before and After hold the affected state
+// as JSON, or null when there was nothing before or after.
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	GroupID   int             `json:"group_id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	MovieID   int             `json:"movie_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const DefaultAuditLimit = 50
+
+// AuditFilter selects audit entries. Zero fields match everything; entries
+// are returned newest first, Limit at a time starting at Offset.
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	MovieID int
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+func (filter AuditFilter) limit() int {
+	if filter.Limit <= 0 {
+		return DefaultAuditLimit
+	}
+	return filter.Limit
+}
+
+func auditState(state any) json.RawMessage {
+	data, err := json.Marshal(state)
+	if err != nil {
+		logger.Error("Failed to marshal audit state", err)
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// auditedStore records an audit entry for every successful mutation made
+// through it. Reads pass straight through to the wrapped Store.
+type auditedStore struct {
+	Store
+	actor string
+}
+
+func WithAudit(store Store, actor string) Store {
+	return &auditedStore{Store: store, actor: actor}
+}
+
+func (s *auditedStore) ForGroup(groupID int) Store {
+	return WithAudit(s.Store.ForGroup(groupID), s.actor)
+}
+
+func (s *auditedStore) ForQueue(queueID int) Store {
+	return WithAudit(s.Store.ForQueue(queueID), s.actor)
+}
+
+func (s *auditedStore) record(action string, movieID int, before any, after any) {
+	entry := AuditEntry{
+		Actor:   s.actor,
+		Action:  action,
+		MovieID: movieID,
+		Before:  auditState(before),
+		After:   auditState(after),
+	}
+	if err := s.Store.RecordAudit(&entry); err != nil {
+		logger.Error("Failed to record audit entry", err)
+	}
+}
+
+func (s *auditedStore) movieState(id int) any {
+	movie, err := s.Store.GetMovie(id)
+	if err != nil {
+		return nil
+	}
+	return movie
+}
+
+func (s *auditedStore) queueState() any {
+	queue, err := s.Store.GetQueue()
+	if err != nil {
+		return nil
+	}
+	ids := []int{}
+	for _, movie := range queue {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+func (s *auditedStore) planState(movieID int) any {
+	plans, err := s.Store.GetPlans()
+	if err != nil {
+		return nil
+	}
+	if at, ok := plans[movieID]; ok {
+		return map[string]any{"planned_at": at}
+	}
+	return nil
+}
+
+func (s *auditedStore) groupState(groupID int) any {
+	groups, err := s.Store.GetGroups()
+	if err != nil {
+		return nil
+	}
+	for _, group := range groups {
+		if group.ID == groupID {
+			return group
+		}
+	}
+	return nil
+}
+
+// namedQueueState returns the named queue with queueID and the movies in it.
+func (s *auditedStore) namedQueueState(queueID int) any {
+	queues, err := s.Store.GetQueues()
+	if err != nil {
+		return nil
+	}
+	for _, queue := range queues {
+		if queue.ID != queueID {
+			continue
+		}
+		movies, err := s.Store.ForQueue(queueID).GetQueue()
+		if err != nil {
+			return nil
+		}
+		ids := []int{}
+		for _, movie := range movies {
+			ids = append(ids, movie.ID)
+		}
+		return map[string]any{"queue": queue, "movies": ids}
+	}
+	return nil
+}
+
+func (s *auditedStore) ratingState(movieID int, username string) any {
+	ratings, err := s.Store.GetMovieRatings(movieID)
+	if err != nil {
+		return nil
+	}
+	for _, rating := range ratings {
+		if rating.Username == username {
+			return rating
+		}
+	}
+	return nil
+}
+
+func (s *auditedStore) AddMovie(movie *Movie) (int, error) {
+	id, err := s.Store.AddMovie(movie)
+	if err == nil {
+		s.record(AuditAddMovie, id, nil, s.movieState(id))
+	}
+	return id, err
+}
+
+func (s *auditedStore) RateMovie(movieID int, username string, rating float64) error {
+	before := s.ratingState(movieID, username)
+	err := s.Store.RateMovie(movieID, username, rating)
+	if err == nil {
+		s.record(AuditRateMovie, movieID, before, s.ratingState(movieID, username))
+	}
+	return err
+}
+
+func (s *auditedStore) AddMovieToQueue(movieID int) error {
+	before := s.queueState()
+	err := s.Store.AddMovieToQueue(movieID)
+	if err == nil {
+		s.record(AuditQueueAdd, movieID, before, s.queueState())
+	}
+	return err
+}
+
+func (s *auditedStore) MoveInQueue(movieID int, position int) error {
+	before := s.queueState()
+	err := s.Store.MoveInQueue(movieID, position)
+	if err == nil {
+		s.record(AuditQueueReorder, movieID, before, s.queueState())
+	}
+	return err
+}
+
+func (s *auditedStore) SwapInQueue(movieID int, otherID int) error {
+	before := s.queueState()
+	err := s.Store.SwapInQueue(movieID, otherID)
+	if err == nil {
+		s.record(AuditQueueReorder, movieID, before, s.queueState())
+	}
+	return err
+}
+
+func (s *auditedStore) ReorderQueue(movieIDs []int) error {
+	before := s.queueState()
+	err := s.Store.ReorderQueue(movieIDs)
+	if err == nil {
+		s.record(AuditQueueReorder, 0, before, s.queueState())
+	}
+	return err
+}
+
+func (s *auditedStore) RepairQueue() (QueueReport, error) {
+	before := s.queueState()
+	report, err := s.Store.RepairQueue()
+	if err == nil && report.Repaired {
+		s.record(AuditQueueRepair, 0, before, s.queueState())
+	}
+	return report, err
+}
+
+func (s *auditedStore) RemoveMovieFromQueue(movieID int) error {
+	before := s.queueState()
+	err := s.Store.RemoveMovieFromQueue(movieID)
+	if err == nil {
+		s.record(AuditQueueRemove, movieID, before, s.queueState())
+	}
+	return err
+}
+
+// CreateGroup and UpdateGroup record their entry in the group they change.
+func (s *auditedStore) CreateGroup(group *Group) (int, error) {
+	id, err := s.Store.CreateGroup(group)
+	if err == nil {
+		in := &auditedStore{Store: s.Store.ForGroup(id), actor: s.actor}
+		in.record(AuditCreateGroup, 0, nil, s.groupState(id))
+	}
+	return id, err
+}
+
+func (s *auditedStore) UpdateGroup(group *Group) error {
+	before := s.groupState(group.ID)
+	err := s.Store.UpdateGroup(group)
+	if err == nil {
+		in := &auditedStore{Store: s.Store.ForGroup(group.ID), actor: s.actor}
+		in.record(AuditUpdateGroup, 0, before, s.groupState(group.ID))
+	}
+	return err
+}
+
+func (s *auditedStore) CreateQueue(queue *NamedQueue) (int, error) {
+	id, err := s.Store.CreateQueue(queue)
+	if err == nil {
+		s.record(AuditCreateQueue, 0, nil, s.namedQueueState(id))
+	}
+	return id, err
+}
+
+func (s *auditedStore) UpdateQueue(queue *NamedQueue) error {
+	before := s.namedQueueState(queue.ID)
+	err := s.Store.UpdateQueue(queue)
+	if err == nil {
+		s.record(AuditUpdateQueue, 0, before, s.namedQueueState(queue.ID))
+	}
+	return err
+}
+
+func (s *auditedStore) DeleteQueue(queueID int) error {
+	before := s.namedQueueState(queueID)
+	err := s.Store.DeleteQueue(queueID)
+	if err == nil {
+		s.record(AuditDeleteQueue, 0, before, nil)
+	}
+	return err
+}
+
+func (s *auditedStore) PlanMovie(movieID int, at time.Time) error {
+	before := s.planState(movieID)
+	err := s.Store.PlanMovie(movieID, at)
+	if err == nil {
+		s.record(AuditPlanMovie, movieID, before, s.planState(movieID))
+	}
+	return err
+}
+
+func (s *auditedStore) FinishMovie(movieID int) error {
+	before := s.movieState(movieID)
+	err := s.Store.FinishMovie(movieID)
+	if err == nil {
+		s.record(AuditFinishMovie, movieID, before, s.movieState(movieID))
+	}
+	return err
+}
+
+func (s *auditedStore) CastVote(username string, movieIDs []int) error {
+	var before any
+	if ballot, err := s.Store.GetBallot(username); err == nil {
+		before = ballot
+	}
+	err := s.Store.CastVote(username, movieIDs)
+	if err == nil {
+		ballot, _ := s.Store.GetBallot(username)
+		tallies, _ := s.Store.GetVoteTallies()
+		s.record(AuditCastVote, 0, before, map[string]any{"ballot": ballot, "tallies": tallies})
+	}
+	return err
+}
+
+func (s *auditedStore) SetVotingMethod(method string) error {
+	before, _ := s.Store.GetVotingMethod()
+	err := s.Store.SetVotingMethod(method)
+	if err == nil {
+		s.record(AuditVotingMethod, 0, before, method)
+	}
+	return err
+}
+
+func (s *auditedStore) SetVoteVisibility(visibility string) error {
+	before, _ := s.Store.GetCurrentVoteRound()
+	err := s.Store.SetVoteVisibility(visibility)
+	if err == nil {
+		s.record(AuditVisibility, 0, before.Visibility, visibility)
+	}
+	return err
+}
+
+func (s *auditedStore) VetoCandidate(username string, movieID int, replacementID int) (Veto, error) {
+	before, _ := s.Store.GetCurrentVote()
+	veto, err := s.Store.VetoCandidate(username, movieID, replacementID)
+	if err == nil {
+		s.record(AuditVeto, movieID, before, veto)
+	}
+	return veto, err
+}
+
+func (s *auditedStore) Nominate(username string, movieID int) error {
+	err := s.Store.Nominate(username, movieID)
+	if err == nil {
+		nominations, _ := s.Store.GetNominations()
+		s.record(AuditNominate, movieID, nil, nominations)
+	}
+	return err
+}
+
+func (s *auditedStore) AddAlias(alias *Alias) error {
+	aliasState := func() any {
+		aliases, err := s.Store.GetAliases()
+		if err != nil {
+			return nil
+		}
+		for _, existing := range aliases {
+			if existing.Username == alias.Username {
+				return existing
+			}
+		}
+		return nil
+	}
+
+	before := aliasState()
+	err := s.Store.AddAlias(alias)
+	if err == nil {
+		s.record(AuditAddAlias, 0, before, aliasState())
+	}
+	return err
+}
+
+func (s *auditedStore) DeleteMovie(id int, deletedBy string) error {
+	before := s.movieState(id)
+	err := s.Store.DeleteMovie(id, deletedBy)
+	if err == nil {
+		s.record(AuditDeleteMovie, id, before, nil)
+	}
+	return err
+}
+
+func (s *auditedStore) RestoreMovie(id int) error {
+	err := s.Store.RestoreMovie(id)
+	if err == nil {
+		s.record(AuditRestoreMovie, id, nil, s.movieState(id))
+	}
+	return err
+}
+
+func (s *auditedStore) PurgeMovie(id int) error {
+	err := s.Store.PurgeMovie(id)
+	if err == nil {
+		s.record(AuditPurgeMovie, id, nil, nil)
+	}
+	return err
+}
+
+func (s *auditedStore) MergeMovies(canonicalID int, duplicateID int) error {
+	before := map[string]any{"canonical": s.movieState(canonicalID), "duplicate": s.movieState(duplicateID)}
+	err := s.Store.MergeMovies(canonicalID, duplicateID)
+	if err == nil {
+		s.record(AuditMergeMovies, canonicalID, before, s.movieState(canonicalID))
+	}
+	return err
+}
+
+func (s *auditedStore) Import(export *StateExport, mode ImportMode) (ImportReport, error) {
+	report, err := s.Store.Import(export, mode)
+	if err == nil {
+		s.record(AuditImport, 0, nil, report)
+	}
+	return report, err
+}
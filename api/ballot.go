@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidBallot is returned by CastVote when the ranking is empty, repeats
+// a movie or names one that is not a candidate.
+var ErrInvalidBallot = errors.New("invalid ballot")
+
+// Ballot is one user's ranking of the candidates in a vote round, most
+// preferred first. A user has at most one ballot per round; casting again
+// replaces it.
+type Ballot struct {
+	RoundID   int       `json:"round_id,omitempty"`
+	Username  string    `json:"username"`
+	Ranking   []int     `json:"ranking"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func validateBallot(ranking []int, candidates []int) error {
+	if len(ranking) == 0 {
+		return fmt.Errorf("%w: empty ranking", ErrInvalidBallot)
+	}
+	isCandidate := make(map[int]bool, len(candidates))
+	for _, id := range candidates {
+		isCandidate[id] = true
+	}
+	seen := make(map[int]bool, len(ranking))
+	for _, id := range ranking {
+		if !isCandidate[id] {
+			return fmt.Errorf("%w: movie %d is not a candidate", ErrInvalidBallot, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: movie %d is ranked twice", ErrInvalidBallot, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// mergeRanking replaces duplicateID with canonicalID in ranking, dropping
+// whichever of the two comes later if both are ranked.
+func mergeRanking(ranking []int, canonicalID int, duplicateID int) []int {
+	merged := make([]int, 0, len(ranking))
+	seen := false
+	for _, id := range ranking {
+		if id == duplicateID {
+			id = canonicalID
+		}
+		if id == canonicalID {
+			if seen {
+				continue
+			}
+			seen = true
+		}
+		merged = append(merged, id)
+	}
+	return merged
+}
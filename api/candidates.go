@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+const (
+	CandidatesUniform      = "uniform"
+	CandidatesWaited       = "waited"
+	CandidatesProposerFair = "proposer_fair"
+	CandidatesRetire       = "retire"
+)
+
+const DefaultCandidateStrategy = CandidatesUniform
+
+const DefaultRetireAfter = 3
+
+var ErrUnknownCandidateStrategy = errors.New("unknown candidate strategy")
+
+type Candidate struct {
+	Movie  Movie
+	Waited time.Duration
+	Losses int
+}
+
+type CandidateSelector interface {
+	// Select returns the ids of up to count movies from pool. All
+	// randomness comes from rng, so a seeded rng gives repeatable picks.
+	Select(pool []Candidate, count int, rng *rand.Rand) []int
+}
+
+func CandidateSelectorFor(group Group) (CandidateSelector, error) {
+	switch group.CandidateStrategy {
+	case CandidatesUniform:
+		return uniformSelector{}, nil
+	case CandidatesWaited:
+		return waitedSelector{}, nil
+	case CandidatesProposerFair:
+		return proposerFairSelector{}, nil
+	case CandidatesRetire:
+		return retireSelector{retireAfter: group.RetireAfter}, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownCandidateStrategy, group.CandidateStrategy)
+}
+
+// SelectCandidates picks the candidates of a new round among the unwatched
+// movies outside the queue, using the strategy and candidate count of the
+// store's group. A nil rng is seeded from the clock.
+func SelectCandidates(store Store, rng *rand.Rand) ([]int, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return nil, err
+	}
+	return selectCandidates(store, group, rng, group.CandidateCount, nil)
+}
+
+func selectCandidates(store Store, group Group, rng *rand.Rand, count int, exclude []int) ([]int, error) {
+	selector, err := CandidateSelectorFor(group)
+	if err != nil {
+		return nil, err
+	}
+	movies, err := store.GetUnwatchedMoviesNotInQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pool := make([]Candidate, 0, len(movies))
+	var longest time.Duration
+	for _, movie := range movies {
+		if slices.Contains(exclude, movie.ID) {
+			continue
+		}
+		stats, err := store.GetMovieVoteStats(movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		candidate := Candidate{Movie: movie, Losses: stats.Losses}
+		if movie.AddedAt != nil {
+			candidate.Waited = now.Sub(*movie.AddedAt)
+			longest = max(longest, candidate.Waited)
+		}
+		pool = append(pool, candidate)
+	}
+	// Movies from before proposals were dated have waited the longest.
+	for i := range pool {
+		if pool[i].Movie.AddedAt == nil {
+			pool[i].Waited = longest
+		}
+	}
+
+	if rng == nil {
+		rng = rand.New(rand.NewSource(now.UnixNano()))
+	}
+	return selector.Select(pool, count, rng), nil
+}
+
+type uniformSelector struct{}
+
+func (uniformSelector) Select(pool []Candidate, count int, rng *rand.Rand) []int {
+	ids := []int{}
+	for _, i := range rng.Perm(len(pool)) {
+		if len(ids) == count {
+			break
+		}
+		ids = append(ids, pool[i].Movie.ID)
+	}
+	return ids
+}
+
+// waitedSelector draws candidates with a weight of one plus the number of
+// days they have waited, so old proposals come up more often.
+type waitedSelector struct{}
+
+func (waitedSelector) Select(pool []Candidate, count int, rng *rand.Rand) []int {
+	remaining := append([]Candidate{}, pool...)
+	ids := []int{}
+	for len(ids) < count && len(remaining) > 0 {
+		total := 0.0
+		for _, candidate := range remaining {
+			total += waitWeight(candidate)
+		}
+		target := rng.Float64() * total
+		picked := len(remaining) - 1
+		for i, candidate := range remaining {
+			target -= waitWeight(candidate)
+			if target < 0 {
+				picked = i
+				break
+			}
+		}
+		ids = append(ids, remaining[picked].Movie.ID)
+		remaining = append(remaining[:picked], remaining[picked+1:]...)
+	}
+	return ids
+}
+
+func waitWeight(candidate Candidate) float64 {
+	return 1 + candidate.Waited.Hours()/24
+}
+
+// proposerFairSelector draws candidates uniformly but takes at most one movie
+// per proposer. Movies without a proposer count as proposed by different
+// people.
+type proposerFairSelector struct{}
+
+func (proposerFairSelector) Select(pool []Candidate, count int, rng *rand.Rand) []int {
+	proposers := make(map[string]bool)
+	ids := []int{}
+	for _, i := range rng.Perm(len(pool)) {
+		if len(ids) == count {
+			break
+		}
+		proposer := pool[i].Movie.ProposedBy
+		if proposer != "" && proposers[proposer] {
+			continue
+		}
+		proposers[proposer] = true
+		ids = append(ids, pool[i].Movie.ID)
+	}
+	return ids
+}
+
+type retireSelector struct {
+	retireAfter int
+}
+
+func (selector retireSelector) Select(pool []Candidate, count int, rng *rand.Rand) []int {
+	var eligible []Candidate
+	for _, candidate := range pool {
+		if candidate.Losses < selector.retireAfter {
+			eligible = append(eligible, candidate)
+		}
+	}
+	return uniformSelector{}.Select(eligible, count, rng)
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExportFormatVersion is bumped whenever StateExport changes incompatibly.
+const ExportFormatVersion = 1
+
+// StateExport is the portable JSON document holding the complete state of a
+// server, trash included. Movie and alias ids are the ids on the exporting
+// server; every other section refers to movies by those ids.
+type StateExport struct {
+	Version     int       `json:"version"`
+	ExportedAt  time.Time `json:"exported_at"`
+	Movies      []Movie   `json:"movies"`
+	Ratings     []Rating  `json:"ratings"`
+	Aliases     []Alias   `json:"aliases"`
+	Queue       []int     `json:"queue"`
+	CurrentVote []int     `json:"current_vote"`
+	// VotingMethod counts the current vote; empty means the group's.
+	VotingMethod string   `json:"voting_method,omitempty"`
+	Ballots      []Ballot `json:"ballots"`
+	// VoteTallies is informational; imports recompute it from Ballots.
+	VoteTallies []VoteTally   `json:"vote_tallies"`
+	Vetoes      []Veto        `json:"vetoes"`
+	Queues      []QueueExport `json:"queues"`
+	Plans       []PlanExport  `json:"plans"`
+	// Session is left out while the group watches nothing.
+	Session *Session `json:"session,omitempty"`
+}
+
+type PlanExport struct {
+	MovieID   int       `json:"movie_id"`
+	PlannedAt time.Time `json:"planned_at"`
+}
+
+type QueueExport struct {
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Movies []int  `json:"movies"`
+}
+
+type VoteTally struct {
+	MovieID int `json:"movie_id"`
+	Votes   int `json:"votes"`
+}
+
+// ErrInvalidExport wraps every reason ImportState rejects a document before
+// touching the store.
+var ErrInvalidExport = errors.New("invalid export")
+
+type ImportMode string
+
+const (
+	// ImportReplace wipes the existing state and loads the document as is,
+	// keeping its ids.
+	ImportReplace ImportMode = "replace"
+	// ImportMerge adds the document to the existing state. Movies whose
+	// tmdb_id is already present are reported as conflicts and not
+	// duplicated; their ratings are merged into the existing movie.
+	ImportMerge ImportMode = "merge"
+)
+
+type ImportConflict struct {
+	TmdbID     int    `json:"tmdb_id"`
+	Name       string `json:"name"`
+	ImportedID int    `json:"imported_id"`
+	ExistingID int    `json:"existing_id"`
+}
+
+type ImportReport struct {
+	Mode            ImportMode `json:"mode"`
+	MoviesImported  int        `json:"movies_imported"`
+	RatingsImported int        `json:"ratings_imported"`
+	AliasesImported int        `json:"aliases_imported"`
+	// QueueImported counts the entries of the main and named queues.
+	QueueImported  int              `json:"queue_imported"`
+	VoteImported   bool             `json:"vote_imported"`
+	VetoesImported int              `json:"vetoes_imported"`
+	Conflicts      []ImportConflict `json:"conflicts"`
+}
+
+func ExportState(store Store) (*StateExport, error) {
+	export := &StateExport{
+		Version:     ExportFormatVersion,
+		ExportedAt:  time.Now().UTC(),
+		Movies:      []Movie{},
+		Ratings:     []Rating{},
+		Queue:       []int{},
+		CurrentVote: []int{},
+		Ballots:     []Ballot{},
+		Vetoes:      []Veto{},
+		Queues:      []QueueExport{},
+		Plans:       []PlanExport{},
+	}
+
+	movies, err := store.GetMovies()
+	if err != nil {
+		return nil, err
+	}
+	export.Movies = append(export.Movies, movies...)
+
+	trash, err := store.GetTrash()
+	if err != nil {
+		return nil, err
+	}
+	export.Movies = append(export.Movies, trash...)
+
+	for _, movie := range export.Movies {
+		ratings, err := store.GetMovieRatings(movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Ratings = append(export.Ratings, ratings...)
+	}
+
+	if export.Aliases, err = store.GetAliases(); err != nil {
+		return nil, err
+	}
+
+	queue, err := store.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range queue {
+		export.Queue = append(export.Queue, movie.ID)
+	}
+
+	vote, err := store.GetCurrentVote()
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range vote {
+		export.CurrentVote = append(export.CurrentVote, movie.ID)
+	}
+	if len(vote) > 0 {
+		if export.VotingMethod, err = store.GetVotingMethod(); err != nil {
+			return nil, err
+		}
+	}
+
+	if export.Ballots, err = store.GetBallots(); err != nil {
+		return nil, err
+	}
+	// Round ids are local to the database; imports open a new round.
+	for i := range export.Ballots {
+		export.Ballots[i].RoundID = 0
+	}
+	if export.VoteTallies, err = store.GetVoteTallies(); err != nil {
+		return nil, err
+	}
+
+	vetoes, err := store.GetVetoes()
+	if err != nil {
+		return nil, err
+	}
+	for _, veto := range vetoes {
+		veto.ID, veto.RoundID = 0, 0
+		export.Vetoes = append(export.Vetoes, veto)
+	}
+
+	queues, err := store.GetQueues()
+	if err != nil {
+		return nil, err
+	}
+	for _, queue := range queues {
+		movies, err := store.ForQueue(queue.ID).GetQueue()
+		if err != nil {
+			return nil, err
+		}
+		exported := QueueExport{Slug: queue.Slug, Name: queue.Name, Movies: []int{}}
+		for _, movie := range movies {
+			exported.Movies = append(exported.Movies, movie.ID)
+		}
+		export.Queues = append(export.Queues, exported)
+	}
+
+	plans, err := store.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range queue {
+		if at, ok := plans[movie.ID]; ok {
+			export.Plans = append(export.Plans, PlanExport{MovieID: movie.ID, PlannedAt: at})
+		}
+	}
+
+	session, err := store.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	if session.State != SessionIdle {
+		session.Movie = nil
+		export.Session = &session
+	}
+
+	return export, nil
+}
+
+func ImportState(store Store, export *StateExport, mode ImportMode) (ImportReport, error) {
+	if mode != ImportReplace && mode != ImportMerge {
+		return ImportReport{}, fmt.Errorf("%w: unknown import mode %q (expected replace or merge)", ErrInvalidExport, mode)
+	}
+	if err := export.validate(); err != nil {
+		return ImportReport{}, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	return store.Import(export, mode)
+}
+
+func (export *StateExport) validate() error {
+	if export.Version < 1 || export.Version > ExportFormatVersion {
+		return fmt.Errorf("unsupported export version %d (this server reads up to %d)", export.Version, ExportFormatVersion)
+	}
+
+	if export.VotingMethod != "" {
+		if _, err := VotingMethodFor(export.VotingMethod); err != nil {
+			return err
+		}
+	}
+
+	movieIDs := make(map[int]bool)
+	for _, movie := range export.Movies {
+		if movie.ID <= 0 || movieIDs[movie.ID] {
+			return fmt.Errorf("invalid or duplicate movie id %d", movie.ID)
+		}
+		movieIDs[movie.ID] = true
+	}
+
+	check := func(section string, id int) error {
+		if !movieIDs[id] {
+			return fmt.Errorf("%s refers to unknown movie id %d", section, id)
+		}
+		return nil
+	}
+	for _, rating := range export.Ratings {
+		if err := check("ratings", rating.MovieID); err != nil {
+			return err
+		}
+	}
+	for _, id := range export.Queue {
+		if err := check("queue", id); err != nil {
+			return err
+		}
+	}
+	for _, id := range export.CurrentVote {
+		if err := check("current_vote", id); err != nil {
+			return err
+		}
+	}
+	for _, ballot := range export.Ballots {
+		for _, id := range ballot.Ranking {
+			if err := check("ballots", id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tally := range export.VoteTallies {
+		if err := check("vote_tallies", tally.MovieID); err != nil {
+			return err
+		}
+	}
+	for _, veto := range export.Vetoes {
+		if err := check("vetoes", veto.MovieID); err != nil {
+			return err
+		}
+		if veto.ReplacementID != 0 {
+			if err := check("vetoes", veto.ReplacementID); err != nil {
+				return err
+			}
+		}
+	}
+	slugs := make(map[string]bool)
+	for _, queue := range export.Queues {
+		named := NamedQueue{Slug: queue.Slug}
+		if err := named.Validate(); err != nil {
+			return err
+		}
+		if slugs[queue.Slug] {
+			return fmt.Errorf("duplicate queue slug %q", queue.Slug)
+		}
+		slugs[queue.Slug] = true
+		for _, id := range queue.Movies {
+			if err := check("queues", id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, plan := range export.Plans {
+		if err := check("plans", plan.MovieID); err != nil {
+			return err
+		}
+	}
+	if session := export.Session; session != nil {
+		switch session.State {
+		case SessionIdle:
+		case SessionStarting, SessionWatching, SessionFinished:
+			if err := check("session", session.MovieID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown session state %q", session.State)
+		}
+	}
+	return nil
+}
+
+func importRanking(ranking []int, ids map[int]int) []int {
+	translated := make([]int, 0, len(ranking))
+	for _, id := range ranking {
+		translated = append(translated, ids[id])
+	}
+	return translated
+}
+
+type movieKey struct {
+	tmdbID  int
+	isMovie bool
+}
+
+// findImportConflicts matches imported movies to existing ones by tmdb_id and
+// is_movie. A tmdb_id of 0 means unknown and never conflicts.
+func findImportConflicts(existing []Movie, imported []Movie) []ImportConflict {
+	byKey := make(map[movieKey]int)
+	for _, movie := range existing {
+		if movie.TmdbID != 0 {
+			byKey[movieKey{movie.TmdbID, movie.IsMovie}] = movie.ID
+		}
+	}
+
+	conflicts := []ImportConflict{}
+	for _, movie := range imported {
+		if existingID, ok := byKey[movieKey{movie.TmdbID, movie.IsMovie}]; ok && movie.TmdbID != 0 {
+			conflicts = append(conflicts, ImportConflict{
+				TmdbID:     movie.TmdbID,
+				Name:       movie.Name,
+				ImportedID: movie.ID,
+				ExistingID: existingID,
+			})
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultGroupID is the group created by the groups migration. It owns all
+// data from before groups existed and backs the unprefixed routes.
+const DefaultGroupID = 1
+
+const DefaultVoteSchedule = "CRON_TZ=Europe/Warsaw 0 0 * * 0"
+
+type Group struct {
+	ID           int    `json:"id"`
+	Slug         string `json:"slug"`
+	Name         string `json:"name"`
+	VoteSchedule string `json:"vote_schedule"`
+	// VotingMethod is the counting rule new vote rounds start with.
+	VotingMethod string `json:"voting_method"`
+	// CandidateStrategy picks the CandidateCount candidates of scheduled
+	// and random votes. RetireAfter is the number of lost votes after
+	// which the retire strategy stops offering a movie.
+	CandidateStrategy string `json:"candidate_strategy"`
+	CandidateCount    int    `json:"candidate_count"`
+	RetireAfter       int    `json:"retire_after"`
+	// TieBreak orders candidates with equal scores in new vote rounds.
+	// QueueWinners limits how many results of a closed round are queued;
+	// zero queues them all.
+	TieBreak     string `json:"tie_break"`
+	QueueWinners int    `json:"queue_winners"`
+	Quorum       int    `json:"quorum"`
+	// Visibility is what clients see of new vote rounds while they run.
+	Visibility     string `json:"visibility"`
+	VetoesPerMonth int    `json:"vetoes_per_month"`
+	// NominationHours, when not zero, makes scheduled rounds start with a
+	// nomination phase of that many hours, in which each user nominates
+	// up to NominationsPerUser movies.
+	NominationHours    int `json:"nomination_hours"`
+	NominationsPerUser int `json:"nominations_per_user"`
+	// WinnerQueueID is the named queue vote results go to, or 0 for the
+	// main queue.
+	WinnerQueueID int `json:"winner_queue_id"`
+	// MovieNight is the cron schedule of the group's recurring movie
+	// night, which dates the queued movies not planned by hand. Empty
+	// means the group has none.
+	MovieNight string    `json:"movie_night"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var groupSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Validate checks the slug used in group routes and fills in defaults.
+func (group *Group) Validate() error {
+	if !groupSlug.MatchString(group.Slug) {
+		return fmt.Errorf("invalid group slug %q: use lowercase letters, digits and dashes", group.Slug)
+	}
+	group.setDefaults()
+	if _, err := cron.ParseStandard(group.VoteSchedule); err != nil {
+		return fmt.Errorf("invalid vote schedule %q: %w", group.VoteSchedule, err)
+	}
+	if group.MovieNight != "" {
+		if _, err := cron.ParseStandard(group.MovieNight); err != nil {
+			return fmt.Errorf("invalid movie night %q: %w", group.MovieNight, err)
+		}
+	}
+	if _, err := VotingMethodFor(group.VotingMethod); err != nil {
+		return err
+	}
+	if _, err := CandidateSelectorFor(*group); err != nil {
+		return err
+	}
+	if group.CandidateCount < 0 || group.RetireAfter < 0 {
+		return fmt.Errorf("candidate_count and retire_after must not be negative")
+	}
+	if err := CheckTieBreak(group.TieBreak); err != nil {
+		return err
+	}
+	if err := CheckVisibility(group.Visibility); err != nil {
+		return err
+	}
+	if group.QueueWinners < 0 || group.Quorum < 0 || group.VetoesPerMonth < 0 || group.NominationHours < 0 || group.NominationsPerUser < 0 || group.WinnerQueueID < 0 {
+		return fmt.Errorf("queue_winners, quorum, vetoes_per_month, winner_queue_id and the nomination settings must not be negative")
+	}
+	return nil
+}
+
+func (group *Group) setDefaults() {
+	if group.Name == "" {
+		group.Name = group.Slug
+	}
+	if group.VoteSchedule == "" {
+		group.VoteSchedule = DefaultVoteSchedule
+	}
+	if group.VotingMethod == "" {
+		group.VotingMethod = DefaultVotingMethod
+	}
+	if group.CandidateStrategy == "" {
+		group.CandidateStrategy = DefaultCandidateStrategy
+	}
+	if group.CandidateCount == 0 {
+		group.CandidateCount = VoteCandidates
+	}
+	if group.RetireAfter == 0 {
+		group.RetireAfter = DefaultRetireAfter
+	}
+	if group.TieBreak == "" {
+		group.TieBreak = DefaultTieBreak
+	}
+	if group.Visibility == "" {
+		group.Visibility = DefaultVisibility
+	}
+}
+
+func (group Group) NextVote(t time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(group.VoteSchedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid vote schedule %q: %w", group.VoteSchedule, err)
+	}
+	return schedule.Next(t), nil
+}
@@ -0,0 +1,1776 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ratingKey struct {
+	movieID  int
+	username string
+}
+
+type memoryRound struct {
+	id           int
+	group        int
+	phase        string
+	votingMethod string
+	visibility   string
+	tieBreak     string
+	tieSeed      int64
+	startedAt    time.Time
+	endedAt      *time.Time
+	closesAt     *time.Time
+	cancelled    bool
+	noQuorum     bool
+	winnerID     int
+	candidates   []RoundCandidate
+	nominations  []Nomination
+}
+
+type memoryQueue struct {
+	NamedQueue
+	items []int
+}
+
+type ballotKey struct {
+	roundID  int
+	username string
+}
+
+// memoryData is the state shared by every group view of a MemoryStore.
+// Aliases and current votes are keyed by group id; movies and rounds carry
+// their own.
+type memoryData struct {
+	mu sync.Mutex
+
+	groups []Group
+
+	movies      map[int]*Movie
+	nextMovieID int
+	ratings     map[ratingKey]*Rating
+
+	aliases     map[int][]Alias
+	nextAliasID int
+
+	currentVote map[int][]int
+	rounds      []memoryRound
+	nextRoundID int
+	ballots     map[ballotKey]*Ballot
+	// vetoes are keyed by group id.
+	vetoes     map[int][]Veto
+	nextVetoID int
+
+	queues      []memoryQueue
+	nextQueueID int
+	// plans are the planned watch times keyed by movie id.
+	plans map[int]time.Time
+	// sessions are keyed by group id.
+	sessions map[int]Session
+
+	auditLog []AuditEntry
+}
+
+// MemoryStore is a Store that keeps everything in process memory. It is
+// meant for tests and throwaway instances; nothing survives a restart.
+type MemoryStore struct {
+	*memoryData
+	group int
+	// queue is the named queue the store works on, or 0 for the main queue.
+	queue int
+}
+
+func NewMemoryStore() *MemoryStore {
+	defaultGroup := Group{ID: DefaultGroupID, Slug: "default", Name: "Default", VetoesPerMonth: DefaultVetoesPerMonth,
+		NominationsPerUser: DefaultNominationsPerUser, CreatedAt: time.Now().UTC()}
+	defaultGroup.setDefaults()
+	data := &memoryData{
+		groups:      []Group{defaultGroup},
+		movies:      make(map[int]*Movie),
+		nextMovieID: 1,
+		ratings:     make(map[ratingKey]*Rating),
+		aliases:     make(map[int][]Alias),
+		nextAliasID: 1,
+		currentVote: make(map[int][]int),
+		nextRoundID: 1,
+		ballots:     make(map[ballotKey]*Ballot),
+		vetoes:      make(map[int][]Veto),
+		nextVetoID:  1,
+		nextQueueID: 1,
+		plans:       make(map[int]time.Time),
+		sessions:    make(map[int]Session),
+	}
+	return &MemoryStore{memoryData: data, group: DefaultGroupID}
+}
+
+func (s *MemoryStore) ForGroup(groupID int) Store {
+	return &MemoryStore{memoryData: s.memoryData, group: groupID}
+}
+
+func (s *MemoryStore) GroupID() int {
+	return s.group
+}
+
+func (s *MemoryStore) ForQueue(queueID int) Store {
+	return &MemoryStore{memoryData: s.memoryData, group: s.group, queue: queueID}
+}
+
+func (s *MemoryStore) QueueID() int {
+	return s.queue
+}
+
+// namedQueue returns the group's named queue with id, or nil. The caller
+// must hold s.mu.
+func (s *MemoryStore) namedQueue(id int) *memoryQueue {
+	for i := range s.queues {
+		if s.queues[i].ID == id && s.queues[i].GroupID == s.group {
+			return &s.queues[i]
+		}
+	}
+	return nil
+}
+
+// dropFromQueues takes the movies matching drop out of the group's named
+// queues. The caller must hold s.mu.
+func (s *MemoryStore) dropFromQueues(drop func(movieID int) bool) {
+	for i := range s.queues {
+		if s.queues[i].GroupID == s.group {
+			s.queues[i].items = slices.DeleteFunc(s.queues[i].items, drop)
+		}
+	}
+}
+
+func (s *MemoryStore) CreateQueue(queue *NamedQueue) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.queues {
+		if existing.GroupID == s.group && existing.Slug == queue.Slug {
+			return 0, ErrConflict
+		}
+	}
+	queue.ID = s.nextQueueID
+	queue.GroupID = s.group
+	queue.CreatedAt = time.Now().UTC()
+	s.nextQueueID++
+	s.queues = append(s.queues, memoryQueue{NamedQueue: *queue})
+	return queue.ID, nil
+}
+
+func (s *MemoryStore) GetQueues() ([]NamedQueue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queues := []NamedQueue{}
+	for _, queue := range s.queues {
+		if queue.GroupID == s.group {
+			queues = append(queues, queue.NamedQueue)
+		}
+	}
+	return queues, nil
+}
+
+func (s *MemoryStore) GetNamedQueue(slug string) (NamedQueue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, queue := range s.queues {
+		if queue.GroupID == s.group && queue.Slug == slug {
+			return queue.NamedQueue, nil
+		}
+	}
+	return NamedQueue{}, ErrNotFound
+}
+
+func (s *MemoryStore) UpdateQueue(queue *NamedQueue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.queues {
+		if existing.GroupID == s.group && existing.Slug == queue.Slug && existing.ID != queue.ID {
+			return ErrConflict
+		}
+	}
+	existing := s.namedQueue(queue.ID)
+	if existing == nil {
+		return ErrNotFound
+	}
+	existing.Slug = queue.Slug
+	existing.Name = queue.Name
+	return nil
+}
+
+func (s *MemoryStore) DeleteQueue(queueID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.namedQueue(queueID) == nil {
+		return ErrNotFound
+	}
+	s.queues = slices.DeleteFunc(s.queues, func(queue memoryQueue) bool { return queue.ID == queueID })
+	for i := range s.groups {
+		if s.groups[i].ID == s.group && s.groups[i].WinnerQueueID == queueID {
+			s.groups[i].WinnerQueueID = 0
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateGroup(group *Group) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.groups {
+		if existing.Slug == group.Slug {
+			return 0, ErrConflict
+		}
+	}
+	group.setDefaults()
+	group.ID = s.groups[len(s.groups)-1].ID + 1
+	group.CreatedAt = time.Now().UTC()
+	s.groups = append(s.groups, *group)
+	return group.ID, nil
+}
+
+func (s *MemoryStore) GetGroups() ([]Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Group{}, s.groups...), nil
+}
+
+// ownGroup returns the store's group. The caller must hold s.mu.
+func (s *MemoryStore) ownGroup() (Group, bool) {
+	for _, group := range s.groups {
+		if group.ID == s.group {
+			return group, true
+		}
+	}
+	return Group{}, false
+}
+
+func (s *MemoryStore) GetGroup(slug string) (Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, group := range s.groups {
+		if group.Slug == slug {
+			return group, nil
+		}
+	}
+	return Group{}, ErrNotFound
+}
+
+func (s *MemoryStore) UpdateGroup(group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.groups {
+		if s.groups[i].ID == group.ID {
+			s.groups[i].Name = group.Name
+			s.groups[i].VoteSchedule = group.VoteSchedule
+			s.groups[i].VotingMethod = group.VotingMethod
+			s.groups[i].CandidateStrategy = group.CandidateStrategy
+			s.groups[i].CandidateCount = group.CandidateCount
+			s.groups[i].RetireAfter = group.RetireAfter
+			s.groups[i].TieBreak = group.TieBreak
+			s.groups[i].QueueWinners = group.QueueWinners
+			s.groups[i].Quorum = group.Quorum
+			s.groups[i].Visibility = group.Visibility
+			s.groups[i].VetoesPerMonth = group.VetoesPerMonth
+			s.groups[i].NominationHours = group.NominationHours
+			s.groups[i].NominationsPerUser = group.NominationsPerUser
+			s.groups[i].WinnerQueueID = group.WinnerQueueID
+			s.groups[i].MovieNight = group.MovieNight
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// groupMovie looks up a movie of this store's group, trashed or not.
+func (s *MemoryStore) groupMovie(id int) (*Movie, bool) {
+	movie, ok := s.movies[id]
+	if !ok || movie.GroupID != s.group {
+		return nil, false
+	}
+	return movie, true
+}
+
+func (s *MemoryStore) shiftQueue(position int64) {
+	for _, m := range s.movies {
+		if m.GroupID == s.group && m.QueuePosition.Valid && m.QueuePosition.Int64 > position {
+			m.QueuePosition.Int64--
+		}
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) copyMovie(movie *Movie) Movie {
+	scores := make(map[string]float64)
+	for key, rating := range s.ratings {
+		if key.movieID == movie.ID {
+			scores[key.username] = rating.Score
+		}
+	}
+
+	copied := *movie
+	copied.Ratings = ratingsJSON(scores)
+	return copied
+}
+
+func (s *MemoryStore) sortedMovies(keep func(movie *Movie) bool) []Movie {
+	var movies []Movie
+	for _, movie := range s.movies {
+		if movie.GroupID == s.group && keep(movie) {
+			movies = append(movies, s.copyMovie(movie))
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].ID < movies[j].ID })
+	return movies
+}
+
+// findDuplicate returns the id of a live movie in the group other than
+// exceptID with the given tmdb_id and is_movie, or 0 if there is none. The
+// caller must hold s.mu.
+func (s *MemoryStore) findDuplicate(tmdbID int, isMovie bool, exceptID int) int {
+	if tmdbID == 0 {
+		return 0
+	}
+	duplicate := 0
+	for id, movie := range s.movies {
+		if id != exceptID && movie.GroupID == s.group && movie.DeletedAt == nil &&
+			movie.TmdbID == tmdbID && movie.IsMovie == isMovie && (duplicate == 0 || id < duplicate) {
+			duplicate = id
+		}
+	}
+	return duplicate
+}
+
+func (s *MemoryStore) liveMovie(id int) (*Movie, bool) {
+	movie, ok := s.groupMovie(id)
+	if !ok || movie.DeletedAt != nil {
+		return nil, false
+	}
+	return movie, true
+}
+
+func (s *MemoryStore) AddAlias(alias *Alias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases := s.aliases[s.group]
+	for i := range aliases {
+		if aliases[i].Username == alias.Username {
+			aliases[i].Alias = alias.Alias
+			aliases[i].AvatarURL = alias.AvatarURL
+			return nil
+		}
+	}
+
+	newAlias := *alias
+	newAlias.ID = s.nextAliasID
+	s.nextAliasID++
+	s.aliases[s.group] = append(aliases, newAlias)
+	return nil
+}
+
+func (s *MemoryStore) GetAliases() ([]Alias, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Alias{}, s.aliases[s.group]...), nil
+}
+
+func (s *MemoryStore) ClearAliases() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.aliases, s.group)
+	return nil
+}
+
+func (s *MemoryStore) RateMovie(movieID int, username string, rating float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.liveMovie(movieID); !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	key := ratingKey{movieID: movieID, username: username}
+	if existing, ok := s.ratings[key]; ok {
+		existing.Score = rating
+		existing.UpdatedAt = now
+		return nil
+	}
+	s.ratings[key] = &Rating{MovieID: movieID, Username: username, Score: rating, CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+
+func (s *MemoryStore) GetMovieRatings(movieID int) ([]Rating, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ratings := []Rating{}
+	if _, ok := s.groupMovie(movieID); !ok {
+		return ratings, nil
+	}
+	for _, rating := range s.ratings {
+		if rating.MovieID == movieID {
+			ratings = append(ratings, *rating)
+		}
+	}
+	sort.Slice(ratings, func(i, j int) bool { return ratings[i].Username < ratings[j].Username })
+	return ratings, nil
+}
+
+func (s *MemoryStore) GetUserRatings(username string) ([]Rating, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ratings := []Rating{}
+	for _, rating := range s.ratings {
+		if _, ok := s.groupMovie(rating.MovieID); ok && rating.Username == username {
+			ratings = append(ratings, *rating)
+		}
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		if !ratings[i].UpdatedAt.Equal(ratings[j].UpdatedAt) {
+			return ratings[i].UpdatedAt.After(ratings[j].UpdatedAt)
+		}
+		return ratings[i].MovieID < ratings[j].MovieID
+	})
+	return ratings, nil
+}
+
+func (s *MemoryStore) AddMovie(movie *Movie) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existingID := s.findDuplicate(movie.TmdbID, movie.IsMovie, 0); existingID != 0 {
+		return 0, &DuplicateMovieError{ExistingID: existingID}
+	}
+
+	id := s.nextMovieID
+	s.nextMovieID++
+	addedAt := time.Now().UTC()
+	s.movies[id] = &Movie{
+		ID:           id,
+		GroupID:      s.group,
+		Name:         movie.Name,
+		IsMovie:      movie.IsMovie,
+		ProposedBy:   movie.ProposedBy,
+		TmdbID:       movie.TmdbID,
+		TmdbImageUrl: movie.TmdbImageUrl,
+		AddedAt:      &addedAt,
+	}
+	return id, nil
+}
+
+func (s *MemoryStore) GetMovies() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sortedMovies(func(movie *Movie) bool { return movie.DeletedAt == nil }), nil
+}
+
+func (s *MemoryStore) GetMovie(id int) (Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.liveMovie(id)
+	if !ok {
+		return Movie{}, ErrNotFound
+	}
+	return s.copyMovie(movie), nil
+}
+
+func (s *MemoryStore) MergeMovies(canonicalID int, duplicateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if canonicalID == duplicateID {
+		return ErrConflict
+	}
+	canonical, ok := s.liveMovie(canonicalID)
+	if !ok {
+		return ErrNotFound
+	}
+	duplicate, ok := s.liveMovie(duplicateID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	for key, rating := range s.ratings {
+		if key.movieID != duplicateID {
+			continue
+		}
+		delete(s.ratings, key)
+		moved := ratingKey{movieID: canonicalID, username: key.username}
+		if _, exists := s.ratings[moved]; !exists {
+			rating.MovieID = canonicalID
+			s.ratings[moved] = rating
+		}
+	}
+
+	var currentVote []int
+	for _, movieID := range s.currentVote[s.group] {
+		if movieID == duplicateID {
+			if slices.Contains(s.currentVote[s.group], canonicalID) {
+				continue
+			}
+			movieID = canonicalID
+		}
+		currentVote = append(currentVote, movieID)
+	}
+	s.currentVote[s.group] = currentVote
+
+	roundID := s.openRound()
+	for key, ballot := range s.ballots {
+		if key.roundID == roundID {
+			ballot.Ranking = mergeRanking(ballot.Ranking, canonicalID, duplicateID)
+		}
+	}
+
+	for i := range s.rounds {
+		round := &s.rounds[i]
+		if round.group != s.group {
+			continue
+		}
+		hasCanonical := slices.ContainsFunc(round.candidates, func(candidate RoundCandidate) bool { return candidate.MovieID == canonicalID })
+		var candidates []RoundCandidate
+		for _, candidate := range round.candidates {
+			if candidate.MovieID == duplicateID {
+				if hasCanonical {
+					continue
+				}
+				candidate.MovieID = canonicalID
+			}
+			candidates = append(candidates, candidate)
+		}
+		round.candidates = candidates
+		var nominations []Nomination
+		for _, nomination := range round.nominations {
+			if nomination.MovieID == duplicateID {
+				nomination.MovieID = canonicalID
+				if slices.Contains(nominations, nomination) {
+					continue
+				}
+			}
+			nominations = append(nominations, nomination)
+		}
+		round.nominations = nominations
+		if round.winnerID == duplicateID {
+			round.winnerID = canonicalID
+		}
+	}
+	for i := range s.vetoes[s.group] {
+		veto := &s.vetoes[s.group][i]
+		if veto.MovieID == duplicateID {
+			veto.MovieID = canonicalID
+		}
+		if veto.ReplacementID == duplicateID {
+			veto.ReplacementID = canonicalID
+		}
+	}
+
+	// A watched canonical movie stays out of the queues the duplicate was in.
+	for i := range s.queues {
+		queue := &s.queues[i]
+		if queue.GroupID != s.group {
+			continue
+		}
+		if canonical.Watched || slices.Contains(queue.items, canonicalID) {
+			queue.items = slices.DeleteFunc(queue.items, func(id int) bool { return id == duplicateID })
+		} else if i := slices.Index(queue.items, duplicateID); i >= 0 {
+			queue.items[i] = canonicalID
+		}
+	}
+
+	delete(s.movies, duplicateID)
+	delete(s.plans, duplicateID)
+	if position := duplicate.QueuePosition; position.Valid {
+		if canonical.Watched {
+			s.shiftQueue(position.Int64)
+		} else if !canonical.QueuePosition.Valid {
+			canonical.QueuePosition = position
+		} else {
+			if position.Int64 < canonical.QueuePosition.Int64 {
+				position, canonical.QueuePosition = canonical.QueuePosition, position
+			}
+			s.shiftQueue(position.Int64)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteMovie(id int, deletedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.liveMovie(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	deletedAt := time.Now().UTC()
+	movie.DeletedAt = &deletedAt
+	movie.DeletedBy = deletedBy
+	if movie.QueuePosition.Valid {
+		position := movie.QueuePosition.Int64
+		movie.QueuePosition = sql.NullInt64{}
+		s.shiftQueue(position)
+	}
+	s.dropFromQueues(func(movieID int) bool { return movieID == id })
+	delete(s.plans, id)
+	return nil
+}
+
+func (s *MemoryStore) GetTrash() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trash := s.sortedMovies(func(movie *Movie) bool { return movie.DeletedAt != nil })
+	sort.SliceStable(trash, func(i, j int) bool { return trash[i].DeletedAt.After(*trash[j].DeletedAt) })
+	return trash, nil
+}
+
+func (s *MemoryStore) RestoreMovie(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.groupMovie(id)
+	if !ok || movie.DeletedAt == nil {
+		return ErrNotFound
+	}
+	if existingID := s.findDuplicate(movie.TmdbID, movie.IsMovie, id); existingID != 0 {
+		return &DuplicateMovieError{ExistingID: existingID}
+	}
+	movie.DeletedAt = nil
+	movie.DeletedBy = ""
+	return nil
+}
+
+// purgeMovies permanently deletes the trashed movies matching purge together
+// with everything that refers to them. The caller must hold s.mu.
+func (s *MemoryStore) purgeMovies(purge func(movie *Movie) bool) int {
+	purged := make(map[int]bool)
+	for id, movie := range s.movies {
+		if movie.GroupID == s.group && movie.DeletedAt != nil && purge(movie) {
+			purged[id] = true
+			delete(s.movies, id)
+			delete(s.plans, id)
+		}
+	}
+	if len(purged) == 0 {
+		return 0
+	}
+	s.dropFromQueues(func(movieID int) bool { return purged[movieID] })
+
+	for key := range s.ratings {
+		if purged[key.movieID] {
+			delete(s.ratings, key)
+		}
+	}
+	var currentVote []int
+	for _, movieID := range s.currentVote[s.group] {
+		if !purged[movieID] {
+			currentVote = append(currentVote, movieID)
+		}
+	}
+	s.currentVote[s.group] = currentVote
+	for i := range s.rounds {
+		round := &s.rounds[i]
+		if round.group != s.group {
+			continue
+		}
+		round.candidates = slices.DeleteFunc(round.candidates, func(candidate RoundCandidate) bool { return purged[candidate.MovieID] })
+		round.nominations = slices.DeleteFunc(round.nominations, func(nomination Nomination) bool { return purged[nomination.MovieID] })
+		if purged[round.winnerID] {
+			round.winnerID = 0
+		}
+	}
+	s.vetoes[s.group] = slices.DeleteFunc(s.vetoes[s.group], func(veto Veto) bool { return purged[veto.MovieID] })
+	for i := range s.vetoes[s.group] {
+		if purged[s.vetoes[s.group][i].ReplacementID] {
+			s.vetoes[s.group][i].ReplacementID = 0
+		}
+	}
+	return len(purged)
+}
+
+func (s *MemoryStore) PurgeMovie(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.purgeMovies(func(movie *Movie) bool { return movie.ID == id }) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) PurgeTrash(deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.purgeMovies(func(movie *Movie) bool { return movie.DeletedAt.Before(deletedBefore) }), nil
+}
+
+func (s *MemoryStore) ClearMovies() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, movie := range s.movies {
+		if movie.GroupID == s.group {
+			delete(s.movies, id)
+		}
+	}
+	for key := range s.ratings {
+		if _, ok := s.movies[key.movieID]; !ok {
+			delete(s.ratings, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AddMovieToQueue(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.liveMovie(movieID)
+	if !ok {
+		return ErrNotFound
+	}
+	if s.queue != 0 {
+		queue := s.namedQueue(s.queue)
+		if queue == nil {
+			return ErrNotFound
+		}
+		if err := checkQueueable(movieID, slices.Contains(queue.items, movieID), movie.Watched); err != nil {
+			return err
+		}
+		queue.items = append(queue.items, movieID)
+		return nil
+	}
+	if err := checkQueueable(movieID, movie.QueuePosition.Valid, movie.Watched); err != nil {
+		return err
+	}
+
+	highest := int64(0)
+	for _, m := range s.movies {
+		if m.GroupID == s.group && m.QueuePosition.Valid && m.QueuePosition.Int64 > highest {
+			highest = m.QueuePosition.Int64
+		}
+	}
+	movie.QueuePosition = sql.NullInt64{Int64: highest + 1, Valid: true}
+	return nil
+}
+
+func (s *MemoryStore) FinishMovie(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if movie, ok := s.groupMovie(movieID); ok {
+		movie.Watched = true
+		if movie.QueuePosition.Valid {
+			position := movie.QueuePosition.Int64
+			movie.QueuePosition = sql.NullInt64{}
+			s.shiftQueue(position)
+		}
+		s.dropFromQueues(func(id int) bool { return id == movieID })
+		delete(s.plans, movieID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RemoveMovieFromQueue(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.groupMovie(movieID)
+	if !ok {
+		return ErrNotFound
+	}
+	if s.queue != 0 {
+		queue := s.namedQueue(s.queue)
+		if queue == nil {
+			return ErrNotFound
+		}
+		queue.items = slices.DeleteFunc(queue.items, func(id int) bool { return id == movieID })
+		return nil
+	}
+	if !movie.QueuePosition.Valid {
+		return nil
+	}
+
+	position := movie.QueuePosition.Int64
+	movie.QueuePosition = sql.NullInt64{}
+	s.shiftQueue(position)
+	delete(s.plans, movieID)
+	return nil
+}
+
+func (s *MemoryStore) reorderQueue(reorder func(order []int) ([]int, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := s.queueMovies()
+	order := make([]int, 0, len(queue))
+	for _, movie := range queue {
+		order = append(order, movie.ID)
+	}
+
+	newOrder, err := reorder(order)
+	if err != nil {
+		return err
+	}
+	if s.queue != 0 {
+		if named := s.namedQueue(s.queue); named != nil {
+			named.items = newOrder
+		}
+		return nil
+	}
+	for i, id := range newOrder {
+		s.movies[id].QueuePosition = sql.NullInt64{Int64: int64(i + 1), Valid: true}
+	}
+	return nil
+}
+
+// queueEntries returns every movie of the group holding a queue position,
+// trashed or watched ones included, by position and id. The caller must hold
+// s.mu.
+func (s *MemoryStore) queueEntries() []queueEntry {
+	var entries []queueEntry
+	if s.queue != 0 {
+		if named := s.namedQueue(s.queue); named != nil {
+			for i, id := range named.items {
+				movie, ok := s.groupMovie(id)
+				entries = append(entries, queueEntry{id: id, position: int64(i + 1), watched: ok && movie.Watched, deleted: !ok || movie.DeletedAt != nil})
+			}
+		}
+		return entries
+	}
+	for _, movie := range s.movies {
+		if movie.GroupID == s.group && movie.QueuePosition.Valid {
+			entries = append(entries, queueEntry{id: movie.ID, position: movie.QueuePosition.Int64,
+				watched: movie.Watched, deleted: movie.DeletedAt != nil})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].position != entries[j].position {
+			return entries[i].position < entries[j].position
+		}
+		return entries[i].id < entries[j].id
+	})
+	return entries
+}
+
+func (s *MemoryStore) CheckQueue() (QueueReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problems, _ := checkQueue(s.queueEntries())
+	return QueueReport{Problems: problems}, nil
+}
+
+func (s *MemoryStore) RepairQueue() (QueueReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var report QueueReport
+	entries := s.queueEntries()
+	report.Problems, report.Queue = checkQueue(entries)
+	if len(report.Problems) == 0 {
+		return report, nil
+	}
+	if s.queue != 0 {
+		if named := s.namedQueue(s.queue); named != nil {
+			named.items = report.Queue
+		}
+		report.Repaired = true
+		return report, nil
+	}
+	for _, entry := range entries {
+		s.movies[entry.id].QueuePosition = sql.NullInt64{}
+	}
+	for i, id := range report.Queue {
+		s.movies[id].QueuePosition = sql.NullInt64{Int64: int64(i + 1), Valid: true}
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+func (s *MemoryStore) MoveInQueue(movieID int, position int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return moveInQueue(order, movieID, position) })
+}
+
+func (s *MemoryStore) SwapInQueue(movieID int, otherID int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return swapInQueue(order, movieID, otherID) })
+}
+
+func (s *MemoryStore) ReorderQueue(movieIDs []int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return movieIDs, checkQueueOrder(order, movieIDs) })
+}
+
+func (s *MemoryStore) GetQueue() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queueMovies(), nil
+}
+
+// queueMovies returns the live movies of the store's queue in order. The
+// caller must hold s.mu.
+func (s *MemoryStore) queueMovies() []Movie {
+	if s.queue != 0 {
+		var queue []Movie
+		if named := s.namedQueue(s.queue); named != nil {
+			for _, id := range named.items {
+				if movie, ok := s.liveMovie(id); ok {
+					copied := s.copyMovie(movie)
+					copied.QueuePosition = sql.NullInt64{Int64: int64(len(queue) + 1), Valid: true}
+					queue = append(queue, copied)
+				}
+			}
+		}
+		return queue
+	}
+	queue := s.sortedMovies(func(movie *Movie) bool { return movie.QueuePosition.Valid && movie.DeletedAt == nil })
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].QueuePosition.Int64 < queue[j].QueuePosition.Int64 })
+	return queue
+}
+
+func (s *MemoryStore) GetUnwatchedMoviesNotInQueue() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sortedMovies(func(movie *Movie) bool {
+		return !movie.Watched && !movie.QueuePosition.Valid && movie.DeletedAt == nil
+	}), nil
+}
+
+// openRound returns the id of the group's open vote round, or 0 if there is
+// none. The caller must hold s.mu.
+func (s *MemoryStore) openRound() int {
+	if round := s.currentRound(); round != nil {
+		return round.id
+	}
+	return 0
+}
+
+// currentRound returns the group's open vote round, or nil. The caller must
+// hold s.mu.
+func (s *MemoryStore) currentRound() *memoryRound {
+	for i := len(s.rounds) - 1; i >= 0; i-- {
+		if s.rounds[i].group == s.group && s.rounds[i].endedAt == nil {
+			return &s.rounds[i]
+		}
+	}
+	return nil
+}
+
+// rules returns the counting rules of the open round, or the defaults when
+// no round is open. The caller must hold s.mu.
+func (s *MemoryStore) rules() (roundRules, error) {
+	if round := s.currentRound(); round != nil {
+		return newRoundRules(round.votingMethod, round.tieBreak, round.tieSeed)
+	}
+	return newRoundRules(DefaultVotingMethod, DefaultTieBreak, 0)
+}
+
+// startRound closes the group's open round and opens a new one in phase. The
+// caller must hold s.mu.
+func (s *MemoryStore) startRound(phase string) int {
+	s.closeRound()
+	round := memoryRound{id: s.nextRoundID, group: s.group, phase: phase, votingMethod: DefaultVotingMethod, visibility: DefaultVisibility,
+		tieBreak: DefaultTieBreak, tieSeed: rand.Int63(), startedAt: time.Now().UTC()}
+	if group, ok := s.ownGroup(); ok {
+		round.votingMethod = group.VotingMethod
+		round.visibility = group.Visibility
+		round.tieBreak = group.TieBreak
+	}
+	s.nextRoundID++
+	s.rounds = append(s.rounds, round)
+	return round.id
+}
+
+// closeRound ends the group's open round, archiving its results, and
+// removes its candidates. The caller must hold s.mu.
+func (s *MemoryStore) closeRound() {
+	if round := s.currentRound(); round != nil {
+		round.candidates = s.liveResults(round)
+		group, _ := s.ownGroup()
+		round.noQuorum = len(s.roundBallots(round.id)) < group.Quorum
+		if len(round.candidates) > 0 && !round.noQuorum {
+			round.winnerID = round.candidates[0].MovieID
+		}
+		endedAt := time.Now().UTC()
+		round.endedAt = &endedAt
+	}
+	delete(s.currentVote, s.group)
+}
+
+// liveResults places the live candidates of the open round. The caller must
+// hold s.mu.
+func (s *MemoryStore) liveResults(round *memoryRound) []RoundCandidate {
+	rules, err := newRoundRules(round.votingMethod, round.tieBreak, round.tieSeed)
+	if err != nil {
+		rules, _ = newRoundRules(DefaultVotingMethod, DefaultTieBreak, round.tieSeed)
+	}
+	return rules.place(s.candidates(), s.roundBallots(round.id))
+}
+
+// voteRound copies a round of the group. The caller must hold s.mu.
+func (s *MemoryStore) voteRound(round *memoryRound) VoteRound {
+	copied := VoteRound{
+		ID:           round.id,
+		GroupID:      round.group,
+		Phase:        round.phase,
+		VotingMethod: round.votingMethod,
+		Visibility:   round.visibility,
+		TieBreak:     round.tieBreak,
+		TieSeed:      round.tieSeed,
+		StartedAt:    round.startedAt,
+		EndedAt:      round.endedAt,
+		ClosesAt:     round.closesAt,
+		Cancelled:    round.cancelled,
+		NoQuorum:     round.noQuorum,
+		WinnerID:     round.winnerID,
+		Candidates:   append([]RoundCandidate{}, round.candidates...),
+		Vetoes:       []Veto{},
+	}
+	for _, veto := range s.vetoes[s.group] {
+		if veto.RoundID == round.id {
+			copied.Vetoes = append(copied.Vetoes, veto)
+		}
+	}
+	if round.endedAt == nil {
+		copied.Candidates = s.liveResults(round)
+	}
+	return copied
+}
+
+func (s *MemoryStore) GetVoteRounds() ([]VoteRound, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rounds := []VoteRound{}
+	for i := len(s.rounds) - 1; i >= 0; i-- {
+		if s.rounds[i].group == s.group {
+			rounds = append(rounds, s.voteRound(&s.rounds[i]))
+		}
+	}
+	return rounds, nil
+}
+
+func (s *MemoryStore) GetCurrentVoteRound() (VoteRound, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return VoteRound{}, ErrNotFound
+	}
+	return s.voteRound(round), nil
+}
+
+func (s *MemoryStore) GetVoteRound(id int) (VoteRound, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.rounds {
+		if s.rounds[i].id == id && s.rounds[i].group == s.group {
+			round := s.voteRound(&s.rounds[i])
+			round.Ballots = s.roundBallots(id)
+			return round, nil
+		}
+	}
+	return VoteRound{}, ErrNotFound
+}
+
+func (s *MemoryStore) GetMovieVoteStats(movieID int) (MovieVoteStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := MovieVoteStats{MovieID: movieID}
+	for _, round := range s.rounds {
+		if round.group != s.group || round.endedAt == nil || round.noQuorum {
+			continue
+		}
+		for _, candidate := range round.candidates {
+			if candidate.MovieID == movieID {
+				stats.Rounds++
+				if round.winnerID == movieID {
+					stats.Wins++
+				}
+			}
+		}
+	}
+	stats.Losses = stats.Rounds - stats.Wins
+	return stats, nil
+}
+
+// candidates returns the live candidates of the open round in order. The
+// caller must hold s.mu.
+func (s *MemoryStore) candidates() []Movie {
+	var movies []Movie
+	for _, movieID := range s.currentVote[s.group] {
+		if movie, ok := s.liveMovie(movieID); ok {
+			movies = append(movies, s.copyMovie(movie))
+		}
+	}
+	return movies
+}
+
+// roundBallots returns copies of the ballots of a round ordered by
+// username. The caller must hold s.mu.
+func (s *MemoryStore) roundBallots(roundID int) []Ballot {
+	ballots := []Ballot{}
+	for key, ballot := range s.ballots {
+		if key.roundID == roundID && roundID != 0 {
+			copied := *ballot
+			copied.Ranking = append([]int{}, ballot.Ranking...)
+			ballots = append(ballots, copied)
+		}
+	}
+	sort.Slice(ballots, func(i, j int) bool { return ballots[i].Username < ballots[j].Username })
+	return ballots
+}
+
+func (s *MemoryStore) CreateNewVote(movieIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.startRound(PhaseVoting)
+	s.currentVote[s.group] = append([]int{}, movieIDs...)
+	return nil
+}
+
+func (s *MemoryStore) OpenNominations() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.startRound(PhaseNominating)
+	return nil
+}
+
+func (s *MemoryStore) Nominate(username string, movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	if round.phase != PhaseNominating {
+		return ErrNotNominating
+	}
+	movie, ok := s.liveMovie(movieID)
+	if !ok || movie.Watched || movie.QueuePosition.Valid {
+		return fmt.Errorf("%w: movie %d cannot be nominated", ErrInvalidVote, movieID)
+	}
+
+	nominated := 0
+	for _, nomination := range round.nominations {
+		if nomination.Username != username {
+			continue
+		}
+		if nomination.MovieID == movieID {
+			return nil
+		}
+		nominated++
+	}
+	if group, _ := s.ownGroup(); nominated >= group.NominationsPerUser {
+		return ErrNominationLimit
+	}
+	round.nominations = append(round.nominations, Nomination{RoundID: round.id, MovieID: movieID, Username: username, CreatedAt: time.Now().UTC()})
+	return nil
+}
+
+func (s *MemoryStore) GetNominations() ([]Nomination, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nominations := []Nomination{}
+	if round := s.currentRound(); round != nil {
+		nominations = append(nominations, round.nominations...)
+	}
+	return nominations, nil
+}
+
+func (s *MemoryStore) StartVoting(movieIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	if round.phase != PhaseNominating {
+		return ErrNotNominating
+	}
+	round.phase = PhaseVoting
+	s.currentVote[s.group] = append([]int{}, movieIDs...)
+	return nil
+}
+
+func (s *MemoryStore) ClearCurrentVote() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeRound()
+	return nil
+}
+
+func (s *MemoryStore) SetVoteDeadline(closesAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	closesAt = closesAt.UTC()
+	round.closesAt = &closesAt
+	return nil
+}
+
+func (s *MemoryStore) CancelCurrentVote() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	endedAt := time.Now().UTC()
+	round.endedAt = &endedAt
+	round.cancelled = true
+	delete(s.currentVote, s.group)
+	return nil
+}
+
+func (s *MemoryStore) GetCurrentVote() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.candidates(), nil
+}
+
+func (s *MemoryStore) CastVote(username string, movieIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roundID := s.openRound()
+	if roundID == 0 {
+		return ErrNotFound
+	}
+	var candidates []int
+	for _, movie := range s.candidates() {
+		candidates = append(candidates, movie.ID)
+	}
+	if err := validateBallot(movieIDs, candidates); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	key := ballotKey{roundID: roundID, username: username}
+	if ballot, ok := s.ballots[key]; ok {
+		ballot.Ranking = append([]int{}, movieIDs...)
+		ballot.UpdatedAt = now
+		return nil
+	}
+	s.ballots[key] = &Ballot{RoundID: roundID, Username: username, Ranking: append([]int{}, movieIDs...), CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+
+func (s *MemoryStore) GetBallot(username string) (Ballot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ballot, ok := s.ballots[ballotKey{roundID: s.openRound(), username: username}]
+	if !ok {
+		return Ballot{}, ErrNotFound
+	}
+	copied := *ballot
+	copied.Ranking = append([]int{}, ballot.Ranking...)
+	return copied, nil
+}
+
+func (s *MemoryStore) GetBallots() ([]Ballot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.roundBallots(s.openRound()), nil
+}
+
+func (s *MemoryStore) GetVotingMethod() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return "", ErrNotFound
+	}
+	return round.votingMethod, nil
+}
+
+func (s *MemoryStore) SetVotingMethod(method string) error {
+	if _, err := VotingMethodFor(method); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	round.votingMethod = method
+	return nil
+}
+
+func (s *MemoryStore) SetVoteVisibility(visibility string) error {
+	if err := CheckVisibility(visibility); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	round := s.currentRound()
+	if round == nil {
+		return ErrNotFound
+	}
+	round.visibility = visibility
+	return nil
+}
+
+func (s *MemoryStore) VetoCandidate(username string, movieID int, replacementID int) (Veto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roundID := s.openRound()
+	if roundID == 0 {
+		return Veto{}, ErrNotFound
+	}
+	if !slices.Contains(s.currentVote[s.group], movieID) {
+		return Veto{}, fmt.Errorf("%w: movie %d is not a candidate", ErrInvalidVote, movieID)
+	}
+	now := time.Now().UTC()
+	group, _ := s.ownGroup()
+	if s.countVetoes(username, vetoMonth(now)) >= group.VetoesPerMonth {
+		return Veto{}, ErrNoVetoesLeft
+	}
+
+	if replacementID != 0 {
+		replacement, ok := s.liveMovie(replacementID)
+		if !ok || replacement.Watched || replacement.QueuePosition.Valid || slices.Contains(s.currentVote[s.group], replacementID) {
+			return Veto{}, fmt.Errorf("%w: movie %d cannot replace a candidate", ErrInvalidVote, replacementID)
+		}
+	}
+
+	currentVote := slices.DeleteFunc(s.currentVote[s.group], func(id int) bool { return id == movieID })
+	if replacementID != 0 {
+		currentVote = append(currentVote, replacementID)
+	}
+	s.currentVote[s.group] = currentVote
+	for key, ballot := range s.ballots {
+		if key.roundID == roundID {
+			ballot.Ranking = slices.DeleteFunc(ballot.Ranking, func(id int) bool { return id == movieID })
+		}
+	}
+
+	veto := Veto{ID: s.nextVetoID, RoundID: roundID, MovieID: movieID, Username: username, ReplacementID: replacementID, CreatedAt: now}
+	s.nextVetoID++
+	s.vetoes[s.group] = append(s.vetoes[s.group], veto)
+	return veto, nil
+}
+
+func (s *MemoryStore) CountVetoes(username string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.countVetoes(username, since), nil
+}
+
+func (s *MemoryStore) GetVetoes() ([]Veto, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Veto{}, s.vetoes[s.group]...), nil
+}
+
+// countVetoes counts the vetoes username spent in the group since. The
+// caller must hold s.mu.
+func (s *MemoryStore) countVetoes(username string, since time.Time) int {
+	count := 0
+	for _, veto := range s.vetoes[s.group] {
+		if veto.Username == username && !veto.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *MemoryStore) GetVoteResults() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.rules()
+	if err != nil {
+		return nil, err
+	}
+	candidates := s.candidates()
+	return orderByPlace(candidates, rules.place(candidates, s.roundBallots(s.openRound()))), nil
+}
+
+func (s *MemoryStore) GetVoteWinner() (Movie, error) {
+	results, err := s.GetVoteResults()
+	if err != nil {
+		return Movie{}, err
+	}
+	if len(results) == 0 {
+		return Movie{}, ErrNotFound
+	}
+	return results[0], nil
+}
+
+func (s *MemoryStore) ClearVotes() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roundID := s.openRound()
+	for key := range s.ballots {
+		if key.roundID == roundID {
+			delete(s.ballots, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetVoteTallies() ([]VoteTally, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, err := s.rules()
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for _, movie := range s.candidates() {
+		ids = append(ids, movie.ID)
+	}
+	return rules.method.Tally(ids, s.roundBallots(s.openRound())), nil
+}
+
+func (s *MemoryStore) Import(export *StateExport, mode ImportMode) (ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ImportReport{Mode: mode, Conflicts: []ImportConflict{}}
+
+	var existing []Movie
+	if mode == ImportReplace {
+		for id, movie := range s.movies {
+			if movie.GroupID == s.group {
+				delete(s.movies, id)
+			}
+		}
+		for key := range s.ratings {
+			if _, ok := s.movies[key.movieID]; !ok {
+				delete(s.ratings, key)
+			}
+		}
+		for id := range s.plans {
+			if _, ok := s.movies[id]; !ok {
+				delete(s.plans, id)
+			}
+		}
+		delete(s.aliases, s.group)
+		var rounds []memoryRound
+		for _, round := range s.rounds {
+			if round.group != s.group {
+				rounds = append(rounds, round)
+			}
+		}
+		s.rounds = rounds
+		for key := range s.ballots {
+			if !slices.ContainsFunc(s.rounds, func(round memoryRound) bool { return round.id == key.roundID }) {
+				delete(s.ballots, key)
+			}
+		}
+		delete(s.currentVote, s.group)
+		delete(s.vetoes, s.group)
+		s.queues = slices.DeleteFunc(s.queues, func(queue memoryQueue) bool { return queue.GroupID == s.group })
+		delete(s.sessions, s.group)
+	} else {
+		existing = s.sortedMovies(func(movie *Movie) bool { return movie.DeletedAt == nil })
+	}
+
+	ids := make(map[int]int)
+	for _, conflict := range findImportConflicts(existing, export.Movies) {
+		ids[conflict.ImportedID] = conflict.ExistingID
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+
+	for _, movie := range export.Movies {
+		if _, ok := ids[movie.ID]; ok {
+			continue
+		}
+		id := s.nextMovieID
+		if _, taken := s.movies[movie.ID]; mode == ImportReplace && !taken {
+			id = movie.ID
+		}
+		if id >= s.nextMovieID {
+			s.nextMovieID = id + 1
+		}
+		s.movies[id] = &Movie{
+			ID:           id,
+			GroupID:      s.group,
+			Name:         movie.Name,
+			Watched:      movie.Watched,
+			IsMovie:      movie.IsMovie,
+			ProposedBy:   movie.ProposedBy,
+			TmdbID:       movie.TmdbID,
+			TmdbImageUrl: movie.TmdbImageUrl,
+			AddedAt:      movie.AddedAt,
+			DeletedAt:    movie.DeletedAt,
+			DeletedBy:    movie.DeletedBy,
+		}
+		ids[movie.ID] = id
+		report.MoviesImported++
+	}
+
+	for _, rating := range export.Ratings {
+		key := ratingKey{movieID: ids[rating.MovieID], username: rating.Username}
+		if _, ok := s.ratings[key]; ok {
+			continue
+		}
+		s.ratings[key] = &Rating{
+			MovieID:   key.movieID,
+			Username:  rating.Username,
+			Score:     rating.Score,
+			CreatedAt: rating.CreatedAt.UTC(),
+			UpdatedAt: rating.UpdatedAt.UTC(),
+		}
+		report.RatingsImported++
+	}
+
+	for _, alias := range export.Aliases {
+		known, taken := false, false
+		for group, aliases := range s.aliases {
+			for _, existingAlias := range aliases {
+				known = known || group == s.group && existingAlias.Username == alias.Username
+				taken = taken || existingAlias.ID == alias.ID
+			}
+		}
+		if known {
+			continue
+		}
+		id := s.nextAliasID
+		if mode == ImportReplace && alias.ID > 0 && !taken {
+			id = alias.ID
+		}
+		if id >= s.nextAliasID {
+			s.nextAliasID = id + 1
+		}
+		s.aliases[s.group] = append(s.aliases[s.group], Alias{ID: id, Username: alias.Username, Alias: alias.Alias, AvatarURL: alias.AvatarURL})
+		report.AliasesImported++
+	}
+
+	position := int64(0)
+	for _, movie := range s.movies {
+		if movie.GroupID == s.group && movie.QueuePosition.Valid && movie.QueuePosition.Int64 > position {
+			position = movie.QueuePosition.Int64
+		}
+	}
+	for _, documentID := range export.Queue {
+		movie := s.movies[ids[documentID]]
+		if movie.QueuePosition.Valid || movie.Watched || movie.DeletedAt != nil {
+			continue
+		}
+		position++
+		movie.QueuePosition = sql.NullInt64{Int64: position, Valid: true}
+		report.QueueImported++
+	}
+
+	if len(s.currentVote[s.group]) == 0 && len(export.CurrentVote) > 0 {
+		roundID := s.startRound(PhaseVoting)
+		if export.VotingMethod != "" {
+			s.currentRound().votingMethod = export.VotingMethod
+		}
+		for _, documentID := range export.CurrentVote {
+			s.currentVote[s.group] = append(s.currentVote[s.group], ids[documentID])
+		}
+		for _, ballot := range export.Ballots {
+			s.ballots[ballotKey{roundID: roundID, username: ballot.Username}] = &Ballot{
+				RoundID:   roundID,
+				Username:  ballot.Username,
+				Ranking:   importRanking(ballot.Ranking, ids),
+				CreatedAt: ballot.CreatedAt.UTC(),
+				UpdatedAt: ballot.UpdatedAt.UTC(),
+			}
+		}
+		report.VoteImported = true
+	}
+
+	for _, exported := range export.Queues {
+		index := slices.IndexFunc(s.queues, func(queue memoryQueue) bool { return queue.GroupID == s.group && queue.Slug == exported.Slug })
+		if index < 0 {
+			named := NamedQueue{ID: s.nextQueueID, GroupID: s.group, Slug: exported.Slug, Name: exported.Name, CreatedAt: time.Now().UTC()}
+			named.Validate()
+			s.queues = append(s.queues, memoryQueue{NamedQueue: named})
+			s.nextQueueID++
+			index = len(s.queues) - 1
+		}
+		queue := &s.queues[index]
+		for _, documentID := range exported.Movies {
+			movie := s.movies[ids[documentID]]
+			if slices.Contains(queue.items, movie.ID) || movie.Watched || movie.DeletedAt != nil {
+				continue
+			}
+			queue.items = append(queue.items, movie.ID)
+			report.QueueImported++
+		}
+	}
+
+	// Plans only hold for movies of the main queue, and a plan made here
+	// wins over the imported one.
+	for _, plan := range export.Plans {
+		id := ids[plan.MovieID]
+		if _, planned := s.plans[id]; planned || !s.movies[id].QueuePosition.Valid {
+			continue
+		}
+		s.plans[id] = plan.PlannedAt.UTC()
+	}
+
+	if session := export.Session; session != nil && s.sessions[s.group].MovieID == 0 {
+		imported := *session
+		imported.MovieID, imported.Movie = ids[session.MovieID], nil
+		if imported.UpdatedAt == nil {
+			now := time.Now().UTC()
+			imported.UpdatedAt = &now
+		}
+		s.sessions[s.group] = imported
+	}
+
+	for _, veto := range export.Vetoes {
+		veto.MovieID, veto.ReplacementID, veto.CreatedAt = ids[veto.MovieID], ids[veto.ReplacementID], veto.CreatedAt.UTC()
+		if slices.ContainsFunc(s.vetoes[s.group], func(existing Veto) bool {
+			return existing.Username == veto.Username && existing.MovieID == veto.MovieID && existing.CreatedAt.Equal(veto.CreatedAt)
+		}) {
+			continue
+		}
+		veto.ID, veto.RoundID = s.nextVetoID, 0
+		s.nextVetoID++
+		s.vetoes[s.group] = append(s.vetoes[s.group], veto)
+		report.VetoesImported++
+	}
+
+	return report, nil
+}
+
+func (s *MemoryStore) RecordAudit(entry *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = len(s.auditLog) + 1
+	entry.GroupID = s.group
+	entry.CreatedAt = time.Now().UTC()
+	s.auditLog = append(s.auditLog, *entry)
+	return nil
+}
+
+func (s *MemoryStore) GetAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(s.auditLog) - 1; i >= 0; i-- {
+		entry := s.auditLog[i]
+		switch {
+		case entry.GroupID != s.group,
+			filter.Actor != "" && entry.Actor != filter.Actor,
+			filter.Action != "" && entry.Action != filter.Action,
+			filter.MovieID != 0 && entry.MovieID != filter.MovieID,
+			!filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !entry.CreatedAt.Before(filter.Until):
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if filter.Offset >= len(entries) {
+		return []AuditEntry{}, nil
+	}
+	entries = entries[filter.Offset:]
+	if len(entries) > filter.limit() {
+		entries = entries[:filter.limit()]
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) PlanMovie(movieID int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.liveMovie(movieID)
+	if !ok || !movie.QueuePosition.Valid {
+		return fmt.Errorf("%w: movie %d is not queued", ErrNotFound, movieID)
+	}
+	if at.IsZero() {
+		delete(s.plans, movieID)
+		return nil
+	}
+	s.plans[movieID] = at.UTC()
+	return nil
+}
+
+func (s *MemoryStore) GetPlans() (map[int]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plans := make(map[int]time.Time)
+	for id, at := range s.plans {
+		if _, ok := s.groupMovie(id); ok {
+			plans[id] = at
+		}
+	}
+	return plans, nil
+}
+
+func (s *MemoryStore) GetSession() (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[s.group]
+	if !ok {
+		return Session{State: SessionIdle}, nil
+	}
+	return session, nil
+}
+
+func (s *MemoryStore) SaveSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session.UpdatedAt == nil {
+		now := time.Now().UTC()
+		session.UpdatedAt = &now
+	}
+	session.Movie = nil
+	s.sessions[s.group] = session
+	return nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// MainQueueSlug selects the group's main queue, the one vote winners go to
+// unless the group names another. It cannot be used by a named queue.
+const MainQueueSlug = "main"
+
+// NamedQueue is a side list of movies a group keeps next to its main queue,
+// like "October horror". Each has its own order, and a movie may sit in
+// several of them.
+type NamedQueue struct {
+	ID        int       `json:"id"`
+	GroupID   int       `json:"group_id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (queue *NamedQueue) Validate() error {
+	if !groupSlug.MatchString(queue.Slug) || queue.Slug == MainQueueSlug {
+		return fmt.Errorf("invalid queue slug %q: use lowercase letters, digits and dashes, other than %q", queue.Slug, MainQueueSlug)
+	}
+	if queue.Name == "" {
+		queue.Name = queue.Slug
+	}
+	return nil
+}
+
+// QueueStore returns store scoped to the queue with the given slug: the main
+// queue for "" or MainQueueSlug, or one of the group's named queues.
+func QueueStore(store Store, slug string) (Store, error) {
+	if slug == "" || slug == MainQueueSlug {
+		return store.ForQueue(0), nil
+	}
+	queue, err := store.GetNamedQueue(slug)
+	if err != nil {
+		return nil, err
+	}
+	return store.ForQueue(queue.ID), nil
+}
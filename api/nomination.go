@@ -0,0 +1,154 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// PhaseNominating rounds collect nominations and take no ballots.
+	PhaseNominating = "nominating"
+	PhaseVoting     = "voting"
+)
+
+const (
+	AuditOpenNominations  = "open_nominations"
+	AuditCloseNominations = "close_nominations"
+)
+
+const DefaultNominationsPerUser = 2
+
+// DefaultNominationHours is how long nominations opened by hand run when the
+// group has no nomination_hours of its own.
+const DefaultNominationHours = 24
+
+var (
+	ErrNotNominating   = errors.New("the vote round is not taking nominations")
+	ErrNominationLimit = errors.New("no nominations left in this round")
+)
+
+type Nomination struct {
+	RoundID   int       `json:"round_id"`
+	MovieID   int       `json:"movie_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenNominations opens a round in the nominating phase. Nominations close
+// at closesAt, or after the group's nomination_hours when closesAt is zero.
+// It returns ErrConflict while another round is open.
+func OpenNominations(store Store, actor string, closesAt time.Time) (VoteRound, error) {
+	if _, err := store.GetCurrentVoteRound(); err == nil {
+		return VoteRound{}, fmt.Errorf("%w: a vote is already open", ErrConflict)
+	} else if !errors.Is(err, ErrNotFound) {
+		return VoteRound{}, err
+	}
+
+	if err := openNominations(store, closesAt); err != nil {
+		return VoteRound{}, err
+	}
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return round, err
+	}
+	recordVoteAudit(store, actor, AuditOpenNominations, nil, round)
+	return round, nil
+}
+
+// CloseNominations moves the nominating round to voting on the most
+// nominated movies, topped up by the group's candidate strategy when there
+// are fewer than its candidate_count. The vote closes at the group's next
+// scheduled vote.
+func CloseNominations(store Store, actor string) (VoteRound, error) {
+	before, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return before, err
+	}
+	if before.Phase != PhaseNominating {
+		return before, ErrNotNominating
+	}
+	movieIDs, err := startVoting(store)
+	if err != nil {
+		return before, err
+	}
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return round, err
+	}
+	recordVoteAudit(store, actor, AuditCloseNominations, before, map[string]any{"vote": movieIDs})
+	return round, nil
+}
+
+func openNominations(store Store, closesAt time.Time) error {
+	now := time.Now()
+	if closesAt.IsZero() {
+		group, err := storeGroup(store)
+		if err != nil {
+			return err
+		}
+		hours := group.NominationHours
+		if hours == 0 {
+			hours = DefaultNominationHours
+		}
+		closesAt = now.Add(time.Duration(hours) * time.Hour)
+	} else if !closesAt.After(now) {
+		return fmt.Errorf("%w: the deadline has already passed", ErrInvalidVote)
+	}
+
+	if err := store.OpenNominations(); err != nil {
+		return err
+	}
+	return store.SetVoteDeadline(closesAt)
+}
+
+func startVoting(store Store) ([]int, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return nil, err
+	}
+	nominations, err := store.GetNominations()
+	if err != nil {
+		return nil, err
+	}
+	eligible, err := store.GetUnwatchedMoviesNotInQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	// Movies nominated most often come first, then those nominated first.
+	counts := make(map[int]int)
+	var nominated []int
+	for _, nomination := range nominations {
+		if !slices.ContainsFunc(eligible, func(movie Movie) bool { return movie.ID == nomination.MovieID }) {
+			continue
+		}
+		if counts[nomination.MovieID] == 0 {
+			nominated = append(nominated, nomination.MovieID)
+		}
+		counts[nomination.MovieID]++
+	}
+	sort.SliceStable(nominated, func(i, j int) bool { return counts[nominated[i]] > counts[nominated[j]] })
+	if len(nominated) > group.CandidateCount {
+		nominated = nominated[:group.CandidateCount]
+	}
+
+	if len(nominated) < group.CandidateCount {
+		topUp, err := selectCandidates(store, group, nil, group.CandidateCount-len(nominated), nominated)
+		if err != nil {
+			return nil, err
+		}
+		nominated = append(nominated, topUp...)
+	}
+
+	closesAt, err := nextVote(store, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := store.StartVoting(nominated); err != nil {
+		return nil, err
+	}
+	return nominated, store.SetVoteDeadline(closesAt)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+type Participation struct {
+	// Ballots counts everyone who voted, registered or not, and Voters
+	// names them.
+	Ballots int      `json:"ballots,omitempty"`
+	Voters  []string `json:"voters,omitempty"`
+	// Voted counts the registered aliases that voted, out of Registered.
+	Voted      int        `json:"voted,omitempty"`
+	Registered int        `json:"registered"`
+	Quorum     int        `json:"quorum"`
+	ClosesAt   *time.Time `json:"closes_at"`
+	Visibility string     `json:"visibility"`
+}
+
+func (p Participation) Complete() bool {
+	return p.Registered > 0 && p.Voted == p.Registered
+}
+
+// GetParticipation counts the ballots of the open round against the group's
+// aliases. It returns ErrNotFound when no round is open.
+func GetParticipation(store Store) (Participation, error) {
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return Participation{}, err
+	}
+	group, err := storeGroup(store)
+	if err != nil {
+		return Participation{}, err
+	}
+	aliases, err := store.GetAliases()
+	if err != nil {
+		return Participation{}, err
+	}
+	ballots, err := store.GetBallots()
+	if err != nil {
+		return Participation{}, err
+	}
+
+	participation := Participation{Ballots: len(ballots), Registered: len(aliases), Quorum: group.Quorum,
+		ClosesAt: round.ClosesAt, Visibility: round.Visibility}
+	voters := make(map[string]bool, len(ballots))
+	for _, ballot := range ballots {
+		voters[ballot.Username] = true
+		participation.Voters = append(participation.Voters, ballot.Username)
+	}
+	sort.Strings(participation.Voters)
+	for _, alias := range aliases {
+		if voters[alias.Username] {
+			participation.Voted++
+		}
+	}
+	return participation, nil
+}
+
+// CloseIfComplete closes the open round early, queuing its results, once
+// every registered alias has voted. It returns the archived round and
+// whether it was closed.
+func CloseIfComplete(store Store, actor string) (VoteRound, bool, error) {
+	participation, err := GetParticipation(store)
+	if errors.Is(err, ErrNotFound) {
+		return VoteRound{}, false, nil
+	}
+	if err != nil || !participation.Complete() {
+		return VoteRound{}, false, err
+	}
+	round, err := CloseVote(store, actor)
+	if err != nil {
+		return round, false, err
+	}
+	return round, true, nil
+}
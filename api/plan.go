@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type ScheduledMovie struct {
+	Movie
+	PlannedAt time.Time `json:"planned_at"`
+	// Recurring is set for a time taken from the group's movie night rather
+	// than planned by hand.
+	Recurring bool `json:"recurring"`
+}
+
+// WatchSchedule dates the main queue of store's group. Movies planned by hand
+// keep their time; the others, in queue order, take the group's movie nights
+// after now, skipping the days a planned movie already holds. Without a
+// movie night only the planned movies are listed.
+func WatchSchedule(store Store, now time.Time) ([]ScheduledMovie, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := store.ForQueue(0).GetQueue()
+	if err != nil {
+		return nil, err
+	}
+	plans, err := store.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	var nights cron.Schedule
+	if group.MovieNight != "" {
+		if nights, err = cron.ParseStandard(group.MovieNight); err != nil {
+			return nil, fmt.Errorf("invalid movie night %q: %w", group.MovieNight, err)
+		}
+	}
+
+	var planned []time.Time
+	for _, movie := range queue {
+		if at, ok := plans[movie.ID]; ok {
+			planned = append(planned, at)
+		}
+	}
+	// taken reports whether a planned movie falls on the day of night, in
+	// the movie night's time zone.
+	taken := func(night time.Time) bool {
+		for _, at := range planned {
+			y, m, d := at.In(night.Location()).Date()
+			if ny, nm, nd := night.Date(); y == ny && m == nm && d == nd {
+				return true
+			}
+		}
+		return false
+	}
+
+	schedule := []ScheduledMovie{}
+	night := now
+	for _, movie := range queue {
+		if at, ok := plans[movie.ID]; ok {
+			schedule = append(schedule, ScheduledMovie{Movie: movie, PlannedAt: at})
+			continue
+		}
+		if nights == nil {
+			continue
+		}
+		for night = nights.Next(night); taken(night); night = nights.Next(night) {
+		}
+		if night.IsZero() {
+			// The movie night never comes again.
+			nights = nil
+			continue
+		}
+		schedule = append(schedule, ScheduledMovie{Movie: movie, PlannedAt: night.UTC(), Recurring: true})
+	}
+	return schedule, nil
+}
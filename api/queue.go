@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrInvalidQueueOrder = errors.New("invalid queue order")
+
+// moveInQueue returns order with movieID moved to the 1-based position,
+// shifting the movies in between.
+func moveInQueue(order []int, movieID int, position int) ([]int, error) {
+	from := slices.Index(order, movieID)
+	if from < 0 {
+		return nil, fmt.Errorf("%w: movie %d is not queued", ErrNotFound, movieID)
+	}
+	if position < 1 || position > len(order) {
+		return nil, fmt.Errorf("%w: position %d is outside 1..%d", ErrInvalidQueueOrder, position, len(order))
+	}
+	moved := slices.Delete(slices.Clone(order), from, from+1)
+	return slices.Insert(moved, position-1, movieID), nil
+}
+
+func swapInQueue(order []int, movieID int, otherID int) ([]int, error) {
+	i, j := slices.Index(order, movieID), slices.Index(order, otherID)
+	if i < 0 || j < 0 {
+		return nil, fmt.Errorf("%w: both movies must be queued", ErrNotFound)
+	}
+	swapped := slices.Clone(order)
+	swapped[i], swapped[j] = swapped[j], swapped[i]
+	return swapped, nil
+}
+
+func checkQueueOrder(order []int, movieIDs []int) error {
+	if len(movieIDs) != len(order) {
+		return fmt.Errorf("%w: expected %d movies, got %d", ErrInvalidQueueOrder, len(order), len(movieIDs))
+	}
+	seen := make(map[int]bool, len(movieIDs))
+	for _, id := range movieIDs {
+		if seen[id] {
+			return fmt.Errorf("%w: movie %d is listed twice", ErrInvalidQueueOrder, id)
+		}
+		if !slices.Contains(order, id) {
+			return fmt.Errorf("%w: movie %d is not queued", ErrInvalidQueueOrder, id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func checkQueueable(movieID int, queued bool, watched bool) error {
+	if queued {
+		return fmt.Errorf("%w: movie %d is already queued", ErrConflict, movieID)
+	}
+	if watched {
+		return fmt.Errorf("%w: movie %d was already watched", ErrConflict, movieID)
+	}
+	return nil
+}
+
+const (
+	QueueDuplicatePosition = "duplicate_position"
+	// QueueGap is a run of positions missing between 1 and the end of the
+	// queue, reported at its first position, or a movie placed before 1.
+	QueueGap     = "gap"
+	QueueWatched = "watched"
+	QueueDeleted = "deleted"
+)
+
+type QueueProblem struct {
+	Kind     string `json:"kind"`
+	Position int64  `json:"position"`
+	// MovieID is the movie at fault, or 0 for missing positions.
+	MovieID int `json:"movie_id,omitempty"`
+}
+
+// QueueReport lists the problems of a group's queue and, after a repair,
+// the queue order that fixed them.
+type QueueReport struct {
+	Problems []QueueProblem `json:"problems"`
+	Repaired bool           `json:"repaired"`
+	Queue    []int          `json:"queue,omitempty"`
+}
+
+type queueEntry struct {
+	id       int
+	position int64
+	watched  bool
+	deleted  bool
+}
+
+// checkQueue finds the problems of entries, ordered by position and id, and
+// returns them with the order a repair keeps: the live, unwatched movies in
+// their current order.
+func checkQueue(entries []queueEntry) ([]QueueProblem, []int) {
+	problems := []QueueProblem{}
+	order := []int{}
+	next := int64(1)
+	for i, entry := range entries {
+		switch {
+		case i > 0 && entry.position == entries[i-1].position:
+			problems = append(problems, QueueProblem{Kind: QueueDuplicatePosition, Position: entry.position, MovieID: entry.id})
+		case entry.position < 1:
+			problems = append(problems, QueueProblem{Kind: QueueGap, Position: entry.position, MovieID: entry.id})
+		case entry.position > next:
+			problems = append(problems, QueueProblem{Kind: QueueGap, Position: next})
+		}
+		next = max(entry.position+1, 1)
+
+		switch {
+		case entry.deleted:
+			problems = append(problems, QueueProblem{Kind: QueueDeleted, Position: entry.position, MovieID: entry.id})
+		case entry.watched:
+			problems = append(problems, QueueProblem{Kind: QueueWatched, Position: entry.position, MovieID: entry.id})
+		default:
+			order = append(order, entry.id)
+		}
+	}
+	return problems, order
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+const VoteCandidates = 5
+
+var ErrInvalidVote = errors.New("invalid vote")
+
+// Audit actions of the vote lifecycle. AuditRotateVote records a whole
+// scheduled rotation; the others a change made through the admin routes.
+const (
+	AuditRotateVote = "rotate_vote"
+	AuditOpenVote   = "open_vote"
+	AuditCloseVote  = "close_vote"
+	AuditCancelVote = "cancel_vote"
+	AuditExtendVote = "extend_vote"
+)
+
+// OpenVote opens a round on movieIDs, or on candidates picked by the group's
+// strategy when movieIDs is empty. The round closes at
+// closesAt, or at the group's next scheduled vote when closesAt is zero. It
+// returns ErrConflict while another round is open.
+func OpenVote(store Store, actor string, movieIDs []int, closesAt time.Time) (VoteRound, error) {
+	if _, err := store.GetCurrentVoteRound(); err == nil {
+		return VoteRound{}, fmt.Errorf("%w: a vote is already open", ErrConflict)
+	} else if !errors.Is(err, ErrNotFound) {
+		return VoteRound{}, err
+	}
+
+	if _, err := openVote(store, movieIDs, closesAt); err != nil {
+		return VoteRound{}, err
+	}
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return round, err
+	}
+	recordVoteAudit(store, actor, AuditOpenVote, nil, round)
+	return round, nil
+}
+
+// CloseVote ends the open round now and appends its results to the queue in
+// order. It returns the archived round.
+func CloseVote(store Store, actor string) (VoteRound, error) {
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return round, err
+	}
+	results, err := closeVote(store)
+	if err != nil {
+		return round, err
+	}
+	archived, err := store.GetVoteRound(round.ID)
+	if err != nil {
+		return archived, err
+	}
+	recordVoteAudit(store, actor, AuditCloseVote, round, map[string]any{"results": results, "queue": queueIDs(store)})
+	return archived, nil
+}
+
+// CancelVote ends the open round without queuing anything or archiving
+// results.
+func CancelVote(store Store, actor string) error {
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return err
+	}
+	if err := store.CancelCurrentVote(); err != nil {
+		return err
+	}
+	recordVoteAudit(store, actor, AuditCancelVote, round, nil)
+	return nil
+}
+
+// ExtendVote moves the deadline of the open round to closesAt, which must be
+// later than both now and the current deadline.
+func ExtendVote(store Store, actor string, closesAt time.Time) (VoteRound, error) {
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return round, err
+	}
+	if !closesAt.After(time.Now()) || (round.ClosesAt != nil && !closesAt.After(*round.ClosesAt)) {
+		return round, fmt.Errorf("%w: the new deadline must be later than the current one", ErrInvalidVote)
+	}
+	if err := store.SetVoteDeadline(closesAt); err != nil {
+		return round, err
+	}
+	recordVoteAudit(store, actor, AuditExtendVote, map[string]any{"closes_at": round.ClosesAt}, map[string]any{"closes_at": closesAt.UTC()})
+	return store.GetCurrentVoteRound()
+}
+
+// RotateVote closes the current vote, appends its results to the queue in
+// order and opens a new vote on candidates picked by the group's strategy,
+// due at the group's next scheduled vote. Groups with nomination_hours open
+// a nominating round instead, and rotating a nominating round starts its
+// vote. A round whose deadline was extended past now keeps running. The
+// whole rotation is recorded as a single audit entry by the scheduler actor.
+func RotateVote(store Store) error {
+	before := map[string]any{}
+
+	round, err := store.GetCurrentVoteRound()
+	switch {
+	case err == nil && round.ClosesAt != nil && round.ClosesAt.After(time.Now()):
+		logger.Info(fmt.Sprintf("Vote round %d was extended until %s", round.ID, round.ClosesAt.Format(time.RFC3339)))
+		return nil
+	case err == nil && round.Phase == PhaseNominating:
+		movieIDs, err := startVoting(store)
+		if err != nil {
+			return err
+		}
+		recordVoteAudit(store, "scheduler", AuditRotateVote, round, map[string]any{"vote": movieIDs})
+		return nil
+	case err == nil:
+		results, err := closeVote(store)
+		if err != nil {
+			logger.Error("Error closing vote: ", err)
+		}
+		before["results"] = results
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	group, err := storeGroup(store)
+	if err != nil {
+		return err
+	}
+	after := map[string]any{"queue": queueIDs(store)}
+	if group.NominationHours > 0 {
+		if err := openNominations(store, time.Time{}); err != nil {
+			return err
+		}
+		after["phase"] = PhaseNominating
+	} else {
+		movieIDs, err := openVote(store, nil, time.Time{})
+		if err != nil {
+			return err
+		}
+		after["vote"] = movieIDs
+	}
+	recordVoteAudit(store, "scheduler", AuditRotateVote, before, after)
+	return nil
+}
+
+func openVote(store Store, movieIDs []int, closesAt time.Time) ([]int, error) {
+	now := time.Now()
+	if closesAt.IsZero() {
+		next, err := nextVote(store, now)
+		if err != nil {
+			return nil, err
+		}
+		closesAt = next
+	} else if !closesAt.After(now) {
+		return nil, fmt.Errorf("%w: the deadline has already passed", ErrInvalidVote)
+	}
+
+	if len(movieIDs) == 0 {
+		var err error
+		if movieIDs, err = SelectCandidates(store, nil); err != nil {
+			return nil, err
+		}
+	} else if err := checkCandidates(store, movieIDs); err != nil {
+		return nil, err
+	}
+
+	if err := store.CreateNewVote(movieIDs); err != nil {
+		return nil, err
+	}
+	return movieIDs, store.SetVoteDeadline(closesAt)
+}
+
+// closeVote queues the results of the open round in order, up to the
+// group's queue_winners, and closes it, returning the queued movie ids. The
+// results go to the group's winner queue, the main queue by default. A round
+// without quorum queues nothing.
+func closeVote(store Store) ([]int, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return nil, err
+	}
+	winners, err := store.GetVoteResults()
+	if err != nil {
+		return nil, err
+	}
+	if group.QueueWinners > 0 && len(winners) > group.QueueWinners {
+		winners = winners[:group.QueueWinners]
+	}
+	ballots, err := store.GetBallots()
+	if err != nil {
+		return nil, err
+	}
+	if len(ballots) < group.Quorum {
+		logger.Info(fmt.Sprintf("Vote closed without quorum: %d of %d ballots", len(ballots), group.Quorum))
+		winners = nil
+	}
+	target := store.ForQueue(group.WinnerQueueID)
+	results := []int{}
+	for _, winner := range winners {
+		results = append(results, winner.ID)
+		if err := target.AddMovieToQueue(winner.ID); err != nil {
+			logger.Error("Error adding winner to queue: ", err)
+		}
+	}
+
+	// Close the old round; its ballots stay with it
+	return results, store.ClearCurrentVote()
+}
+
+func checkCandidates(store Store, movieIDs []int) error {
+	seen := make(map[int]bool, len(movieIDs))
+	for _, id := range movieIDs {
+		if seen[id] {
+			return fmt.Errorf("%w: movie %d is listed twice", ErrInvalidVote, id)
+		}
+		seen[id] = true
+
+		movie, err := store.GetMovie(id)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: unknown movie %d", ErrInvalidVote, id)
+		}
+		if err != nil {
+			return err
+		}
+		if movie.Watched {
+			return fmt.Errorf("%w: movie %d was already watched", ErrInvalidVote, id)
+		}
+	}
+	return nil
+}
+
+func nextVote(store Store, t time.Time) (time.Time, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return group.NextVote(t)
+}
+
+func storeGroup(store Store) (Group, error) {
+	groups, err := store.GetGroups()
+	if err != nil {
+		return Group{}, err
+	}
+	for _, group := range groups {
+		if group.ID == store.GroupID() {
+			return group, nil
+		}
+	}
+	return Group{}, ErrNotFound
+}
+
+func queueIDs(store Store) []int {
+	queue, err := store.GetQueue()
+	if err != nil {
+		return nil
+	}
+	ids := []int{}
+	for _, movie := range queue {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+// recordVoteAudit records a change to the vote, or to the watch session,
+// made outside WithAudit.
+func recordVoteAudit(store Store, actor string, action string, before any, after any) {
+	entry := AuditEntry{Actor: actor, Action: action, Before: auditState(before), After: auditState(after)}
+	if err := store.RecordAudit(&entry); err != nil {
+		logger.Error("Failed to record audit entry", err)
+	}
+}
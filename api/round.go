@@ -0,0 +1,72 @@
+package api
+
+import "time"
+
+// VoteRound is one weekly vote. While it is open its candidates carry the
+// live ranking; once it ends they hold the final one.
+type VoteRound struct {
+	ID           int    `json:"id"`
+	GroupID      int    `json:"group_id"`
+	VotingMethod string `json:"voting_method"`
+	// Phase is PhaseNominating or PhaseVoting; closed rounds keep the
+	// phase they ended in.
+	Phase      string `json:"phase"`
+	Visibility string `json:"visibility"`
+	// TieBreak orders candidates with equal scores; TieSeed drives the
+	// random policy.
+	TieBreak  string     `json:"tie_break"`
+	TieSeed   int64      `json:"tie_seed"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	// ClosesAt is when the scheduler closes the round; nil leaves it to the
+	// group's vote schedule.
+	ClosesAt  *time.Time `json:"closes_at"`
+	Cancelled bool       `json:"cancelled"`
+	// NoQuorum rounds closed with fewer ballots than the group's quorum;
+	// their results are kept but nobody won.
+	NoQuorum bool `json:"no_quorum"`
+	// WinnerID is 0 for an open or cancelled round and for a round nobody
+	// could win.
+	WinnerID int `json:"winner_id"`
+	// Candidates are ordered by place, winner first.
+	Candidates []RoundCandidate `json:"candidates"`
+	Vetoes     []Veto           `json:"vetoes"`
+	// Ballots are only filled in by GetVoteRound.
+	Ballots []Ballot `json:"ballots,omitempty"`
+}
+
+// RoundCandidate is a movie's result in a vote round. Score is given by the
+// round's voting method.
+type RoundCandidate struct {
+	MovieID int `json:"movie_id"`
+	Place   int `json:"place"`
+	Score   int `json:"score"`
+}
+
+type MovieVoteStats struct {
+	MovieID int `json:"movie_id"`
+	Rounds  int `json:"rounds"`
+	Wins    int `json:"wins"`
+	Losses  int `json:"losses"`
+}
+
+// Ties returns the groups of candidates with equal scores, each in the
+// order the tie-break policy placed them.
+func (round VoteRound) Ties() [][]int {
+	ties := [][]int{}
+	for start := 0; start < len(round.Candidates); {
+		end := start + 1
+		for end < len(round.Candidates) && round.Candidates[end].Score == round.Candidates[start].Score {
+			end++
+		}
+		if end-start > 1 {
+			var tie []int
+			for _, candidate := range round.Candidates[start:end] {
+				tie = append(tie, candidate.MovieID)
+			}
+			ties = append(ties, tie)
+		}
+		start = end
+	}
+	return ties
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// States of a group's watch session. A session goes from idle to starting
+// with the movie about to be watched, then to watching, then to finished,
+// from which the next movie can be started.
+const (
+	SessionIdle     = "idle"
+	SessionStarting = "starting"
+	SessionWatching = "watching"
+	SessionFinished = "finished"
+)
+
+const (
+	AuditStartSession  = "start_session"
+	AuditWatchSession  = "watch_session"
+	AuditFinishSession = "finish_session"
+	AuditStopSession   = "stop_session"
+)
+
+var ErrInvalidSession = errors.New("invalid session change")
+
+type Session struct {
+	State string `json:"state"`
+	// MovieID is the movie being started, watched or just finished; 0
+	// while idle. Movie is filled in by CurrentSession.
+	MovieID   int        `json:"movie_id,omitempty"`
+	Movie     *Movie     `json:"movie,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func CurrentSession(store Store) (Session, error) {
+	session, err := store.GetSession()
+	if err != nil {
+		return session, err
+	}
+	if session.MovieID != 0 {
+		if movie, err := store.GetMovie(session.MovieID); err == nil {
+			session.Movie = &movie
+		}
+	}
+	return session, nil
+}
+
+// StartSession announces that the group is about to watch movieID, or the
+// first movie of the main queue when movieID is 0. It returns ErrNotFound
+// for an empty queue and ErrInvalidSession while another movie is running.
+func StartSession(store Store, actor string, movieID int) (Session, error) {
+	before, err := store.GetSession()
+	if err != nil {
+		return before, err
+	}
+	if before.State == SessionStarting || before.State == SessionWatching {
+		return before, fmt.Errorf("%w: movie %d is still %s", ErrInvalidSession, before.MovieID, before.State)
+	}
+
+	if movieID == 0 {
+		queue, err := store.ForQueue(0).GetQueue()
+		if err != nil {
+			return before, err
+		}
+		if len(queue) == 0 {
+			return before, fmt.Errorf("%w: the queue is empty", ErrNotFound)
+		}
+		movieID = queue[0].ID
+	}
+	movie, err := store.GetMovie(movieID)
+	if err != nil {
+		return before, err
+	}
+	if movie.Watched {
+		return before, fmt.Errorf("%w: movie %d was already watched", ErrInvalidSession, movieID)
+	}
+
+	return changeSession(store, actor, AuditStartSession, before, Session{State: SessionStarting, MovieID: movieID})
+}
+
+func WatchSession(store Store, actor string) (Session, error) {
+	before, err := store.GetSession()
+	if err != nil {
+		return before, err
+	}
+	if before.State != SessionStarting {
+		return before, fmt.Errorf("%w: no movie is starting", ErrInvalidSession)
+	}
+	now := time.Now().UTC()
+	return changeSession(store, actor, AuditWatchSession, before, Session{State: SessionWatching, MovieID: before.MovieID, StartedAt: &now})
+}
+
+// FinishSession marks the running movie as watched, which takes it out of
+// the queue so the next one moves up, and leaves the session finished on
+// that movie so the group can rate it.
+func FinishSession(store Store, actor string) (Session, error) {
+	before, err := store.GetSession()
+	if err != nil {
+		return before, err
+	}
+	if before.State != SessionStarting && before.State != SessionWatching {
+		return before, fmt.Errorf("%w: no movie is running", ErrInvalidSession)
+	}
+	if err := store.FinishMovie(before.MovieID); err != nil {
+		return before, err
+	}
+	return changeSession(store, actor, AuditFinishSession, before, Session{State: SessionFinished, MovieID: before.MovieID, StartedAt: before.StartedAt})
+}
+
+// StopSession returns the session to idle from any state, without marking
+// anything as watched.
+func StopSession(store Store, actor string) (Session, error) {
+	before, err := store.GetSession()
+	if err != nil {
+		return before, err
+	}
+	return changeSession(store, actor, AuditStopSession, before, Session{State: SessionIdle})
+}
+
+func changeSession(store Store, actor string, action string, before Session, after Session) (Session, error) {
+	now := time.Now().UTC()
+	after.UpdatedAt = &now
+	if err := store.SaveSession(after); err != nil {
+		return before, err
+	}
+	recordVoteAudit(store, actor, action, before, after)
+	return CurrentSession(store)
+}
@@ -0,0 +1,2407 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/database"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+const movieColumns = `id, group_id, name, watched, is_movie, proposed_by, queue_position, tmdb_id, tmdb_image_url, added_at, deleted_at, deleted_by`
+
+// SQLStore is the Store backed by an SQL database. The same queries serve
+// SQLite and PostgreSQL; database.DB takes care of placeholder syntax.
+//
+// Every SQLStore is scoped to one group; ForGroup returns a store for another
+// group sharing the same connection. Its queue methods act on the group's
+// main queue, or on the named queue chosen with ForQueue.
+type SQLStore struct {
+	db    *database.DB
+	group int
+	queue int
+}
+
+// NewSQLStore wraps an already migrated database, scoped to the default group.
+func NewSQLStore(db *database.DB) *SQLStore {
+	return &SQLStore{db: db, group: DefaultGroupID}
+}
+
+func (s *SQLStore) ForGroup(groupID int) Store {
+	return &SQLStore{db: s.db, group: groupID}
+}
+
+func (s *SQLStore) GroupID() int {
+	return s.group
+}
+
+func (s *SQLStore) ForQueue(queueID int) Store {
+	return &SQLStore{db: s.db, group: s.group, queue: queueID}
+}
+
+func (s *SQLStore) QueueID() int {
+	return s.queue
+}
+
+// OpenSQLStore connects to the database and applies pending migrations.
+func OpenSQLStore(dialect database.Dialect, dsn string) (*SQLStore, error) {
+	db, err := database.InitializeDB(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewSQLStore(db), nil
+}
+
+func OpenSQLiteStore(filepath string) (*SQLStore, error) {
+	return OpenSQLStore(database.SQLite, filepath)
+}
+
+func OpenPostgresStore(dsn string) (*SQLStore, error) {
+	return OpenSQLStore(database.Postgres, dsn)
+}
+
+func (s *SQLStore) DB() *database.DB {
+	return s.db
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// Snapshot writes a consistent copy of an SQLite database to dest with
+// VACUUM INTO, without blocking other connections.
+func (s *SQLStore) Snapshot(dest string) error {
+	if s.db.Dialect != database.SQLite {
+		return fmt.Errorf("snapshots are not supported on %s, use its own backup tools", s.db.Dialect)
+	}
+	_, err := s.db.Exec(`VACUUM INTO ?`, dest)
+	return err
+}
+
+func prefixColumns(alias string, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, column := range parts {
+		parts[i] = alias + "." + column
+	}
+	return strings.Join(parts, ", ")
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMovie(row rowScanner) (Movie, error) {
+	var movie Movie
+	err := row.Scan(&movie.ID,
+		&movie.GroupID,
+		&movie.Name,
+		&movie.Watched,
+		&movie.IsMovie,
+		&movie.ProposedBy,
+		&movie.QueuePosition,
+		&movie.TmdbID,
+		&movie.TmdbImageUrl,
+		&movie.AddedAt,
+		&movie.DeletedAt,
+		&movie.DeletedBy)
+	if err == sql.ErrNoRows {
+		return movie, ErrNotFound
+	}
+	return movie, err
+}
+
+func (s *SQLStore) queryMovie(query string, args ...any) (Movie, error) {
+	movie, err := scanMovie(s.db.QueryRow(query, args...))
+	if err != nil {
+		return movie, err
+	}
+
+	movies := []Movie{movie}
+	if err := s.attachRatings(movies); err != nil {
+		return movie, err
+	}
+	return movies[0], nil
+}
+
+func (s *SQLStore) attachRatings(movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	rows, err := s.db.Query(`SELECT movie_id, username, score FROM ratings WHERE movie_id IN (`+placeholders(len(ids))+`)`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	scores := make(map[int]map[string]float64)
+	for rows.Next() {
+		var movieID int
+		var username string
+		var score float64
+		if err := rows.Scan(&movieID, &username, &score); err != nil {
+			return err
+		}
+		if scores[movieID] == nil {
+			scores[movieID] = make(map[string]float64)
+		}
+		scores[movieID][username] = score
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range movies {
+		movies[i].Ratings = ratingsJSON(scores[movies[i].ID])
+	}
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *SQLStore) queryMovies(query string, args ...any) ([]Movie, error) {
+	var movies []Movie
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, s.attachRatings(movies)
+}
+
+func (s *SQLStore) AddAlias(alias *Alias) error {
+	var existingID int
+	row := s.db.QueryRow(`SELECT id FROM aliases WHERE username = ? AND group_id = ?`, alias.Username, s.group)
+	if err := row.Scan(&existingID); err != nil {
+		if err == sql.ErrNoRows {
+			if _, err := s.db.Exec(`INSERT INTO aliases (group_id, username, alias, avatar_url) VALUES (?, ?, ?, ?)`, s.group, alias.Username, alias.Alias, alias.AvatarURL); err != nil {
+				logger.Info("[DB] Insert alias for username: " + alias.Username + ", alias: " + alias.Alias + ", avatar_url: " + alias.AvatarURL)
+				return err
+			}
+			logger.Info("[DB] Insert alias for username: " + alias.Username + ", alias: " + alias.Alias + ", avatar_url: " + alias.AvatarURL)
+		} else {
+			return err
+		}
+	} else {
+		if _, err := s.db.Exec(`UPDATE aliases SET alias = ?, avatar_url = ? WHERE id = ?`, alias.Alias, alias.AvatarURL, existingID); err != nil {
+			return err
+		}
+		logger.Info("[DB] Update alias for username: " + alias.Username + ", alias: " + alias.Alias + ", avatar_url: " + alias.AvatarURL)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetAliases() ([]Alias, error) {
+	aliases := []Alias{}
+	rows, err := s.db.Query(`SELECT id, username, alias, COALESCE(avatar_url, '') FROM aliases WHERE group_id = ? ORDER BY id`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias Alias
+		if err := rows.Scan(&alias.ID, &alias.Username, &alias.Alias, &alias.AvatarURL); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+func (s *SQLStore) ClearAliases() error {
+	if _, err := s.db.Exec(`DELETE FROM aliases WHERE group_id = ?`, s.group); err != nil {
+		logger.Info("[DB] Cleared all aliases")
+		return err
+	}
+	logger.Info("[DB] Cleared all aliases")
+	return nil
+}
+
+func (s *SQLStore) RateMovie(movieID int, username string, rating float64) error {
+	var id int
+	if err := s.db.QueryRow(`SELECT id FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL`, movieID, s.group).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`INSERT INTO ratings (movie_id, username, score, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (movie_id, username) DO UPDATE SET score = excluded.score, updated_at = excluded.updated_at`,
+		movieID, username, rating, now, now); err != nil {
+		logger.Info("[DB] Update ratings for movie id: " + fmt.Sprint(movieID))
+		return err
+	}
+	logger.Info("[DB] Update ratings for movie id: " + fmt.Sprint(movieID))
+
+	return nil
+}
+
+func (s *SQLStore) queryRatings(query string, args ...any) ([]Rating, error) {
+	ratings := []Rating{}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rating Rating
+		if err := rows.Scan(&rating.MovieID, &rating.Username, &rating.Score, &rating.CreatedAt, &rating.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+func (s *SQLStore) GetMovieRatings(movieID int) ([]Rating, error) {
+	return s.queryRatings(`SELECT movie_id, username, score, created_at, updated_at FROM ratings
+		WHERE movie_id = ? AND movie_id IN (SELECT id FROM movies WHERE group_id = ?) ORDER BY username`, movieID, s.group)
+}
+
+func (s *SQLStore) GetUserRatings(username string) ([]Rating, error) {
+	return s.queryRatings(`SELECT movie_id, username, score, created_at, updated_at FROM ratings
+		WHERE username = ? AND movie_id IN (SELECT id FROM movies WHERE group_id = ?) ORDER BY updated_at DESC, movie_id`, username, s.group)
+}
+
+func (s *SQLStore) findDuplicate(tx *database.Tx, tmdbID int, isMovie bool, exceptID int) (int, error) {
+	if tmdbID == 0 {
+		return 0, nil
+	}
+	var id int
+	err := tx.QueryRow(`SELECT id FROM movies WHERE group_id = ? AND tmdb_id = ? AND is_movie = ? AND id <> ? AND deleted_at IS NULL ORDER BY id LIMIT 1`,
+		s.group, tmdbID, isMovie, exceptID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (s *SQLStore) AddMovie(movie *Movie) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	existingID, err := s.findDuplicate(tx, movie.TmdbID, movie.IsMovie, 0)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if existingID != 0 {
+		tx.Rollback()
+		logger.Info("[DB] Insert movie refused: " + movie.Name + " duplicates id=" + fmt.Sprint(existingID))
+		return 0, &DuplicateMovieError{ExistingID: existingID}
+	}
+
+	// LastInsertId is not available on PostgreSQL, RETURNING works on both.
+	id := 0
+	if err := tx.QueryRow(`INSERT INTO movies (
+		group_id,
+		name,
+		is_movie,
+		proposed_by,
+		tmdb_id,
+		tmdb_image_url,
+		added_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		s.group,
+		movie.Name,
+		movie.IsMovie,
+		movie.ProposedBy,
+		movie.TmdbID,
+		movie.TmdbImageUrl,
+		time.Now().UTC()).Scan(&id); err != nil {
+		logger.Info("[DB] Insert movie failed: " + movie.Name)
+		tx.Rollback()
+		return 0, err
+	}
+	logger.Info("[DB] Insert movie: id=" + fmt.Sprint(id) + ", name=" + movie.Name)
+	return id, tx.Commit()
+}
+
+func (s *SQLStore) GetMovies() ([]Movie, error) {
+	return s.queryMovies(`SELECT `+movieColumns+` FROM movies WHERE group_id = ? AND deleted_at IS NULL ORDER BY id`, s.group)
+}
+
+func (s *SQLStore) GetMovie(id int) (Movie, error) {
+	return s.queryMovie(`SELECT `+movieColumns+` FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL`, id, s.group)
+}
+
+func (s *SQLStore) MergeMovies(canonicalID int, duplicateID int) (err error) {
+	if canonicalID == duplicateID {
+		return ErrConflict
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	positions := make(map[int]sql.NullInt64, 2)
+	watched := make(map[int]bool, 2)
+	for _, id := range []int{canonicalID, duplicateID} {
+		var position sql.NullInt64
+		var isWatched bool
+		if err = tx.QueryRow(`SELECT queue_position, watched FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL`, id, s.group).Scan(&position, &isWatched); err != nil {
+			if err == sql.ErrNoRows {
+				err = ErrNotFound
+			}
+			return err
+		}
+		positions[id] = position
+		watched[id] = isWatched
+	}
+
+	// Ratings, the current vote and archived rounds move over unless the
+	// canonical movie already has the same row; what is left behind is
+	// dropped.
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE ratings SET movie_id = ? WHERE movie_id = ?
+			AND username NOT IN (SELECT username FROM ratings WHERE movie_id = ?)`, []any{canonicalID, duplicateID, canonicalID}},
+		{`DELETE FROM ratings WHERE movie_id = ?`, []any{duplicateID}},
+		{`UPDATE current_vote SET movie_id = ? WHERE movie_id = ? AND group_id = ?
+			AND NOT EXISTS (SELECT 1 FROM current_vote WHERE movie_id = ? AND group_id = ?)`, []any{canonicalID, duplicateID, s.group, canonicalID, s.group}},
+		{`DELETE FROM current_vote WHERE movie_id = ? AND group_id = ?`, []any{duplicateID, s.group}},
+		{`UPDATE vote_round_candidates SET movie_id = ? WHERE movie_id = ?
+			AND round_id NOT IN (SELECT round_id FROM vote_round_candidates WHERE movie_id = ?)`, []any{canonicalID, duplicateID, canonicalID}},
+		{`DELETE FROM vote_round_candidates WHERE movie_id = ?`, []any{duplicateID}},
+		{`UPDATE vote_rounds SET winner_id = ? WHERE winner_id = ? AND group_id = ?`, []any{canonicalID, duplicateID, s.group}},
+		{`UPDATE vetoes SET movie_id = ? WHERE movie_id = ? AND group_id = ?`, []any{canonicalID, duplicateID, s.group}},
+		{`UPDATE vetoes SET replacement_id = ? WHERE replacement_id = ? AND group_id = ?`, []any{canonicalID, duplicateID, s.group}},
+		{`UPDATE nominations SET movie_id = ? WHERE movie_id = ?
+			AND NOT EXISTS (SELECT 1 FROM nominations n WHERE n.movie_id = ? AND n.round_id = nominations.round_id AND n.username = nominations.username)`,
+			[]any{canonicalID, duplicateID, canonicalID}},
+		{`DELETE FROM nominations WHERE movie_id = ?`, []any{duplicateID}},
+		{`UPDATE queue_items SET movie_id = ? WHERE movie_id = ?
+			AND queue_id NOT IN (SELECT queue_id FROM queue_items WHERE movie_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM movies WHERE id = ? AND watched)`, []any{canonicalID, duplicateID, canonicalID, canonicalID}},
+		{`DELETE FROM queue_items WHERE movie_id = ?`, []any{duplicateID}},
+		{`DELETE FROM watch_plans WHERE movie_id = ?`, []any{duplicateID}},
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+
+	// Ballots of the open round rank the canonical movie where they ranked
+	// the duplicate, so its tally absorbs the duplicate's.
+	var ballots []Ballot
+	rows, err := tx.Query(`SELECT `+ballotColumns+` FROM ballots
+		WHERE round_id IN (SELECT id FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL)`, s.group)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var ballot Ballot
+		if ballot, err = scanBallot(rows); err != nil {
+			rows.Close()
+			return err
+		}
+		ballots = append(ballots, ballot)
+	}
+	rows.Close()
+	for _, ballot := range ballots {
+		if !slices.Contains(ballot.Ranking, duplicateID) {
+			continue
+		}
+		var ranking []byte
+		if ranking, err = json.Marshal(mergeRanking(ballot.Ranking, canonicalID, duplicateID)); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE ballots SET ranking = ? WHERE round_id = ? AND username = ?`, string(ranking), ballot.RoundID, ballot.Username); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM movies WHERE id = ?`, duplicateID); err != nil {
+		return err
+	}
+	canonical, duplicate := positions[canonicalID], positions[duplicateID]
+	if duplicate.Valid && watched[canonicalID] {
+		// A watched movie stays out of the queue; the duplicate's place closes.
+		if _, err = tx.Exec(`UPDATE movies SET queue_position = queue_position - 1 WHERE queue_position > ? AND group_id = ?`, duplicate.Int64, s.group); err != nil {
+			return err
+		}
+	} else if duplicate.Valid {
+		if !canonical.Valid || duplicate.Int64 < canonical.Int64 {
+			if _, err = tx.Exec(`UPDATE movies SET queue_position = ? WHERE id = ?`, duplicate.Int64, canonicalID); err != nil {
+				return err
+			}
+		}
+		if canonical.Valid {
+			// One of the two positions is gone now; close the later gap.
+			gap := max(canonical.Int64, duplicate.Int64)
+			if _, err = tx.Exec(`UPDATE movies SET queue_position = queue_position - 1 WHERE queue_position > ? AND group_id = ?`, gap, s.group); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = s.compactQueues(tx); err != nil {
+		return err
+	}
+	logger.Info("[DB] Merge movie: id=" + fmt.Sprint(duplicateID) + " into id=" + fmt.Sprint(canonicalID))
+	return tx.Commit()
+}
+
+// DeleteMovie moves a movie to the trash. It leaves the queue, but keeps its
+// ratings so that RestoreMovie brings it back intact.
+func (s *SQLStore) DeleteMovie(id int, deletedBy string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var position sql.NullInt64
+	if err := tx.QueryRow(`SELECT queue_position FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL`, id, s.group).Scan(&position); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE movies SET deleted_at = ?, deleted_by = ?, queue_position = NULL WHERE id = ?`, time.Now().UTC(), deletedBy, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if position.Valid {
+		if _, err := tx.Exec(`UPDATE movies SET queue_position = queue_position - 1 WHERE queue_position > ? AND group_id = ?`, position.Int64, s.group); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM queue_items WHERE movie_id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM watch_plans WHERE movie_id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.compactQueues(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Move movie to trash: id=" + fmt.Sprint(id) + ", by=" + deletedBy)
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetTrash() ([]Movie, error) {
+	return s.queryMovies(`SELECT `+movieColumns+` FROM movies WHERE group_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id`, s.group)
+}
+
+func (s *SQLStore) RestoreMovie(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var tmdbID int
+	var isMovie bool
+	if err := tx.QueryRow(`SELECT tmdb_id, is_movie FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NOT NULL`, id, s.group).Scan(&tmdbID, &isMovie); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	existingID, err := s.findDuplicate(tx, tmdbID, isMovie, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if existingID != 0 {
+		tx.Rollback()
+		return &DuplicateMovieError{ExistingID: existingID}
+	}
+
+	if _, err := tx.Exec(`UPDATE movies SET deleted_at = NULL, deleted_by = '' WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Restore movie from trash: id=" + fmt.Sprint(id))
+	return tx.Commit()
+}
+
+func (s *SQLStore) purgeMovies(condition string, args ...any) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	args = append([]any{s.group}, args...)
+	trashed := `SELECT id FROM movies WHERE group_id = ? AND deleted_at IS NOT NULL AND ` + condition
+	for _, table := range []string{"ratings", "current_vote", "vote_round_candidates", "vetoes", "nominations", "queue_items", "watch_plans"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE movie_id IN (`+trashed+`)`, args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := s.compactQueues(tx); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE vote_rounds SET winner_id = NULL WHERE winner_id IN (`+trashed+`)`, args...); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE vetoes SET replacement_id = NULL WHERE replacement_id IN (`+trashed+`)`, args...); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM movies WHERE group_id = ? AND deleted_at IS NOT NULL AND `+condition, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return int(purged), tx.Commit()
+}
+
+func (s *SQLStore) PurgeMovie(id int) error {
+	purged, err := s.purgeMovies(`id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Purge movie: id=" + fmt.Sprint(id))
+	return nil
+}
+
+func (s *SQLStore) PurgeTrash(deletedBefore time.Time) (int, error) {
+	purged, err := s.purgeMovies(`deleted_at < ?`, deletedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("[DB] Purged " + fmt.Sprint(purged) + " movies from trash")
+	return purged, nil
+}
+
+func (s *SQLStore) ClearMovies() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM ratings WHERE movie_id IN (SELECT id FROM movies WHERE group_id = ?)`, s.group); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM movies WHERE group_id = ?`, s.group); err != nil {
+		logger.Info("[DB] Cleared all movies")
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Cleared all movies")
+	return tx.Commit()
+}
+
+func (s *SQLStore) AddMovieToQueue(movieID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var queued sql.NullInt64
+	var watched bool
+	err = tx.QueryRow(`SELECT queue_position, watched FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL`,
+		movieID, s.group).Scan(&queued, &watched)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if s.queue != 0 {
+		return s.addToNamedQueue(tx, movieID, watched)
+	}
+	if err = checkQueueable(movieID, queued.Valid, watched); err != nil {
+		return err
+	}
+
+	// get highest queue position
+	var highestQueuePosition sql.NullInt64
+	if err = tx.QueryRow(`SELECT MAX(queue_position) FROM movies WHERE queue_position IS NOT NULL AND group_id = ?`, s.group).Scan(&highestQueuePosition); err != nil {
+		return err
+	}
+	position := int64(1)
+	if highestQueuePosition.Valid {
+		position = highestQueuePosition.Int64 + 1
+	}
+
+	if _, err = tx.Exec(`UPDATE movies SET queue_position = ? WHERE id = ?`, position, movieID); err != nil {
+		return err
+	}
+	logger.Info("[DB] Add movie to queue: id=" + fmt.Sprint(movieID))
+	return tx.Commit()
+}
+
+func (s *SQLStore) FinishMovie(movieID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var position sql.NullInt64
+	err = tx.QueryRow(`SELECT queue_position FROM movies WHERE id = ? AND group_id = ?`, movieID, s.group).Scan(&position)
+	if err == sql.ErrNoRows {
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`UPDATE movies SET watched = TRUE, queue_position = NULL WHERE id = ?`, movieID); err != nil {
+		logger.Info("[DB] Mark movie as watched: id=" + fmt.Sprint(movieID))
+		return err
+	}
+	logger.Info("[DB] Mark movie as watched: id=" + fmt.Sprint(movieID))
+
+	if position.Valid {
+		if _, err = tx.Exec(`UPDATE movies SET queue_position = queue_position - 1 WHERE queue_position > ? AND group_id = ?`, position.Int64, s.group); err != nil {
+			logger.Info("[DB] Shift queue positions after " + fmt.Sprint(position.Int64))
+			return err
+		}
+		logger.Info("[DB] Shift queue positions after " + fmt.Sprint(position.Int64))
+	}
+
+	// Watched movies leave the named queues and their plans too.
+	if _, err = tx.Exec(`DELETE FROM queue_items WHERE movie_id = ? AND queue_id IN (SELECT id FROM queues WHERE group_id = ?)`, movieID, s.group); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM watch_plans WHERE movie_id = ? AND group_id = ?`, movieID, s.group); err != nil {
+		return err
+	}
+	if err = s.compactQueues(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addToNamedQueue appends a live movie to the end of the store's named
+// queue and commits tx.
+func (s *SQLStore) addToNamedQueue(tx *database.Tx, movieID int, watched bool) error {
+	var owned int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM queues WHERE id = ? AND group_id = ?`, s.queue, s.group).Scan(&owned); err != nil {
+		return err
+	}
+	if owned == 0 {
+		return ErrNotFound
+	}
+	var queued int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM queue_items WHERE queue_id = ? AND movie_id = ?`, s.queue, movieID).Scan(&queued); err != nil {
+		return err
+	}
+	if err := checkQueueable(movieID, queued > 0, watched); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO queue_items (queue_id, movie_id, position, added_at)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM queue_items WHERE queue_id = ?), ?)`,
+		s.queue, movieID, s.queue, time.Now().UTC()); err != nil {
+		return err
+	}
+	logger.Info("[DB] Add movie to queue: id=" + fmt.Sprint(movieID) + ", queue=" + fmt.Sprint(s.queue))
+	return tx.Commit()
+}
+
+func (s *SQLStore) removeFromNamedQueue(movieID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var inGroup int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM movies WHERE id = ? AND group_id = ?
+		AND EXISTS (SELECT 1 FROM queues WHERE id = ? AND group_id = ?)`, movieID, s.group, s.queue, s.group).Scan(&inGroup); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if inGroup == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM queue_items WHERE queue_id = ? AND movie_id = ?`, s.queue, movieID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.compactQueues(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Remove movie from queue: id=" + fmt.Sprint(movieID) + ", queue=" + fmt.Sprint(s.queue))
+	return tx.Commit()
+}
+
+// compactQueues renumbers the named queues of the group from 1, closing the
+// gaps left by removed movies. The positions are computed here rather than
+// in a correlated UPDATE, which SQLite evaluates against rows it has already
+// rewritten.
+func (s *SQLStore) compactQueues(tx *database.Tx) error {
+	rows, err := tx.Query(`SELECT qi.queue_id, qi.movie_id FROM queue_items qi JOIN queues q ON q.id = qi.queue_id
+		WHERE q.group_id = ? ORDER BY qi.queue_id, qi.position, qi.movie_id`, s.group)
+	if err != nil {
+		return err
+	}
+	var items [][2]int
+	for rows.Next() {
+		var item [2]int
+		if err := rows.Scan(&item[0], &item[1]); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	position, queueID := 0, 0
+	for _, item := range items {
+		if item[0] != queueID {
+			position, queueID = 0, item[0]
+		}
+		position++
+		if _, err := tx.Exec(`UPDATE queue_items SET position = ? WHERE queue_id = ? AND movie_id = ?`, position, item[0], item[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) RemoveMovieFromQueue(movieID int) error {
+	if s.queue != 0 {
+		return s.removeFromNamedQueue(movieID)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var position sql.NullInt64
+	if err := tx.QueryRow(`SELECT queue_position FROM movies WHERE id = ? AND group_id = ?`, movieID, s.group).Scan(&position); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if !position.Valid {
+		return tx.Rollback()
+	}
+
+	if _, err := tx.Exec(`UPDATE movies SET queue_position = NULL WHERE id = ?`, movieID); err != nil {
+		logger.Info("[DB] Remove movie from queue: id=" + fmt.Sprint(movieID))
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Remove movie from queue: id=" + fmt.Sprint(movieID))
+
+	if _, err := tx.Exec(`UPDATE movies SET queue_position = queue_position - 1 WHERE queue_position > ? AND group_id = ?`, position.Int64, s.group); err != nil {
+		logger.Info("[DB] Shift queue positions after " + fmt.Sprint(position.Int64))
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Shift queue positions after " + fmt.Sprint(position.Int64))
+
+	if _, err := tx.Exec(`DELETE FROM watch_plans WHERE movie_id = ?`, movieID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) reorderQueue(reorder func(order []int) ([]int, error)) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var rows *sql.Rows
+	if s.queue != 0 {
+		rows, err = tx.Query(`SELECT qi.movie_id FROM queue_items qi JOIN movies m ON m.id = qi.movie_id
+			WHERE qi.queue_id = ? AND m.deleted_at IS NULL ORDER BY qi.position`, s.queue)
+	} else {
+		rows, err = tx.Query(`SELECT id FROM movies WHERE queue_position IS NOT NULL AND group_id = ? AND deleted_at IS NULL ORDER BY queue_position`, s.group)
+	}
+	if err != nil {
+		return err
+	}
+	var order []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		order = append(order, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	newOrder, err := reorder(order)
+	if err != nil {
+		return err
+	}
+	if err = s.numberQueue(tx, newOrder); err != nil {
+		return err
+	}
+	logger.Info("[DB] Reorder queue: " + fmt.Sprint(newOrder))
+	return tx.Commit()
+}
+
+func (s *SQLStore) numberQueue(tx *database.Tx, movieIDs []int) error {
+	for i, id := range movieIDs {
+		var err error
+		if s.queue != 0 {
+			_, err = tx.Exec(`UPDATE queue_items SET position = ? WHERE queue_id = ? AND movie_id = ?`, i+1, s.queue, id)
+		} else {
+			_, err = tx.Exec(`UPDATE movies SET queue_position = ? WHERE id = ?`, i+1, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueEntries reads every movie of the group holding a queue position,
+// trashed or watched ones included, by position and id.
+func (s *SQLStore) queueEntries(tx *database.Tx) ([]queueEntry, error) {
+	var rows *sql.Rows
+	var err error
+	if s.queue != 0 {
+		// Items whose movie was purged count as deleted.
+		rows, err = tx.Query(`SELECT qi.movie_id, qi.position, COALESCE(m.watched, FALSE), m.id IS NULL OR m.deleted_at IS NOT NULL
+			FROM queue_items qi LEFT JOIN movies m ON m.id = qi.movie_id WHERE qi.queue_id = ? ORDER BY qi.position, qi.movie_id`, s.queue)
+	} else {
+		rows, err = tx.Query(`SELECT id, queue_position, watched, deleted_at IS NOT NULL FROM movies
+			WHERE queue_position IS NOT NULL AND group_id = ? ORDER BY queue_position, id`, s.group)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []queueEntry
+	for rows.Next() {
+		var entry queueEntry
+		if err := rows.Scan(&entry.id, &entry.position, &entry.watched, &entry.deleted); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) CheckQueue() (QueueReport, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return QueueReport{}, err
+	}
+	defer tx.Rollback()
+
+	entries, err := s.queueEntries(tx)
+	if err != nil {
+		return QueueReport{}, err
+	}
+	problems, _ := checkQueue(entries)
+	return QueueReport{Problems: problems}, nil
+}
+
+func (s *SQLStore) RepairQueue() (report QueueReport, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	entries, err := s.queueEntries(tx)
+	if err != nil {
+		return report, err
+	}
+	report.Problems, report.Queue = checkQueue(entries)
+	if len(report.Problems) == 0 {
+		return report, tx.Commit()
+	}
+
+	if s.queue != 0 {
+		_, err = tx.Exec(`DELETE FROM queue_items WHERE queue_id = ? AND movie_id NOT IN (SELECT id FROM movies WHERE NOT watched AND deleted_at IS NULL)`, s.queue)
+	} else {
+		_, err = tx.Exec(`UPDATE movies SET queue_position = NULL WHERE group_id = ? AND (watched OR deleted_at IS NOT NULL)`, s.group)
+	}
+	if err != nil {
+		return report, err
+	}
+	if err = s.numberQueue(tx, report.Queue); err != nil {
+		return report, err
+	}
+	report.Repaired = true
+	logger.Info("[DB] Repair queue: " + fmt.Sprint(len(report.Problems)) + " problems, queue=" + fmt.Sprint(report.Queue))
+	return report, tx.Commit()
+}
+
+func (s *SQLStore) MoveInQueue(movieID int, position int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return moveInQueue(order, movieID, position) })
+}
+
+func (s *SQLStore) SwapInQueue(movieID int, otherID int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return swapInQueue(order, movieID, otherID) })
+}
+
+func (s *SQLStore) ReorderQueue(movieIDs []int) error {
+	return s.reorderQueue(func(order []int) ([]int, error) { return movieIDs, checkQueueOrder(order, movieIDs) })
+}
+
+func (s *SQLStore) GetQueue() ([]Movie, error) {
+	if s.queue != 0 {
+		return s.queryMovies(`SELECT m.id, m.group_id, m.name, m.watched, m.is_movie, m.proposed_by, qi.position, m.tmdb_id,
+			m.tmdb_image_url, m.added_at, m.deleted_at, m.deleted_by FROM queue_items qi JOIN movies m ON m.id = qi.movie_id
+			WHERE qi.queue_id = ? AND m.deleted_at IS NULL ORDER BY qi.position`, s.queue)
+	}
+	return s.queryMovies(`SELECT `+movieColumns+` FROM movies WHERE queue_position IS NOT NULL AND group_id = ? AND deleted_at IS NULL ORDER BY queue_position ASC`, s.group)
+}
+
+func (s *SQLStore) GetUnwatchedMoviesNotInQueue() ([]Movie, error) {
+	return s.queryMovies(`SELECT `+movieColumns+` FROM movies WHERE watched = FALSE AND queue_position IS NULL AND group_id = ? AND deleted_at IS NULL ORDER BY id`, s.group)
+}
+
+func (s *SQLStore) openRound(tx *database.Tx) (int, error) {
+	var id int
+	err := tx.QueryRow(`SELECT id FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL ORDER BY id DESC LIMIT 1`, s.group).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// liveCandidates returns the open round's candidates that are not in the
+// trash, in order, with just their id and added_at; that is all counting
+// needs.
+func (s *SQLStore) liveCandidates(tx *database.Tx) ([]Movie, error) {
+	var candidates []Movie
+	rows, err := tx.Query(`SELECT m.id, m.added_at FROM current_vote cv JOIN movies m ON m.id = cv.movie_id
+		WHERE cv.group_id = ? AND m.deleted_at IS NULL ORDER BY cv.id`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+		if err := rows.Scan(&movie.ID, &movie.AddedAt); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, movie)
+	}
+	return candidates, rows.Err()
+}
+
+func (s *SQLStore) archiveRound(tx *database.Tx, roundID int) error {
+	var method, tieBreak string
+	var tieSeed int64
+	if err := tx.QueryRow(`SELECT voting_method, tie_break, tie_seed FROM vote_rounds WHERE id = ?`, roundID).Scan(&method, &tieBreak, &tieSeed); err != nil {
+		return err
+	}
+	rules, err := newRoundRules(method, tieBreak, tieSeed)
+	if err != nil {
+		return err
+	}
+	candidates, err := s.liveCandidates(tx)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(`SELECT `+ballotColumns+` FROM ballots WHERE round_id = ? ORDER BY username`, roundID)
+	if err != nil {
+		return err
+	}
+	ballots, err := scanBallots(rows)
+	if err != nil {
+		return err
+	}
+
+	var quorum int
+	if err := tx.QueryRow(`SELECT quorum FROM watch_groups WHERE id = ?`, s.group).Scan(&quorum); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	placed := rules.place(candidates, ballots)
+	for _, candidate := range placed {
+		if _, err := tx.Exec(`INSERT INTO vote_round_candidates (round_id, movie_id, place, score) VALUES (?, ?, ?, ?)`,
+			roundID, candidate.MovieID, candidate.Place, candidate.Score); err != nil {
+			return err
+		}
+	}
+	if len(ballots) < quorum {
+		logger.Info("[DB] Vote round without quorum: id=" + fmt.Sprint(roundID) + ", ballots=" + fmt.Sprint(len(ballots)))
+		_, err := tx.Exec(`UPDATE vote_rounds SET no_quorum = TRUE WHERE id = ?`, roundID)
+		return err
+	}
+	if len(placed) > 0 {
+		if _, err := tx.Exec(`UPDATE vote_rounds SET winner_id = ? WHERE id = ?`, placed[0].MovieID, roundID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) closeRound(tx *database.Tx) error {
+	roundID, err := s.openRound(tx)
+	if err != nil {
+		return err
+	}
+	if roundID != 0 {
+		if err := s.archiveRound(tx, roundID); err != nil {
+			return err
+		}
+		logger.Info("[DB] Close vote round: id=" + fmt.Sprint(roundID))
+	}
+	if _, err := tx.Exec(`UPDATE vote_rounds SET ended_at = ? WHERE group_id = ? AND ended_at IS NULL`, time.Now().UTC(), s.group); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM current_vote WHERE group_id = ?`, s.group)
+	return err
+}
+
+// startRound closes the group's open round and opens a new one in phase.
+func (s *SQLStore) startRound(tx *database.Tx, phase string) (int, error) {
+	if err := s.closeRound(tx); err != nil {
+		return 0, err
+	}
+	var roundID int
+	err := tx.QueryRow(`INSERT INTO vote_rounds (group_id, started_at, phase, voting_method, tie_break, tie_seed, visibility)
+		VALUES (?, ?, ?, COALESCE((SELECT voting_method FROM watch_groups WHERE id = ?), ?),
+			COALESCE((SELECT tie_break FROM watch_groups WHERE id = ?), ?), ?,
+			COALESCE((SELECT visibility FROM watch_groups WHERE id = ?), ?)) RETURNING id`,
+		s.group, time.Now().UTC(), phase, s.group, DefaultVotingMethod, s.group, DefaultTieBreak, rand.Int63(),
+		s.group, DefaultVisibility).Scan(&roundID)
+	return roundID, err
+}
+
+func (s *SQLStore) CreateNewVote(movieIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	roundID, err := s.startRound(tx, PhaseVoting)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, movieID := range movieIDs {
+		if _, err := tx.Exec(`INSERT INTO current_vote (group_id, movie_id) VALUES (?, ?)`, s.group, movieID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	logger.Info("[DB] Open vote round: id=" + fmt.Sprint(roundID))
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) ClearCurrentVote() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := s.closeRound(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) SetVoteDeadline(closesAt time.Time) error {
+	result, err := s.db.Exec(`UPDATE vote_rounds SET closes_at = ? WHERE group_id = ? AND ended_at IS NULL`, closesAt.UTC(), s.group)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Set vote deadline: " + closesAt.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (s *SQLStore) CancelCurrentVote() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE vote_rounds SET ended_at = ?, cancelled = TRUE WHERE group_id = ? AND ended_at IS NULL`, time.Now().UTC(), s.group)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		tx.Rollback()
+		return err
+	} else if affected == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM current_vote WHERE group_id = ?`, s.group); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Cancel vote round")
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetCurrentVote() ([]Movie, error) {
+	return s.queryMovies(`SELECT `+prefixColumns("m", movieColumns)+` FROM movies m JOIN current_vote cv ON m.id = cv.movie_id
+		WHERE cv.group_id = ? AND m.deleted_at IS NULL ORDER BY cv.id`, s.group)
+}
+
+func (s *SQLStore) CastVote(username string, movieIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	roundID, err := s.openRound(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if roundID == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+
+	candidates, err := s.liveCandidates(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var candidateIDs []int
+	for _, movie := range candidates {
+		candidateIDs = append(candidateIDs, movie.ID)
+	}
+	if err := validateBallot(movieIDs, candidateIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	ranking, err := json.Marshal(movieIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`INSERT INTO ballots (round_id, username, ranking, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (round_id, username) DO UPDATE SET ranking = excluded.ranking, updated_at = excluded.updated_at`,
+		roundID, username, string(ranking), now, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Cast ballot: round=" + fmt.Sprint(roundID) + ", username=" + username)
+
+	return tx.Commit()
+}
+
+const ballotColumns = `round_id, username, ranking, created_at, updated_at`
+
+func scanBallot(row rowScanner) (Ballot, error) {
+	var ballot Ballot
+	var ranking string
+	if err := row.Scan(&ballot.RoundID, &ballot.Username, &ranking, &ballot.CreatedAt, &ballot.UpdatedAt); err != nil {
+		return ballot, err
+	}
+	err := json.Unmarshal([]byte(ranking), &ballot.Ranking)
+	return ballot, err
+}
+
+// scanBallots reads every ballot from rows and closes them.
+func scanBallots(rows *sql.Rows) ([]Ballot, error) {
+	defer rows.Close()
+
+	ballots := []Ballot{}
+	for rows.Next() {
+		ballot, err := scanBallot(rows)
+		if err != nil {
+			return nil, err
+		}
+		ballots = append(ballots, ballot)
+	}
+	return ballots, rows.Err()
+}
+
+func (s *SQLStore) GetBallot(username string) (Ballot, error) {
+	ballot, err := scanBallot(s.db.QueryRow(`SELECT `+ballotColumns+` FROM ballots
+		WHERE round_id IN (SELECT id FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL) AND username = ?`, s.group, username))
+	if err == sql.ErrNoRows {
+		return ballot, ErrNotFound
+	}
+	return ballot, err
+}
+
+func (s *SQLStore) GetBallots() ([]Ballot, error) {
+	rows, err := s.db.Query(`SELECT `+ballotColumns+` FROM ballots
+		WHERE round_id IN (SELECT id FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL) ORDER BY username`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	return scanBallots(rows)
+}
+
+func (s *SQLStore) GetVotingMethod() (string, error) {
+	var method string
+	err := s.db.QueryRow(`SELECT voting_method FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL ORDER BY id DESC LIMIT 1`, s.group).Scan(&method)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return method, err
+}
+
+func (s *SQLStore) SetVotingMethod(method string) error {
+	if _, err := VotingMethodFor(method); err != nil {
+		return err
+	}
+	result, err := s.db.Exec(`UPDATE vote_rounds SET voting_method = ? WHERE group_id = ? AND ended_at IS NULL`, method, s.group)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Set voting method: " + method)
+	return nil
+}
+
+func (s *SQLStore) SetVoteVisibility(visibility string) error {
+	if err := CheckVisibility(visibility); err != nil {
+		return err
+	}
+	result, err := s.db.Exec(`UPDATE vote_rounds SET visibility = ? WHERE group_id = ? AND ended_at IS NULL`, visibility, s.group)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Set vote visibility: " + visibility)
+	return nil
+}
+
+// rules returns the counting rules of the open round, or the defaults when
+// no round is open.
+func (s *SQLStore) rules() (roundRules, error) {
+	method, tieBreak, tieSeed := DefaultVotingMethod, DefaultTieBreak, int64(0)
+	err := s.db.QueryRow(`SELECT voting_method, tie_break, tie_seed FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL ORDER BY id DESC LIMIT 1`,
+		s.group).Scan(&method, &tieBreak, &tieSeed)
+	if err != nil && err != sql.ErrNoRows {
+		return roundRules{}, err
+	}
+	return newRoundRules(method, tieBreak, tieSeed)
+}
+
+func (s *SQLStore) GetVoteResults() ([]Movie, error) {
+	rules, err := s.rules()
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.GetCurrentVote()
+	if err != nil {
+		return nil, err
+	}
+	ballots, err := s.GetBallots()
+	if err != nil {
+		return nil, err
+	}
+	return orderByPlace(candidates, rules.place(candidates, ballots)), nil
+}
+
+func (s *SQLStore) GetVoteWinner() (Movie, error) {
+	results, err := s.GetVoteResults()
+	if err != nil {
+		return Movie{}, err
+	}
+	if len(results) == 0 {
+		return Movie{}, ErrNotFound
+	}
+	return results[0], nil
+}
+
+func (s *SQLStore) ClearVotes() error {
+	if _, err := s.db.Exec(`DELETE FROM ballots WHERE round_id IN (SELECT id FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL)`, s.group); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetVoteTallies() ([]VoteTally, error) {
+	rules, err := s.rules()
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.GetCurrentVote()
+	if err != nil {
+		return nil, err
+	}
+	ballots, err := s.GetBallots()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(candidates))
+	for _, movie := range candidates {
+		ids = append(ids, movie.ID)
+	}
+	return rules.method.Tally(ids, ballots), nil
+}
+
+const voteRoundColumns = `id, group_id, phase, voting_method, visibility, tie_break, tie_seed, started_at, ended_at, closes_at, cancelled, no_quorum, winner_id`
+
+func scanVoteRound(row rowScanner) (VoteRound, error) {
+	var round VoteRound
+	var winnerID sql.NullInt64
+	err := row.Scan(&round.ID, &round.GroupID, &round.Phase, &round.VotingMethod, &round.Visibility, &round.TieBreak, &round.TieSeed, &round.StartedAt, &round.EndedAt, &round.ClosesAt, &round.Cancelled, &round.NoQuorum, &winnerID)
+	round.WinnerID = int(winnerID.Int64)
+	return round, err
+}
+
+func (s *SQLStore) attachCandidates(rounds []VoteRound) error {
+	byRound := make(map[int]*VoteRound, len(rounds))
+	for i := range rounds {
+		rounds[i].Candidates = []RoundCandidate{}
+		rounds[i].Vetoes = []Veto{}
+		byRound[rounds[i].ID] = &rounds[i]
+	}
+	if err := s.attachVetoes(byRound); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`SELECT c.round_id, c.movie_id, c.place, c.score FROM vote_round_candidates c
+		JOIN vote_rounds r ON r.id = c.round_id WHERE r.group_id = ? ORDER BY c.round_id, c.place`, s.group)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roundID int
+		var candidate RoundCandidate
+		if err := rows.Scan(&roundID, &candidate.MovieID, &candidate.Place, &candidate.Score); err != nil {
+			return err
+		}
+		if round, ok := byRound[roundID]; ok {
+			round.Candidates = append(round.Candidates, candidate)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range rounds {
+		if rounds[i].EndedAt != nil {
+			continue
+		}
+		rules, err := newRoundRules(rounds[i].VotingMethod, rounds[i].TieBreak, rounds[i].TieSeed)
+		if err != nil {
+			return err
+		}
+		candidates, err := s.GetCurrentVote()
+		if err != nil {
+			return err
+		}
+		ballots, err := s.GetBallots()
+		if err != nil {
+			return err
+		}
+		rounds[i].Candidates = rules.place(candidates, ballots)
+	}
+	return nil
+}
+
+func (s *SQLStore) attachVetoes(byRound map[int]*VoteRound) error {
+	rows, err := s.db.Query(`SELECT id, round_id, movie_id, username, replacement_id, created_at FROM vetoes
+		WHERE group_id = ? ORDER BY id`, s.group)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var veto Veto
+		var replacementID sql.NullInt64
+		if err := rows.Scan(&veto.ID, &veto.RoundID, &veto.MovieID, &veto.Username, &replacementID, &veto.CreatedAt); err != nil {
+			return err
+		}
+		veto.ReplacementID = int(replacementID.Int64)
+		if round, ok := byRound[veto.RoundID]; ok {
+			round.Vetoes = append(round.Vetoes, veto)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLStore) VetoCandidate(username string, movieID int, replacementID int) (veto Veto, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return veto, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roundID, err := s.openRound(tx)
+	if err != nil {
+		return veto, err
+	}
+	if roundID == 0 {
+		return veto, ErrNotFound
+	}
+	var candidates int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM current_vote WHERE group_id = ? AND movie_id = ?`, s.group, movieID).Scan(&candidates); err != nil {
+		return veto, err
+	}
+	if candidates == 0 {
+		return veto, fmt.Errorf("%w: movie %d is not a candidate", ErrInvalidVote, movieID)
+	}
+
+	now := time.Now().UTC()
+	var limit, spent int
+	if err = tx.QueryRow(`SELECT vetoes_per_month FROM watch_groups WHERE id = ?`, s.group).Scan(&limit); err != nil {
+		return veto, err
+	}
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM vetoes WHERE group_id = ? AND username = ? AND created_at >= ?`,
+		s.group, username, vetoMonth(now)).Scan(&spent); err != nil {
+		return veto, err
+	}
+	if spent >= limit {
+		return veto, ErrNoVetoesLeft
+	}
+	if replacementID != 0 {
+		var eligible int
+		if err = tx.QueryRow(`SELECT COUNT(*) FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL
+			AND watched = FALSE AND queue_position IS NULL
+			AND id NOT IN (SELECT movie_id FROM current_vote WHERE group_id = ?)`, replacementID, s.group, s.group).Scan(&eligible); err != nil {
+			return veto, err
+		}
+		if eligible == 0 {
+			return veto, fmt.Errorf("%w: movie %d cannot replace a candidate", ErrInvalidVote, replacementID)
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM current_vote WHERE group_id = ? AND movie_id = ?`, s.group, movieID); err != nil {
+		return veto, err
+	}
+	replacement := sql.NullInt64{Int64: int64(replacementID), Valid: replacementID != 0}
+	if replacement.Valid {
+		if _, err = tx.Exec(`INSERT INTO current_vote (group_id, movie_id) VALUES (?, ?)`, s.group, replacementID); err != nil {
+			return veto, err
+		}
+	}
+
+	// Ballots of the round forget the vetoed movie.
+	rows, err := tx.Query(`SELECT `+ballotColumns+` FROM ballots WHERE round_id = ?`, roundID)
+	if err != nil {
+		return veto, err
+	}
+	ballots, err := scanBallots(rows)
+	if err != nil {
+		return veto, err
+	}
+	for _, ballot := range ballots {
+		if !slices.Contains(ballot.Ranking, movieID) {
+			continue
+		}
+		var ranking []byte
+		if ranking, err = json.Marshal(slices.DeleteFunc(ballot.Ranking, func(id int) bool { return id == movieID })); err != nil {
+			return veto, err
+		}
+		if _, err = tx.Exec(`UPDATE ballots SET ranking = ? WHERE round_id = ? AND username = ?`, string(ranking), roundID, ballot.Username); err != nil {
+			return veto, err
+		}
+	}
+
+	veto = Veto{RoundID: roundID, MovieID: movieID, Username: username, ReplacementID: replacementID, CreatedAt: now}
+	if err = tx.QueryRow(`INSERT INTO vetoes (group_id, round_id, movie_id, username, replacement_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`, s.group, roundID, movieID, username, replacement, now).Scan(&veto.ID); err != nil {
+		return veto, err
+	}
+	logger.Info("[DB] Veto candidate: id=" + fmt.Sprint(movieID) + ", username=" + username + ", replacement=" + fmt.Sprint(replacementID))
+	return veto, tx.Commit()
+}
+
+func (s *SQLStore) CountVetoes(username string, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM vetoes WHERE group_id = ? AND username = ? AND created_at >= ?`,
+		s.group, username, since.UTC()).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) GetVetoes() ([]Veto, error) {
+	rows, err := s.db.Query(`SELECT id, round_id, movie_id, username, replacement_id, created_at FROM vetoes
+		WHERE group_id = ? ORDER BY id`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vetoes := []Veto{}
+	for rows.Next() {
+		var veto Veto
+		var replacementID sql.NullInt64
+		if err := rows.Scan(&veto.ID, &veto.RoundID, &veto.MovieID, &veto.Username, &replacementID, &veto.CreatedAt); err != nil {
+			return nil, err
+		}
+		veto.ReplacementID = int(replacementID.Int64)
+		vetoes = append(vetoes, veto)
+	}
+	return vetoes, rows.Err()
+}
+
+func (s *SQLStore) OpenNominations() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	roundID, err := s.startRound(tx, PhaseNominating)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Info("[DB] Open nominations: round=" + fmt.Sprint(roundID))
+	return tx.Commit()
+}
+
+func (s *SQLStore) openPhase(tx *database.Tx) (int, string, error) {
+	var id int
+	var phase string
+	err := tx.QueryRow(`SELECT id, phase FROM vote_rounds WHERE group_id = ? AND ended_at IS NULL ORDER BY id DESC LIMIT 1`,
+		s.group).Scan(&id, &phase)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return id, phase, err
+}
+
+func (s *SQLStore) Nominate(username string, movieID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roundID, phase, err := s.openPhase(tx)
+	if err != nil {
+		return err
+	}
+	if roundID == 0 {
+		return ErrNotFound
+	}
+	if phase != PhaseNominating {
+		return ErrNotNominating
+	}
+
+	var eligible int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM movies WHERE id = ? AND group_id = ? AND deleted_at IS NULL
+		AND watched = FALSE AND queue_position IS NULL`, movieID, s.group).Scan(&eligible); err != nil {
+		return err
+	}
+	if eligible == 0 {
+		return fmt.Errorf("%w: movie %d cannot be nominated", ErrInvalidVote, movieID)
+	}
+
+	var nominated, limit int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM nominations WHERE round_id = ? AND username = ? AND movie_id = ?`,
+		roundID, username, movieID).Scan(&nominated); err != nil {
+		return err
+	}
+	if nominated > 0 {
+		return tx.Commit()
+	}
+	if err = tx.QueryRow(`SELECT nominations_per_user FROM watch_groups WHERE id = ?`, s.group).Scan(&limit); err != nil {
+		return err
+	}
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM nominations WHERE round_id = ? AND username = ?`, roundID, username).Scan(&nominated); err != nil {
+		return err
+	}
+	if nominated >= limit {
+		return ErrNominationLimit
+	}
+
+	if _, err = tx.Exec(`INSERT INTO nominations (round_id, username, movie_id, created_at) VALUES (?, ?, ?, ?)`,
+		roundID, username, movieID, time.Now().UTC()); err != nil {
+		return err
+	}
+	logger.Info("[DB] Nominate: id=" + fmt.Sprint(movieID) + ", username=" + username)
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetNominations() ([]Nomination, error) {
+	rows, err := s.db.Query(`SELECT n.round_id, n.movie_id, n.username, n.created_at FROM nominations n
+		JOIN vote_rounds r ON r.id = n.round_id WHERE r.group_id = ? AND r.ended_at IS NULL ORDER BY n.created_at, n.movie_id`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nominations := []Nomination{}
+	for rows.Next() {
+		var nomination Nomination
+		if err := rows.Scan(&nomination.RoundID, &nomination.MovieID, &nomination.Username, &nomination.CreatedAt); err != nil {
+			return nil, err
+		}
+		nominations = append(nominations, nomination)
+	}
+	return nominations, rows.Err()
+}
+
+func (s *SQLStore) StartVoting(movieIDs []int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roundID, phase, err := s.openPhase(tx)
+	if err != nil {
+		return err
+	}
+	if roundID == 0 {
+		return ErrNotFound
+	}
+	if phase != PhaseNominating {
+		return ErrNotNominating
+	}
+	if _, err = tx.Exec(`UPDATE vote_rounds SET phase = ? WHERE id = ?`, PhaseVoting, roundID); err != nil {
+		return err
+	}
+	for _, movieID := range movieIDs {
+		if _, err = tx.Exec(`INSERT INTO current_vote (group_id, movie_id) VALUES (?, ?)`, s.group, movieID); err != nil {
+			return err
+		}
+	}
+	logger.Info("[DB] Start voting: round=" + fmt.Sprint(roundID))
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetVoteRounds() ([]VoteRound, error) {
+	rounds := []VoteRound{}
+	rows, err := s.db.Query(`SELECT `+voteRoundColumns+` FROM vote_rounds WHERE group_id = ? ORDER BY id DESC`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		round, err := scanVoteRound(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rounds = append(rounds, round)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rounds, s.attachCandidates(rounds)
+}
+
+func (s *SQLStore) GetCurrentVoteRound() (VoteRound, error) {
+	round, err := scanVoteRound(s.db.QueryRow(`SELECT `+voteRoundColumns+` FROM vote_rounds
+		WHERE group_id = ? AND ended_at IS NULL ORDER BY id DESC LIMIT 1`, s.group))
+	if err == sql.ErrNoRows {
+		return round, ErrNotFound
+	}
+	if err != nil {
+		return round, err
+	}
+	rounds := []VoteRound{round}
+	err = s.attachCandidates(rounds)
+	return rounds[0], err
+}
+
+func (s *SQLStore) GetVoteRound(id int) (VoteRound, error) {
+	round, err := scanVoteRound(s.db.QueryRow(`SELECT `+voteRoundColumns+` FROM vote_rounds WHERE id = ? AND group_id = ?`, id, s.group))
+	if err == sql.ErrNoRows {
+		return round, ErrNotFound
+	}
+	if err != nil {
+		return round, err
+	}
+
+	rounds := []VoteRound{round}
+	if err := s.attachCandidates(rounds); err != nil {
+		return round, err
+	}
+	round = rounds[0]
+	rows, err := s.db.Query(`SELECT `+ballotColumns+` FROM ballots WHERE round_id = ? ORDER BY username`, id)
+	if err != nil {
+		return round, err
+	}
+	round.Ballots, err = scanBallots(rows)
+	return round, err
+}
+
+func (s *SQLStore) GetMovieVoteStats(movieID int) (MovieVoteStats, error) {
+	stats := MovieVoteStats{MovieID: movieID}
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN r.winner_id = c.movie_id THEN 1 ELSE 0 END), 0)
+		FROM vote_round_candidates c JOIN vote_rounds r ON r.id = c.round_id
+		WHERE c.movie_id = ? AND r.group_id = ? AND r.ended_at IS NOT NULL AND NOT r.no_quorum`, movieID, s.group).Scan(&stats.Rounds, &stats.Wins)
+	stats.Losses = stats.Rounds - stats.Wins
+	return stats, err
+}
+
+func (s *SQLStore) Import(export *StateExport, mode ImportMode) (report ImportReport, err error) {
+	report = ImportReport{Mode: mode, Conflicts: []ImportConflict{}}
+
+	var existing []Movie
+	if mode == ImportMerge {
+		if existing, err = s.GetMovies(); err != nil {
+			return report, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if mode == ImportReplace {
+		if _, err = tx.Exec(`DELETE FROM ratings WHERE movie_id IN (SELECT id FROM movies WHERE group_id = ?)`, s.group); err != nil {
+			return report, err
+		}
+		if _, err = tx.Exec(`DELETE FROM queue_items WHERE queue_id IN (SELECT id FROM queues WHERE group_id = ?)`, s.group); err != nil {
+			return report, err
+		}
+		for _, table := range []string{"ballots", "vote_round_candidates", "nominations"} {
+			if _, err = tx.Exec(`DELETE FROM `+table+` WHERE round_id IN (SELECT id FROM vote_rounds WHERE group_id = ?)`, s.group); err != nil {
+				return report, err
+			}
+		}
+		for _, table := range []string{"movies", "aliases", "vote_rounds", "current_vote", "vetoes", "queues", "watch_plans", "watch_sessions"} {
+			if _, err = tx.Exec(`DELETE FROM `+table+` WHERE group_id = ?`, s.group); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// idFree reports whether an exported id can be kept; ids are shared by
+	// all groups, so another group may already use it.
+	idFree := func(table string, id int) (bool, error) {
+		if mode != ImportReplace || id <= 0 {
+			return false, nil
+		}
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, id).Scan(&count)
+		return count == 0, err
+	}
+
+	// ids maps movie ids in the document to ids in this database.
+	ids := make(map[int]int)
+	for _, conflict := range findImportConflicts(existing, export.Movies) {
+		ids[conflict.ImportedID] = conflict.ExistingID
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+
+	for _, movie := range export.Movies {
+		if _, ok := ids[movie.ID]; ok {
+			continue
+		}
+		var keepID bool
+		if keepID, err = idFree("movies", movie.ID); err != nil {
+			return report, err
+		}
+		var id int
+		if keepID {
+			err = tx.QueryRow(`INSERT INTO movies (id, group_id, name, watched, is_movie, proposed_by, tmdb_id, tmdb_image_url, added_at, deleted_at, deleted_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+				movie.ID, s.group, movie.Name, movie.Watched, movie.IsMovie, movie.ProposedBy, movie.TmdbID, movie.TmdbImageUrl, movie.AddedAt, movie.DeletedAt, movie.DeletedBy).Scan(&id)
+		} else {
+			err = tx.QueryRow(`INSERT INTO movies (group_id, name, watched, is_movie, proposed_by, tmdb_id, tmdb_image_url, added_at, deleted_at, deleted_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+				s.group, movie.Name, movie.Watched, movie.IsMovie, movie.ProposedBy, movie.TmdbID, movie.TmdbImageUrl, movie.AddedAt, movie.DeletedAt, movie.DeletedBy).Scan(&id)
+		}
+		if err != nil {
+			return report, err
+		}
+		ids[movie.ID] = id
+		report.MoviesImported++
+	}
+
+	for _, rating := range export.Ratings {
+		var result sql.Result
+		result, err = tx.Exec(`INSERT INTO ratings (movie_id, username, score, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (movie_id, username) DO NOTHING`,
+			ids[rating.MovieID], rating.Username, rating.Score, rating.CreatedAt.UTC(), rating.UpdatedAt.UTC())
+		if err != nil {
+			return report, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			report.RatingsImported++
+		}
+	}
+
+	for _, alias := range export.Aliases {
+		var existingID int
+		err = tx.QueryRow(`SELECT id FROM aliases WHERE username = ? AND group_id = ?`, alias.Username, s.group).Scan(&existingID)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return report, err
+		}
+		var keepID bool
+		if keepID, err = idFree("aliases", alias.ID); err != nil {
+			return report, err
+		}
+		if keepID {
+			_, err = tx.Exec(`INSERT INTO aliases (id, group_id, username, alias, avatar_url) VALUES (?, ?, ?, ?, ?)`, alias.ID, s.group, alias.Username, alias.Alias, alias.AvatarURL)
+		} else {
+			_, err = tx.Exec(`INSERT INTO aliases (group_id, username, alias, avatar_url) VALUES (?, ?, ?, ?)`, s.group, alias.Username, alias.Alias, alias.AvatarURL)
+		}
+		if err != nil {
+			return report, err
+		}
+		report.AliasesImported++
+	}
+
+	var highestQueuePosition sql.NullInt64
+	if err = tx.QueryRow(`SELECT MAX(queue_position) FROM movies WHERE group_id = ?`, s.group).Scan(&highestQueuePosition); err != nil {
+		return report, err
+	}
+	position := highestQueuePosition.Int64
+	for _, documentID := range export.Queue {
+		var queued sql.NullInt64
+		var watched, trashed bool
+		if err = tx.QueryRow(`SELECT queue_position, watched, deleted_at IS NOT NULL FROM movies WHERE id = ?`, ids[documentID]).Scan(&queued, &watched, &trashed); err != nil {
+			return report, err
+		}
+		if queued.Valid || watched || trashed {
+			continue
+		}
+		position++
+		if _, err = tx.Exec(`UPDATE movies SET queue_position = ? WHERE id = ?`, position, ids[documentID]); err != nil {
+			return report, err
+		}
+		report.QueueImported++
+	}
+
+	// A vote already running here wins over the imported one.
+	var currentVoteSize int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM current_vote WHERE group_id = ?`, s.group).Scan(&currentVoteSize); err != nil {
+		return report, err
+	}
+	if currentVoteSize == 0 && len(export.CurrentVote) > 0 {
+		var roundID int
+		if roundID, err = s.startRound(tx, PhaseVoting); err != nil {
+			return report, err
+		}
+		if export.VotingMethod != "" {
+			if _, err = tx.Exec(`UPDATE vote_rounds SET voting_method = ? WHERE id = ?`, export.VotingMethod, roundID); err != nil {
+				return report, err
+			}
+		}
+		for _, documentID := range export.CurrentVote {
+			if _, err = tx.Exec(`INSERT INTO current_vote (group_id, movie_id) VALUES (?, ?)`, s.group, ids[documentID]); err != nil {
+				return report, err
+			}
+		}
+		for _, ballot := range export.Ballots {
+			var ranking []byte
+			if ranking, err = json.Marshal(importRanking(ballot.Ranking, ids)); err != nil {
+				return report, err
+			}
+			if _, err = tx.Exec(`INSERT INTO ballots (round_id, username, ranking, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+				roundID, ballot.Username, string(ranking), ballot.CreatedAt.UTC(), ballot.UpdatedAt.UTC()); err != nil {
+				return report, err
+			}
+		}
+		report.VoteImported = true
+	}
+
+	for _, queue := range export.Queues {
+		var queueID int
+		err = tx.QueryRow(`SELECT id FROM queues WHERE group_id = ? AND slug = ?`, s.group, queue.Slug).Scan(&queueID)
+		if err == sql.ErrNoRows {
+			named := NamedQueue{Slug: queue.Slug, Name: queue.Name}
+			named.Validate()
+			err = tx.QueryRow(`INSERT INTO queues (group_id, slug, name, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+				s.group, named.Slug, named.Name, time.Now().UTC()).Scan(&queueID)
+		}
+		if err != nil {
+			return report, err
+		}
+		var position int
+		if err = tx.QueryRow(`SELECT COALESCE(MAX(position), 0) FROM queue_items WHERE queue_id = ?`, queueID).Scan(&position); err != nil {
+			return report, err
+		}
+		for _, documentID := range queue.Movies {
+			var queued int
+			var watched, trashed bool
+			if err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM queue_items WHERE queue_id = ? AND movie_id = movies.id), watched, deleted_at IS NOT NULL
+				FROM movies WHERE id = ?`, queueID, ids[documentID]).Scan(&queued, &watched, &trashed); err != nil {
+				return report, err
+			}
+			if queued > 0 || watched || trashed {
+				continue
+			}
+			position++
+			if _, err = tx.Exec(`INSERT INTO queue_items (queue_id, movie_id, position, added_at) VALUES (?, ?, ?, ?)`,
+				queueID, ids[documentID], position, time.Now().UTC()); err != nil {
+				return report, err
+			}
+			report.QueueImported++
+		}
+	}
+
+	// Plans only hold for movies of the main queue, and a plan made here
+	// wins over the imported one.
+	for _, plan := range export.Plans {
+		if _, err = tx.Exec(`INSERT INTO watch_plans (movie_id, group_id, planned_at)
+			SELECT id, group_id, ? FROM movies WHERE id = ? AND queue_position IS NOT NULL
+			ON CONFLICT (movie_id) DO NOTHING`, plan.PlannedAt.UTC(), ids[plan.MovieID]); err != nil {
+			return report, err
+		}
+	}
+
+	// A session running here wins over the imported one.
+	if session := export.Session; session != nil {
+		var running int
+		if err = tx.QueryRow(`SELECT COUNT(*) FROM watch_sessions WHERE group_id = ? AND movie_id <> 0`, s.group).Scan(&running); err != nil {
+			return report, err
+		}
+		if running == 0 {
+			updatedAt := time.Now().UTC()
+			if session.UpdatedAt != nil {
+				updatedAt = session.UpdatedAt.UTC()
+			}
+			if _, err = tx.Exec(`INSERT INTO watch_sessions (group_id, state, movie_id, started_at, updated_at) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (group_id) DO UPDATE SET state = excluded.state, movie_id = excluded.movie_id,
+				started_at = excluded.started_at, updated_at = excluded.updated_at`,
+				s.group, session.State, ids[session.MovieID], session.StartedAt, updatedAt); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// Imported vetoes belong to no round here; they only count against the
+	// allowance.
+	for _, veto := range export.Vetoes {
+		var known int
+		if err = tx.QueryRow(`SELECT COUNT(*) FROM vetoes WHERE group_id = ? AND username = ? AND movie_id = ? AND created_at = ?`,
+			s.group, veto.Username, ids[veto.MovieID], veto.CreatedAt.UTC()).Scan(&known); err != nil {
+			return report, err
+		}
+		if known > 0 {
+			continue
+		}
+		replacement := sql.NullInt64{Int64: int64(ids[veto.ReplacementID]), Valid: veto.ReplacementID != 0}
+		if _, err = tx.Exec(`INSERT INTO vetoes (group_id, round_id, movie_id, username, replacement_id, created_at) VALUES (?, 0, ?, ?, ?, ?)`,
+			s.group, ids[veto.MovieID], veto.Username, replacement, veto.CreatedAt.UTC()); err != nil {
+			return report, err
+		}
+		report.VetoesImported++
+	}
+
+	// Explicit ids do not advance PostgreSQL sequences.
+	if mode == ImportReplace && s.db.Dialect == database.Postgres {
+		for _, table := range []string{"movies", "aliases"} {
+			if _, err = tx.Exec(`SELECT setval(pg_get_serial_sequence('` + table + `', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM ` + table); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return report, err
+	}
+	logger.Info(fmt.Sprintf("[DB] Imported state (%s) into group %d: %d movies, %d conflicts", mode, s.group, report.MoviesImported, len(report.Conflicts)))
+	return report, nil
+}
+
+func (s *SQLStore) RecordAudit(entry *AuditEntry) error {
+	entry.CreatedAt = time.Now().UTC()
+	entry.GroupID = s.group
+	return s.db.QueryRow(`INSERT INTO audit_log (group_id, actor, action, movie_id, before_state, after_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		entry.GroupID, entry.Actor, entry.Action, entry.MovieID, string(entry.Before), string(entry.After), entry.CreatedAt).Scan(&entry.ID)
+}
+
+func (s *SQLStore) GetAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT id, group_id, actor, action, movie_id, before_state, after_state, created_at FROM audit_log WHERE group_id = ?`
+	args := []any{s.group}
+	if filter.Actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.MovieID != 0 {
+		query += ` AND movie_id = ?`
+		args = append(args, filter.MovieID)
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, filter.Until.UTC())
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.limit(), filter.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after string
+		if err := rows.Scan(&entry.ID, &entry.GroupID, &entry.Actor, &entry.Action, &entry.MovieID, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Before, entry.After = json.RawMessage(before), json.RawMessage(after)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) CreateGroup(group *Group) (int, error) {
+	var existing int
+	err := s.db.QueryRow(`SELECT id FROM watch_groups WHERE slug = ?`, group.Slug).Scan(&existing)
+	if err == nil {
+		return 0, ErrConflict
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	group.setDefaults()
+	group.CreatedAt = time.Now().UTC()
+	if err := s.db.QueryRow(`INSERT INTO watch_groups (slug, name, vote_schedule, voting_method, candidate_strategy, candidate_count, retire_after,
+		tie_break, queue_winners, quorum, visibility, vetoes_per_month, nomination_hours, nominations_per_user, winner_queue_id, movie_night, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		group.Slug, group.Name, group.VoteSchedule, group.VotingMethod, group.CandidateStrategy, group.CandidateCount, group.RetireAfter,
+		group.TieBreak, group.QueueWinners, group.Quorum, group.Visibility, group.VetoesPerMonth, group.NominationHours, group.NominationsPerUser,
+		group.WinnerQueueID, group.MovieNight, group.CreatedAt).Scan(&group.ID); err != nil {
+		return 0, err
+	}
+	logger.Info("[DB] Create group: id=" + fmt.Sprint(group.ID) + ", slug=" + group.Slug)
+	return group.ID, nil
+}
+
+const groupColumns = `id, slug, name, vote_schedule, voting_method, candidate_strategy, candidate_count, retire_after, tie_break, queue_winners, quorum, visibility, vetoes_per_month,
+	nomination_hours, nominations_per_user, winner_queue_id, movie_night, created_at`
+
+func scanGroup(row rowScanner) (Group, error) {
+	var group Group
+	err := row.Scan(&group.ID, &group.Slug, &group.Name, &group.VoteSchedule, &group.VotingMethod,
+		&group.CandidateStrategy, &group.CandidateCount, &group.RetireAfter, &group.TieBreak, &group.QueueWinners, &group.Quorum, &group.Visibility, &group.VetoesPerMonth,
+		&group.NominationHours, &group.NominationsPerUser, &group.WinnerQueueID, &group.MovieNight, &group.CreatedAt)
+	if err == sql.ErrNoRows {
+		return group, ErrNotFound
+	}
+	return group, err
+}
+
+func (s *SQLStore) GetGroups() ([]Group, error) {
+	rows, err := s.db.Query(`SELECT ` + groupColumns + ` FROM watch_groups ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (s *SQLStore) GetGroup(slug string) (Group, error) {
+	return scanGroup(s.db.QueryRow(`SELECT `+groupColumns+` FROM watch_groups WHERE slug = ?`, slug))
+}
+
+func (s *SQLStore) UpdateGroup(group *Group) error {
+	result, err := s.db.Exec(`UPDATE watch_groups SET name = ?, vote_schedule = ?, voting_method = ?,
+		candidate_strategy = ?, candidate_count = ?, retire_after = ?, tie_break = ?, queue_winners = ?, quorum = ?, visibility = ?, vetoes_per_month = ?,
+		nomination_hours = ?, nominations_per_user = ?, winner_queue_id = ?, movie_night = ? WHERE id = ?`,
+		group.Name, group.VoteSchedule, group.VotingMethod, group.CandidateStrategy, group.CandidateCount, group.RetireAfter,
+		group.TieBreak, group.QueueWinners, group.Quorum, group.Visibility, group.VetoesPerMonth,
+		group.NominationHours, group.NominationsPerUser, group.WinnerQueueID, group.MovieNight, group.ID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Update group: id=" + fmt.Sprint(group.ID))
+	return nil
+}
+
+func (s *SQLStore) CreateQueue(queue *NamedQueue) (int, error) {
+	var existing int
+	err := s.db.QueryRow(`SELECT id FROM queues WHERE group_id = ? AND slug = ?`, s.group, queue.Slug).Scan(&existing)
+	if err == nil {
+		return 0, ErrConflict
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	queue.GroupID = s.group
+	queue.CreatedAt = time.Now().UTC()
+	if err := s.db.QueryRow(`INSERT INTO queues (group_id, slug, name, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		queue.GroupID, queue.Slug, queue.Name, queue.CreatedAt).Scan(&queue.ID); err != nil {
+		return 0, err
+	}
+	logger.Info("[DB] Create queue: id=" + fmt.Sprint(queue.ID) + ", slug=" + queue.Slug)
+	return queue.ID, nil
+}
+
+const namedQueueColumns = `id, group_id, slug, name, created_at`
+
+func scanNamedQueue(row rowScanner) (NamedQueue, error) {
+	var queue NamedQueue
+	err := row.Scan(&queue.ID, &queue.GroupID, &queue.Slug, &queue.Name, &queue.CreatedAt)
+	if err == sql.ErrNoRows {
+		return queue, ErrNotFound
+	}
+	return queue, err
+}
+
+func (s *SQLStore) GetQueues() ([]NamedQueue, error) {
+	rows, err := s.db.Query(`SELECT `+namedQueueColumns+` FROM queues WHERE group_id = ? ORDER BY id`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queues := []NamedQueue{}
+	for rows.Next() {
+		queue, err := scanNamedQueue(rows)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, queue)
+	}
+	return queues, rows.Err()
+}
+
+func (s *SQLStore) GetNamedQueue(slug string) (NamedQueue, error) {
+	return scanNamedQueue(s.db.QueryRow(`SELECT `+namedQueueColumns+` FROM queues WHERE group_id = ? AND slug = ?`, s.group, slug))
+}
+
+func (s *SQLStore) UpdateQueue(queue *NamedQueue) error {
+	var existing int
+	err := s.db.QueryRow(`SELECT id FROM queues WHERE group_id = ? AND slug = ? AND id <> ?`, s.group, queue.Slug, queue.ID).Scan(&existing)
+	if err == nil {
+		return ErrConflict
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	result, err := s.db.Exec(`UPDATE queues SET slug = ?, name = ? WHERE id = ? AND group_id = ?`, queue.Slug, queue.Name, queue.ID, s.group)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	logger.Info("[DB] Update queue: id=" + fmt.Sprint(queue.ID) + ", slug=" + queue.Slug)
+	return nil
+}
+
+func (s *SQLStore) DeleteQueue(queueID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM queues WHERE id = ? AND group_id = ?`, queueID, s.group)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	if _, err = tx.Exec(`DELETE FROM queue_items WHERE queue_id = ?`, queueID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE watch_groups SET winner_queue_id = 0 WHERE id = ? AND winner_queue_id = ?`, s.group, queueID); err != nil {
+		return err
+	}
+	logger.Info("[DB] Delete queue: id=" + fmt.Sprint(queueID))
+	return tx.Commit()
+}
+
+func (s *SQLStore) PlanMovie(movieID int, at time.Time) error {
+	var queued int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM movies WHERE id = ? AND group_id = ? AND queue_position IS NOT NULL AND deleted_at IS NULL`,
+		movieID, s.group).Scan(&queued); err != nil {
+		return err
+	}
+	if queued == 0 {
+		return fmt.Errorf("%w: movie %d is not queued", ErrNotFound, movieID)
+	}
+
+	if at.IsZero() {
+		if _, err := s.db.Exec(`DELETE FROM watch_plans WHERE movie_id = ?`, movieID); err != nil {
+			return err
+		}
+		logger.Info("[DB] Clear watch plan: id=" + fmt.Sprint(movieID))
+		return nil
+	}
+	if _, err := s.db.Exec(`INSERT INTO watch_plans (movie_id, group_id, planned_at) VALUES (?, ?, ?)
+		ON CONFLICT (movie_id) DO UPDATE SET planned_at = excluded.planned_at`, movieID, s.group, at.UTC()); err != nil {
+		return err
+	}
+	logger.Info("[DB] Plan movie: id=" + fmt.Sprint(movieID) + ", at=" + at.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (s *SQLStore) GetPlans() (map[int]time.Time, error) {
+	rows, err := s.db.Query(`SELECT movie_id, planned_at FROM watch_plans WHERE group_id = ?`, s.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make(map[int]time.Time)
+	for rows.Next() {
+		var movieID int
+		var at time.Time
+		if err := rows.Scan(&movieID, &at); err != nil {
+			return nil, err
+		}
+		plans[movieID] = at.UTC()
+	}
+	return plans, rows.Err()
+}
+
+func (s *SQLStore) GetSession() (Session, error) {
+	var session Session
+	err := s.db.QueryRow(`SELECT state, movie_id, started_at, updated_at FROM watch_sessions WHERE group_id = ?`, s.group).
+		Scan(&session.State, &session.MovieID, &session.StartedAt, &session.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return Session{State: SessionIdle}, nil
+	}
+	return session, err
+}
+
+func (s *SQLStore) SaveSession(session Session) error {
+	updatedAt := time.Now().UTC()
+	if session.UpdatedAt != nil {
+		updatedAt = session.UpdatedAt.UTC()
+	}
+	if _, err := s.db.Exec(`INSERT INTO watch_sessions (group_id, state, movie_id, started_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (group_id) DO UPDATE SET state = excluded.state, movie_id = excluded.movie_id,
+		started_at = excluded.started_at, updated_at = excluded.updated_at`,
+		s.group, session.State, session.MovieID, session.StartedAt, updatedAt); err != nil {
+		return err
+	}
+	logger.Info("[DB] Save watch session: state=" + session.State + ", movie=" + fmt.Sprint(session.MovieID))
+	return nil
+}
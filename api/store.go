@@ -0,0 +1,203 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+var ErrConflict = errors.New("conflict")
+
+// DuplicateMovieError is returned when a group already has a live movie with
+// the same tmdb_id and is_movie. It matches ErrConflict.
+type DuplicateMovieError struct {
+	ExistingID int
+}
+
+func (err *DuplicateMovieError) Error() string {
+	return fmt.Sprintf("duplicate of movie %d", err.ExistingID)
+}
+
+func (err *DuplicateMovieError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Store is the persistence layer behind the HTTP routes, the scheduler and
+// the websocket broadcast. Implementations must be safe for concurrent use.
+//
+// A Store is scoped to one group; everything except the group methods only
+// sees and changes that group's data.
+type Store interface {
+	ForGroup(groupID int) Store
+	GroupID() int
+	// ForQueue returns a Store whose queue methods act on the group's named
+	// queue with queueID, or on its main queue for 0. QueueID tells which.
+	ForQueue(queueID int) Store
+	QueueID() int
+
+	// CreateGroup fills in the defaults of the settings left empty, except
+	// for vetoes_per_month and nominations_per_user, where 0 is a valid
+	// limit.
+	CreateGroup(group *Group) (int, error)
+	GetGroups() ([]Group, error)
+	GetGroup(slug string) (Group, error)
+	UpdateGroup(group *Group) error
+
+	// AddMovie and RestoreMovie refuse a movie whose tmdb_id and is_movie
+	// match a live one with a *DuplicateMovieError. A tmdb_id of 0 means
+	// unknown and never matches.
+	AddMovie(movie *Movie) (int, error)
+	GetMovie(id int) (Movie, error)
+	GetMovies() ([]Movie, error)
+	ClearMovies() error
+	RateMovie(movieID int, username string, rating float64) error
+	GetMovieRatings(movieID int) ([]Rating, error)
+	GetUserRatings(username string) ([]Rating, error)
+	// MergeMovies folds the ratings, queue position and vote tallies of
+	// duplicateID into canonicalID and deletes the duplicate. Where both
+	// have a rating from the same user the canonical one wins; where both
+	// are queued the canonical movie takes the earlier position. A watched
+	// canonical movie stays out of the queue.
+	MergeMovies(canonicalID int, duplicateID int) error
+
+	// Trashed movies are hidden from every other getter until restored.
+	DeleteMovie(id int, deletedBy string) error
+	GetTrash() ([]Movie, error)
+	RestoreMovie(id int) error
+	PurgeMovie(id int) error
+	PurgeTrash(deletedBefore time.Time) (int, error)
+
+	AddMovieToQueue(movieID int) error
+	RemoveMovieFromQueue(movieID int) error
+	// MoveInQueue moves a queued movie to the 1-based position, shifting
+	// the movies in between. SwapInQueue exchanges the positions of two
+	// queued movies. ReorderQueue replaces the order of the whole queue
+	// with movieIDs, which must list every queued movie once. They return
+	// ErrNotFound for a movie that is not queued and ErrInvalidQueueOrder
+	// for a position or ordering that does not fit the queue.
+	MoveInQueue(movieID int, position int) error
+	SwapInQueue(movieID int, otherID int) error
+	ReorderQueue(movieIDs []int) error
+	// CheckQueue reports duplicate and missing positions and watched or
+	// trashed movies still in the queue. RepairQueue fixes them in one
+	// transaction: watched and trashed movies leave the queue and the rest
+	// are renumbered from 1 in their current order.
+	CheckQueue() (QueueReport, error)
+	RepairQueue() (QueueReport, error)
+	FinishMovie(movieID int) error
+	// GetQueue returns the live movies of the queue in order, with
+	// QueuePosition holding their position in that queue.
+	GetQueue() ([]Movie, error)
+	GetUnwatchedMoviesNotInQueue() ([]Movie, error)
+
+	// CreateQueue adds a named queue to the group; its slug must be unused
+	// in the group. DeleteQueue drops the queue, pointing a group whose
+	// vote winners went there back at its main queue.
+	CreateQueue(queue *NamedQueue) (int, error)
+	GetQueues() ([]NamedQueue, error)
+	GetNamedQueue(slug string) (NamedQueue, error)
+	UpdateQueue(queue *NamedQueue) error
+	DeleteQueue(queueID int) error
+
+	// PlanMovie sets when a movie in the main queue is planned to be
+	// watched, or clears the plan for a zero time. It returns ErrNotFound
+	// for a movie that is not queued. Plans go away when the movie leaves
+	// the queue. GetPlans returns the planned times by movie id.
+	PlanMovie(movieID int, at time.Time) error
+	GetPlans() (map[int]time.Time, error)
+
+	// GetSession returns the group's watch session, idle when it never
+	// started. SaveSession replaces it; the transitions are checked by
+	// StartSession and its siblings.
+	GetSession() (Session, error)
+	SaveSession(session Session) error
+
+	AddAlias(alias *Alias) error
+	GetAliases() ([]Alias, error)
+	ClearAliases() error
+
+	// Votes run in rounds. CreateNewVote closes the open round, if any, and
+	// opens a new one with movieIDs as candidates; ClearCurrentVote closes
+	// it without opening another. Ballots of closed rounds are kept.
+	CreateNewVote(movieIDs []int) error
+	GetCurrentVote() ([]Movie, error)
+	ClearCurrentVote() error
+	// CastVote stores username's ranking for the open round, replacing any
+	// earlier ballot. It returns ErrNotFound when no round is open and
+	// ErrInvalidBallot when the ranking does not fit the candidates.
+	CastVote(username string, movieIDs []int) error
+	GetBallot(username string) (Ballot, error)
+	GetBallots() ([]Ballot, error)
+	// GetVotingMethod and SetVotingMethod read and change the counting
+	// rule of the open round, which starts out as the group's. Both return
+	// ErrNotFound when no round is open.
+	GetVotingMethod() (string, error)
+	SetVotingMethod(method string) error
+	// SetVoteVisibility changes what clients see of the open round. It
+	// returns ErrNotFound when no round is open.
+	SetVoteVisibility(visibility string) error
+	// VetoCandidate removes movieID from the open round on username's
+	// behalf, drops it from the round's ballots and offers replacementID
+	// in its place unless that is 0. It returns ErrNotFound when no round
+	// is open, ErrInvalidVote when the movie is not a candidate or the
+	// replacement could not be nominated or already is one, and
+	// ErrNoVetoesLeft when the user spent the group's vetoes_per_month.
+	VetoCandidate(username string, movieID int, replacementID int) (Veto, error)
+	CountVetoes(username string, since time.Time) (int, error)
+	GetVetoes() ([]Veto, error)
+	// OpenNominations closes the open round like CreateNewVote and opens
+	// one in the nominating phase, without candidates.
+	OpenNominations() error
+	// Nominate records username nominating movieID in the nominating
+	// round. It returns ErrNotFound when no round is open,
+	// ErrNotNominating when the round is voting, ErrInvalidVote for a
+	// movie that is watched, queued or not in the group, and
+	// ErrNominationLimit when the user has nominated the group's
+	// nominations_per_user movies. Nominating a movie twice is a no-op.
+	Nominate(username string, movieID int) error
+	// GetNominations returns the nominations of the open round, oldest
+	// first.
+	GetNominations() ([]Nomination, error)
+	// StartVoting moves the nominating round to the voting phase with
+	// movieIDs as its candidates. It returns ErrNotFound when no round is
+	// open and ErrNotNominating when it is already voting.
+	StartVoting(movieIDs []int) error
+	// Results and tallies are computed from the ballots of the open round
+	// by its voting method.
+	GetVoteResults() ([]Movie, error)
+	GetVoteWinner() (Movie, error)
+	ClearVotes() error
+	GetVoteTallies() ([]VoteTally, error)
+
+	// Closing a round archives the place and score of its candidates.
+	// GetVoteRounds lists the group's rounds newest first without ballots;
+	// GetVoteRound includes them.
+	GetVoteRounds() ([]VoteRound, error)
+	// GetCurrentVoteRound returns the open round, or ErrNotFound.
+	GetCurrentVoteRound() (VoteRound, error)
+	GetVoteRound(id int) (VoteRound, error)
+	GetMovieVoteStats(movieID int) (MovieVoteStats, error)
+	// SetVoteDeadline sets when the open round is due to close and
+	// CancelCurrentVote closes it like ClearCurrentVote, but without
+	// archiving results. Both return ErrNotFound when no round is open.
+	SetVoteDeadline(closesAt time.Time) error
+	CancelCurrentVote() error
+
+	// RecordAudit appends entry to the audit log, filling in its id and
+	// timestamp. Mutations are normally recorded through WithAudit.
+	RecordAudit(entry *AuditEntry) error
+	GetAuditLog(filter AuditFilter) ([]AuditEntry, error)
+
+	// Import loads an exported state document in a single transaction.
+	// Callers should go through ImportState, which validates it first.
+	Import(export *StateExport, mode ImportMode) (ImportReport, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+const (
+	// TieBreakEarliest ranks the movie proposed first higher.
+	TieBreakEarliest = "earliest"
+	// TieBreakRandom shuffles tied movies with the seed recorded on the
+	// round, so the order is random but the same every time it is counted.
+	TieBreakRandom = "random"
+	// TieBreakRunoff counts the ballots again with only the tied movies,
+	// falling back to TieBreakEarliest when they still tie.
+	TieBreakRunoff = "runoff"
+)
+
+const DefaultTieBreak = TieBreakEarliest
+
+var ErrUnknownTieBreak = errors.New("unknown tie-break policy")
+
+func CheckTieBreak(policy string) error {
+	switch policy {
+	case TieBreakEarliest, TieBreakRandom, TieBreakRunoff:
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnknownTieBreak, policy)
+}
+
+type roundRules struct {
+	method   VotingMethod
+	tieBreak string
+	tieSeed  int64
+}
+
+func newRoundRules(method string, tieBreak string, tieSeed int64) (roundRules, error) {
+	votingMethod, err := VotingMethodFor(method)
+	if err != nil {
+		return roundRules{}, err
+	}
+	if err := CheckTieBreak(tieBreak); err != nil {
+		return roundRules{}, err
+	}
+	return roundRules{method: votingMethod, tieBreak: tieBreak, tieSeed: tieSeed}, nil
+}
+
+// place ranks candidates by their score under the voting method, orders
+// equal scores by the tie-break policy and records each one's place and
+// score.
+func (rules roundRules) place(candidates []Movie, ballots []Ballot) []RoundCandidate {
+	scores := scoreCandidates(rules.method, candidates, ballots)
+	ranked := append([]Movie{}, candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i].ID] > scores[ranked[j].ID] })
+
+	// rng is shared by all ties of the round so that each shuffle is
+	// repeatable from the seed alone.
+	rng := rand.New(rand.NewSource(rules.tieSeed))
+	for start := 0; start < len(ranked); {
+		end := start + 1
+		for end < len(ranked) && scores[ranked[end].ID] == scores[ranked[start].ID] {
+			end++
+		}
+		if end-start > 1 {
+			rules.breakTie(ranked[start:end], ballots, rng)
+		}
+		start = end
+	}
+
+	placed := make([]RoundCandidate, 0, len(ranked))
+	for i, movie := range ranked {
+		placed = append(placed, RoundCandidate{MovieID: movie.ID, Place: i + 1, Score: scores[movie.ID]})
+	}
+	return placed
+}
+
+func (rules roundRules) breakTie(tied []Movie, ballots []Ballot, rng *rand.Rand) {
+	byEarliest(tied)
+	switch rules.tieBreak {
+	case TieBreakRandom:
+		rng.Shuffle(len(tied), func(i, j int) { tied[i], tied[j] = tied[j], tied[i] })
+	case TieBreakRunoff:
+		ids := make([]int, 0, len(tied))
+		for _, movie := range tied {
+			ids = append(ids, movie.ID)
+		}
+		runoff := make([]Ballot, 0, len(ballots))
+		for _, ballot := range ballots {
+			ballot.Ranking = slices.DeleteFunc(append([]int{}, ballot.Ranking...), func(id int) bool { return !slices.Contains(ids, id) })
+			runoff = append(runoff, ballot)
+		}
+		scores := scoreCandidates(rules.method, tied, runoff)
+		sort.SliceStable(tied, func(i, j int) bool { return scores[tied[i].ID] > scores[tied[j].ID] })
+	}
+}
+
+// byEarliest orders movies by when they were proposed. Movies from before
+// proposals were dated come first, then ids decide.
+func byEarliest(movies []Movie) {
+	sort.SliceStable(movies, func(i, j int) bool {
+		a, b := movies[i].AddedAt, movies[j].AddedAt
+		switch {
+		case a == nil && b != nil:
+			return true
+		case a != nil && b == nil:
+			return false
+		case a != nil && !a.Equal(*b):
+			return a.Before(*b)
+		}
+		return movies[i].ID < movies[j].ID
+	})
+}
+
+func scoreCandidates(method VotingMethod, candidates []Movie, ballots []Ballot) map[int]int {
+	ids := make([]int, 0, len(candidates))
+	for _, movie := range candidates {
+		ids = append(ids, movie.ID)
+	}
+	scores := make(map[int]int, len(ids))
+	for _, tally := range method.Tally(ids, ballots) {
+		scores[tally.MovieID] = tally.Votes
+	}
+	return scores
+}
+
+func orderByPlace(candidates []Movie, placed []RoundCandidate) []Movie {
+	byID := make(map[int]Movie, len(candidates))
+	for _, movie := range candidates {
+		byID[movie.ID] = movie
+	}
+	ordered := make([]Movie, 0, len(placed))
+	for _, candidate := range placed {
+		ordered = append(ordered, byID[candidate.MovieID])
+	}
+	return ordered
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+const DefaultVetoesPerMonth = 1
+
+var ErrNoVetoesLeft = errors.New("no vetoes left this month")
+
+type Veto struct {
+	ID       int    `json:"id"`
+	RoundID  int    `json:"round_id"`
+	MovieID  int    `json:"movie_id"`
+	Username string `json:"username"`
+	// ReplacementID is the movie that took the vetoed one's place, or 0
+	// when no movie was left to offer.
+	ReplacementID int       `json:"replacement_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// vetoMonth returns the start of the calendar month, in UTC, that t falls in.
+func vetoMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func VetoesLeft(store Store, username string) (int, error) {
+	group, err := storeGroup(store)
+	if err != nil {
+		return 0, err
+	}
+	spent, err := store.CountVetoes(username, vetoMonth(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return max(group.VetoesPerMonth-spent, 0), nil
+}
+
+// VetoCandidate spends one of username's vetoes on removing movieID from the
+// open round. The group's candidate strategy picks a replacement among the
+// movies that are not queued, already up for the vote or vetoed earlier in
+// the round.
+func VetoCandidate(store Store, username string, movieID int) (Veto, error) {
+	round, err := store.GetCurrentVoteRound()
+	if err != nil {
+		return Veto{}, err
+	}
+	candidates, err := store.GetCurrentVote()
+	if err != nil {
+		return Veto{}, err
+	}
+	vetoes, err := store.GetVetoes()
+	if err != nil {
+		return Veto{}, err
+	}
+	exclude := make([]int, 0, len(candidates))
+	for _, movie := range candidates {
+		exclude = append(exclude, movie.ID)
+	}
+	for _, veto := range vetoes {
+		if veto.RoundID == round.ID {
+			exclude = append(exclude, veto.MovieID)
+		}
+	}
+	group, err := storeGroup(store)
+	if err != nil {
+		return Veto{}, err
+	}
+	replacements, err := selectCandidates(store, group, nil, 1, exclude)
+	if err != nil {
+		return Veto{}, err
+	}
+	replacementID := 0
+	if len(replacements) > 0 {
+		replacementID = replacements[0]
+	}
+	return store.VetoCandidate(username, movieID, replacementID)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Visibility names, stored with each vote round and group. They decide what
+// clients see of a round while it is open; closed rounds are always shown in
+// full.
+const (
+	VisibilityOpen = "open"
+	// VisibilityHidden shows who has voted but not the standings.
+	VisibilityHidden = "hidden"
+	// VisibilitySealed shows neither until the round closes.
+	VisibilitySealed = "sealed"
+)
+
+const DefaultVisibility = VisibilityOpen
+
+var ErrUnknownVisibility = errors.New("unknown vote visibility")
+
+func CheckVisibility(visibility string) error {
+	switch visibility {
+	case VisibilityOpen, VisibilityHidden, VisibilitySealed:
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnknownVisibility, visibility)
+}
+
+func (round VoteRound) Revealed() bool {
+	return round.EndedAt != nil || round.Visibility == VisibilityOpen
+}
+
+// Concealed returns the round as clients may see it: an open round that is
+// not revealed lists its candidates by id without places, scores or ballots.
+func (round VoteRound) Concealed() VoteRound {
+	if round.Revealed() {
+		return round
+	}
+	candidates := make([]RoundCandidate, 0, len(round.Candidates))
+	for _, candidate := range round.Candidates {
+		candidates = append(candidates, RoundCandidate{MovieID: candidate.MovieID})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].MovieID < candidates[j].MovieID })
+	round.Candidates = candidates
+	round.Ballots = nil
+	return round
+}
+
+// Concealed returns the participation as clients may see it under its
+// visibility: sealed rounds show neither the ballot counts nor the voters.
+func (p Participation) Concealed() Participation {
+	if p.Visibility == VisibilitySealed {
+		p.Ballots, p.Voted, p.Voters = 0, 0, nil
+	}
+	return p
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	VotingBorda         = "borda"
+	VotingInstantRunoff = "instant_runoff"
+	VotingSchulze       = "schulze"
+	VotingApproval      = "approval"
+	VotingPlurality     = "plurality"
+)
+
+const DefaultVotingMethod = VotingBorda
+
+var ErrUnknownVotingMethod = errors.New("unknown voting method")
+
+// VotingMethod turns the ballots of a round into a score per candidate.
+// Candidates rank by score, highest first; equal scores are ties.
+type VotingMethod interface {
+	// Tally scores every candidate, returning tallies in candidate order.
+	// Ballots rank candidate ids most preferred first and may leave some
+	// out.
+	Tally(candidates []int, ballots []Ballot) []VoteTally
+}
+
+var votingMethods = map[string]VotingMethod{
+	VotingBorda:         bordaCount{},
+	VotingInstantRunoff: instantRunoff{},
+	VotingSchulze:       schulzeMethod{},
+	VotingApproval:      approvalVoting{},
+	VotingPlurality:     pluralityVoting{},
+}
+
+func VotingMethodFor(name string) (VotingMethod, error) {
+	method, ok := votingMethods[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownVotingMethod, name)
+	}
+	return method, nil
+}
+
+func VotingMethods() []string {
+	names := make([]string, 0, len(votingMethods))
+	for name := range votingMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func tallyPoints(candidates []int, points map[int]int) []VoteTally {
+	tallies := make([]VoteTally, 0, len(candidates))
+	for _, id := range candidates {
+		tallies = append(tallies, VoteTally{MovieID: id, Votes: points[id]})
+	}
+	return tallies
+}
+
+// bordaCount gives the first of n ranked movies n-1 points and the last none.
+type bordaCount struct{}
+
+func (bordaCount) Tally(candidates []int, ballots []Ballot) []VoteTally {
+	points := make(map[int]int, len(candidates))
+	for _, ballot := range ballots {
+		for index, id := range reverseInts(ballot.Ranking) {
+			points[id] += index
+		}
+	}
+	return tallyPoints(candidates, points)
+}
+
+type pluralityVoting struct{}
+
+func (pluralityVoting) Tally(candidates []int, ballots []Ballot) []VoteTally {
+	points := make(map[int]int, len(candidates))
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) > 0 {
+			points[ballot.Ranking[0]]++
+		}
+	}
+	return tallyPoints(candidates, points)
+}
+
+// approvalVoting treats every movie on a ballot as approved, regardless of
+// its position, and counts approvals.
+type approvalVoting struct{}
+
+func (approvalVoting) Tally(candidates []int, ballots []Ballot) []VoteTally {
+	points := make(map[int]int, len(candidates))
+	for _, ballot := range ballots {
+		for _, id := range ballot.Ranking {
+			points[id]++
+		}
+	}
+	return tallyPoints(candidates, points)
+}
+
+// instantRunoff repeatedly eliminates the candidates with the fewest first
+// choices among those remaining, moving their ballots to the next choice.
+// A candidate's score is its count in the round it was eliminated, or in the
+// last round for the winners; counts only grow, so later eliminations score
+// higher.
+type instantRunoff struct{}
+
+func (instantRunoff) Tally(candidates []int, ballots []Ballot) []VoteTally {
+	remaining := make(map[int]bool, len(candidates))
+	for _, id := range candidates {
+		remaining[id] = true
+	}
+
+	points := make(map[int]int, len(candidates))
+	for len(remaining) > 0 {
+		counts := make(map[int]int, len(remaining))
+		for _, ballot := range ballots {
+			for _, id := range ballot.Ranking {
+				if remaining[id] {
+					counts[id]++
+					break
+				}
+			}
+		}
+
+		fewest := -1
+		for id := range remaining {
+			if fewest < 0 || counts[id] < fewest {
+				fewest = counts[id]
+			}
+		}
+		for id := range remaining {
+			if counts[id] == fewest {
+				points[id] = fewest
+				delete(remaining, id)
+			} else {
+				points[id] = counts[id]
+			}
+		}
+	}
+	return tallyPoints(candidates, points)
+}
+
+// schulzeMethod compares every pair of candidates by how many ballots prefer
+// one over the other, then by the strongest path between them. A candidate
+// scores one point for every candidate it beats. Movies left off a ballot
+// rank below the ones on it and tie with each other.
+type schulzeMethod struct{}
+
+func (schulzeMethod) Tally(candidates []int, ballots []Ballot) []VoteTally {
+	n := len(candidates)
+	index := make(map[int]int, n)
+	for i, id := range candidates {
+		index[id] = i
+	}
+
+	// preferred[i][j] counts the ballots ranking candidate i above j.
+	preferred := make([][]int, n)
+	for i := range preferred {
+		preferred[i] = make([]int, n)
+	}
+	for _, ballot := range ballots {
+		position := make([]int, n)
+		for i := range position {
+			position[i] = len(ballot.Ranking)
+		}
+		for rank, id := range ballot.Ranking {
+			if i, ok := index[id]; ok {
+				position[i] = rank
+			}
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if position[i] < position[j] {
+					preferred[i][j]++
+				}
+			}
+		}
+	}
+
+	// strength[i][j] is the strength of the strongest path from i to j.
+	strength := make([][]int, n)
+	for i := range strength {
+		strength[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			if i != j && preferred[i][j] > preferred[j][i] {
+				strength[i][j] = preferred[i][j]
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if i == k {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if j == i || j == k {
+					continue
+				}
+				strength[i][j] = max(strength[i][j], min(strength[i][k], strength[k][j]))
+			}
+		}
+	}
+
+	points := make(map[int]int, n)
+	for i, id := range candidates {
+		for j := 0; j < n; j++ {
+			if i != j && strength[i][j] > strength[j][i] {
+				points[id]++
+			}
+		}
+	}
+	return tallyPoints(candidates, points)
+}
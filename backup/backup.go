@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+const (
+	filePrefix = "watchalong-"
+	fileSuffix = ".sqlite"
+	timeFormat = "20060102-150405"
+)
+
+// Snapshotter is implemented by stores that can write a consistent copy of
+// themselves to a file while they keep serving requests.
+type Snapshotter interface {
+	Snapshot(dest string) error
+}
+
+// SourceFor returns the store as a Snapshotter, or an error when its backend
+// has no online backup support.
+func SourceFor(store api.Store) (Snapshotter, error) {
+	sqlStore, ok := store.(*api.SQLStore)
+	if !ok || sqlStore.DB().Dialect != database.SQLite {
+		return nil, fmt.Errorf("online backups are only supported for the sqlite backend")
+	}
+	return sqlStore, nil
+}
+
+// Info describes a backup file.
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Create writes a new timestamped snapshot into dir and returns its path.
+func Create(source Snapshotter, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, filePrefix+time.Now().UTC().Format(timeFormat)+fileSuffix)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	if err := source.Snapshot(path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	logger.Info("[BACKUP] Created " + path)
+	return path, nil
+}
+
+// List returns the backups in dir, newest first.
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Info{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(timeFormat, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Info{Name: name, Size: info.Size(), CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// Rotate deletes all but the newest retention backups in dir.
+func Rotate(dir string, retention int) error {
+	if retention < 1 {
+		return nil
+	}
+
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range backups[min(retention, len(backups)):] {
+		if err := os.Remove(filepath.Join(dir, old.Name)); err != nil {
+			return err
+		}
+		logger.Info("[BACKUP] Removed old backup " + old.Name)
+	}
+	return nil
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath. The
+// backup is copied next to the target and checked first: it must pass an
+// integrity check and carry a schema version this server can migrate. The
+// server must not be running while the file is swapped.
+func Restore(backupPath string, dbPath string) error {
+	tmpPath := dbPath + ".restore"
+	if err := copyFile(backupPath, tmpPath); err != nil {
+		return err
+	}
+
+	if err := verify(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbPath + suffix)
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	logger.Info("[BACKUP] Restored " + dbPath + " from " + backupPath)
+	return nil
+}
+
+func verify(path string) error {
+	db, err := database.Open(database.SQLite, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&integrity); err != nil {
+		return fmt.Errorf("backup is not a readable sqlite database: %w", err)
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("backup failed integrity check: %s", integrity)
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return fmt.Errorf("backup has no schema version, it is not a watchalong database")
+	}
+	if version > database.LatestVersion() {
+		return fmt.Errorf("backup schema version %d is newer than this server supports (%d)", version, database.LatestVersion())
+	}
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/backup"
+	"github.com/MonkaKokosowa/watchalong-server/config"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+)
+
+// runBackup implements `watchalong backup [-db path] [-dir dir] [-retention n]`.
+// It is safe to run while the server is up.
+func runBackup(args []string) error {
+	cfg := config.Load()
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	dir := flags.String("dir", cfg.BackupDir, "directory to write the backup to")
+	retention := flags.Int("retention", 0, "delete all but the newest n backups afterwards (0 keeps everything)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := dbFlags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	source, err := backup.SourceFor(api.NewSQLStore(db))
+	if err != nil {
+		return err
+	}
+
+	path, err := backup.Create(source, *dir)
+	if err != nil {
+		return err
+	}
+	if err := backup.Rotate(*dir, *retention); err != nil {
+		return err
+	}
+
+	fmt.Println(path)
+	return nil
+}
+
+// runRestore implements `watchalong restore [-db path] <backup file>`. The
+// server must be stopped first.
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dialect, err := dbFlags.dialect()
+	if err != nil {
+		return err
+	}
+	if dialect != database.SQLite {
+		return fmt.Errorf("restore is only supported for the sqlite backend")
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: watchalong restore [-db path] <backup file>")
+	}
+
+	return backup.Restore(flags.Arg(0), *dbFlags.dsn)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/MonkaKokosowa/watchalong-server/config"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+)
+
+// commands maps CLI subcommands to their implementations. Running the binary
+// without a subcommand starts the server.
+var commands = map[string]func(args []string) error{
+	"migrate": runMigrate,
+	"backup":  runBackup,
+	"restore": runRestore,
+	"export":  runExport,
+	"import":  runImport,
+	"queue":   runQueue,
+}
+
+func runCommand(name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return command(args)
+}
+
+// databaseFlags registers the -driver and -db flags shared by maintenance
+// commands, defaulting to the server configuration.
+type databaseFlags struct {
+	driver *string
+	dsn    *string
+}
+
+func addDatabaseFlags(flags *flag.FlagSet) databaseFlags {
+	cfg := config.Load()
+	return databaseFlags{
+		driver: flags.String("driver", cfg.DatabaseDriver, "database backend: sqlite or postgres"),
+		dsn:    flags.String("db", cfg.DatabaseDSN, "SQLite file path or PostgreSQL connection string"),
+	}
+}
+
+func (f databaseFlags) dialect() (database.Dialect, error) {
+	return database.ParseDialect(*f.driver)
+}
+
+// open connects once the flags are parsed, without running migrations.
+func (f databaseFlags) open() (*database.DB, error) {
+	dialect, err := f.dialect()
+	if err != nil {
+		return nil, err
+	}
+	return database.Open(dialect, *f.dsn)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// runExport implements `watchalong export [-driver] [-db] [-group slug] [-o file]`. The
+// document goes to stdout unless -o is given.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	group := flags.String("group", "", "slug of the group to export (default the default group)")
+	output := flags.String("o", "", "file to write the export to (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := dbFlags.open()
+	if err != nil {
+		return err
+	}
+	sqlStore := api.NewSQLStore(db)
+	defer sqlStore.Close()
+	store, err := forGroup(sqlStore, *group)
+	if err != nil {
+		return err
+	}
+
+	export, err := api.ExportState(store)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// runImport implements `watchalong import [-driver] [-db] [-group slug] [-mode replace|merge] <file>`.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	group := flags.String("group", "", "slug of the group to import into (default the default group)")
+	mode := flags.String("mode", string(api.ImportMerge), "replace wipes the database first, merge adds to it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: watchalong import [-mode replace|merge] <file>")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var export api.StateExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return err
+	}
+
+	dialect, err := dbFlags.dialect()
+	if err != nil {
+		return err
+	}
+	sqlStore, err := api.OpenSQLStore(dialect, *dbFlags.dsn)
+	if err != nil {
+		return err
+	}
+	defer sqlStore.Close()
+	store, err := forGroup(sqlStore, *group)
+	if err != nil {
+		return err
+	}
+
+	report, err := api.ImportState(store, &export, api.ImportMode(*mode))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d movies, %d ratings, %d aliases, %d queue entries, %d vetoes\n",
+		report.MoviesImported, report.RatingsImported, report.AliasesImported, report.QueueImported, report.VetoesImported)
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("conflict: %q (tmdb %d) already exists as movie %d\n", conflict.Name, conflict.TmdbID, conflict.ExistingID)
+	}
+	return nil
+}
+
+// forGroup scopes store to the group with the given slug; an empty slug keeps
+// the default group.
+func forGroup(store api.Store, slug string) (api.Store, error) {
+	if slug == "" {
+		return store, nil
+	}
+	group, err := store.GetGroup(slug)
+	if err != nil {
+		return nil, fmt.Errorf("group %q: %w", slug, err)
+	}
+	return store.ForGroup(group.ID), nil
+}
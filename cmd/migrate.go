@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/MonkaKokosowa/watchalong-server/database"
+)
+
+// runMigrate implements `watchalong migrate [-driver name] [-db dsn] <up|down|status|to N>`.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := dbFlags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	switch flags.Arg(0) {
+	case "", "up":
+		err = database.Migrate(db)
+	case "down":
+		if current == 0 {
+			return fmt.Errorf("database has no migrations applied")
+		}
+		err = database.MigrateTo(db, current-1)
+	case "to":
+		target, convErr := strconv.Atoi(flags.Arg(1))
+		if convErr != nil {
+			return fmt.Errorf("invalid target version %q", flags.Arg(1))
+		}
+		err = database.MigrateTo(db, target)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down, to or status)", flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d (latest %d)\n", version, database.LatestVersion())
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// runQueue implements `watchalong queue [-driver] [-db] [-group slug] [-repair]`.
+// It reports the problems of the group's queue and, with -repair, fixes them.
+// Unrepaired problems make it fail, so it can run as a health check.
+func runQueue(args []string) error {
+	flags := flag.NewFlagSet("queue", flag.ContinueOnError)
+	dbFlags := addDatabaseFlags(flags)
+	group := flags.String("group", "", "slug of the group to check (default the default group)")
+	repair := flags.Bool("repair", false, "fix the problems found")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := dbFlags.open()
+	if err != nil {
+		return err
+	}
+	sqlStore := api.NewSQLStore(db)
+	defer sqlStore.Close()
+	store, err := forGroup(sqlStore, *group)
+	if err != nil {
+		return err
+	}
+
+	var report api.QueueReport
+	if *repair {
+		report, err = api.WithAudit(store, "cli").RepairQueue()
+	} else {
+		report, err = store.CheckQueue()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range report.Problems {
+		if problem.MovieID != 0 {
+			fmt.Printf("%s at position %d: movie %d\n", problem.Kind, problem.Position, problem.MovieID)
+		} else {
+			fmt.Printf("%s at position %d\n", problem.Kind, problem.Position)
+		}
+	}
+	switch {
+	case len(report.Problems) == 0:
+		fmt.Println("queue ok")
+	case report.Repaired:
+		fmt.Printf("repaired %d problems, queue is now %v\n", len(report.Problems), report.Queue)
+	default:
+		return fmt.Errorf("queue has %d problems; run with -repair to fix them", len(report.Problems))
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/config"
 	"github.com/MonkaKokosowa/watchalong-server/database"
 	"github.com/MonkaKokosowa/watchalong-server/http"
 	"github.com/MonkaKokosowa/watchalong-server/logger"
@@ -16,23 +18,38 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			logger.Error("Command "+os.Args[1]+" failed", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize the database
-	_, err := database.InitializeDB("watchalong.sqlite")
+	cfg := config.Load()
+	dialect, err := database.ParseDialect(cfg.DatabaseDriver)
+	if err != nil {
+		logger.Error("Invalid database configuration", err)
+		return
+	}
+	store, err := api.OpenSQLStore(dialect, cfg.DatabaseDSN)
 	if err != nil {
 		logger.Error("Failed to initialize database", err)
 		return
 	} else {
 		logger.Info("Database initialized successfully")
 	}
-	defer database.CloseDatabase()
-
-	scheduler.StartScheduler()
-	logger.Info("Scheduler started successfully")
+	defer store.Close()
 
+	wsManager := websocket.NewManager()
 	logger.Info("Websocket manager initialized successfully")
 
+	scheduler.StartScheduler(store, cfg, wsManager)
+	logger.Info("Scheduler started successfully")
+
 	// Create HTTP server
-	server := http.NewServer(websocket.WsManager)
+	server := http.NewServer(store, wsManager, cfg)
 
 	// Channel to listen for errors coming from the listener
 	serverErrors := make(chan error, 1)
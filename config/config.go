@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+// Config holds the server settings read from the environment.
+type Config struct {
+	// DatabaseDriver selects the storage backend: "sqlite" or "postgres".
+	DatabaseDriver string
+	// DatabaseDSN is the SQLite file path or the PostgreSQL connection string.
+	DatabaseDSN string
+
+	// AdminToken protects the /admin routes. When empty they are open, like
+	// the rest of the API.
+	AdminToken string
+
+	// BackupDir is where SQLite snapshots are written.
+	BackupDir string
+	// BackupSchedule is the cron spec for automatic backups; empty disables them.
+	BackupSchedule string
+	// BackupRetention is how many automatic backups are kept.
+	BackupRetention int
+
+	// TrashRetentionDays is how long deleted movies stay restorable before
+	// the scheduler purges them; 0 keeps them forever.
+	TrashRetentionDays int
+}
+
+func Load() Config {
+	return Config{
+		DatabaseDriver:  getEnv("WATCHALONG_DB_DRIVER", "sqlite"),
+		DatabaseDSN:     getEnv("WATCHALONG_DB_DSN", "watchalong.sqlite"),
+		AdminToken:      getEnv("WATCHALONG_ADMIN_TOKEN", ""),
+		BackupDir:       getEnv("WATCHALONG_BACKUP_DIR", "backups"),
+		BackupSchedule:  getEnv("WATCHALONG_BACKUP_SCHEDULE", "CRON_TZ=Europe/Warsaw 0 4 * * *"),
+		BackupRetention: getEnvInt("WATCHALONG_BACKUP_RETENTION", 7),
+
+		TrashRetentionDays: getEnvInt("WATCHALONG_TRASH_RETENTION_DAYS", 30),
+	}
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warning("Ignoring invalid " + key + "=" + value)
+		return fallback
+	}
+	return parsed
+}
@@ -2,68 +2,132 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "modernc.org/sqlite"
 )
 
-var DB *sql.DB
+// Dialect identifies the SQL backend a connection talks to.
+type Dialect string
 
-func InitializeDB(filepath string) (*sql.DB, error) {
-	var err error
-	DB, err = sql.Open("sqlite", filepath)
-	if err != nil {
-		return nil, err
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect validates a backend name coming from configuration.
+func ParseDialect(name string) (Dialect, error) {
+	switch Dialect(name) {
+	case SQLite, Postgres:
+		return Dialect(name), nil
 	}
+	return "", fmt.Errorf("unsupported database driver %q (expected sqlite or postgres)", name)
+}
 
-	statement, err := DB.Prepare(`CREATE TABLE IF NOT EXISTS movies (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		watched BOOLEAN NOT NULL DEFAULT 0,
-		is_movie BOOLEAN NOT NULL,
-		proposed_by TEXT NOT NULL,
-		ratings TEXT NOT NULL DEFAULT '{}',
-		queue_position INTEGER,
-		tmdb_id INTEGER NOT NULL,
-		tmdb_image_url TEXT NOT NULL
-		)`)
-	if err != nil {
-		return nil, err
+// Rebind rewrites the ? placeholders used throughout the code base into the
+// dialect's native form.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(r)
 	}
-	statement.Exec()
-
-	_, err = DB.Exec(`CREATE TABLE IF NOT EXISTS aliases (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL,
-		alias TEXT NOT NULL,
-		avatar_url TEXT
-	)`)
+	return builder.String()
+}
+
+// DB is a connection that knows its dialect. Exec, Query, QueryRow and Begin
+// accept queries written with ? placeholders on every dialect.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+// Tx is the transaction counterpart of DB.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.Dialect.Rebind(query), args...)
+}
 
-	_, err = DB.Exec(`CREATE TABLE IF NOT EXISTS votes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		movie_id INTEGER NOT NULL,
-		votes INTEGER NOT NULL DEFAULT 0
-	)`)
+// InitializeDB opens the database and brings its schema up to date.
+func InitializeDB(dialect Dialect, dsn string) (*DB, error) {
+	db, err := Open(dialect, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = DB.Exec(`CREATE TABLE IF NOT EXISTS current_vote (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		movie_id INTEGER NOT NULL
-	)`)
-	if err != nil {
+	if err := Migrate(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return DB, nil
+	return db, nil
 }
 
-func CloseDatabase() error {
-	if err := DB.Close(); err != nil {
-		return err
+// Open opens the database without touching its schema. For SQLite the dsn is
+// a file path or URI and concurrent writers wait for the lock instead of
+// failing with SQLITE_BUSY.
+func Open(dialect Dialect, dsn string) (*DB, error) {
+	var driver string
+	switch dialect {
+	case SQLite:
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		driver, dsn = "sqlite", dsn+separator+"_pragma=busy_timeout(5000)"
+	case Postgres:
+		driver = "pgx"
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", dialect)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return &DB{DB: db, Dialect: dialect}, nil
 }
@@ -0,0 +1,585 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+// Migration is a single numbered schema change. Up moves the schema from
+// Version-1 to Version, Down reverts it. Statements are executed in order
+// inside one transaction together with the schema_version bookkeeping.
+//
+// Statements are written for SQLite and translated for PostgreSQL by
+// Dialect.translate; PostgresUp and PostgresDown replace them entirely when
+// that is not enough.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+
+	PostgresUp   []string
+	PostgresDown []string
+}
+
+// ddlReplacements lists the SQLite-specific fragments used in migrations and
+// their PostgreSQL equivalents.
+var ddlReplacements = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+	"BOOLEAN NOT NULL DEFAULT 0", "BOOLEAN NOT NULL DEFAULT FALSE",
+)
+
+func (d Dialect) translate(statement string) string {
+	if d != Postgres {
+		return statement
+	}
+	return ddlReplacements.Replace(statement)
+}
+
+func (migration Migration) statements(dialect Dialect, up bool) []string {
+	if dialect == Postgres {
+		if up && migration.PostgresUp != nil {
+			return migration.PostgresUp
+		}
+		if !up && migration.PostgresDown != nil {
+			return migration.PostgresDown
+		}
+	}
+
+	statements := migration.Down
+	if up {
+		statements = migration.Up
+	}
+	translated := make([]string, len(statements))
+	for i, statement := range statements {
+		translated[i] = dialect.translate(statement)
+	}
+	return translated
+}
+
+// Migrations is the ordered list of every schema change. New migrations must
+// be appended with the next version number; released ones must never change.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		// IF NOT EXISTS lets databases created before versioning adopt
+		// the baseline without losing data.
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS movies (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				watched BOOLEAN NOT NULL DEFAULT 0,
+				is_movie BOOLEAN NOT NULL,
+				proposed_by TEXT NOT NULL,
+				ratings TEXT NOT NULL DEFAULT '{}',
+				queue_position INTEGER,
+				tmdb_id INTEGER NOT NULL,
+				tmdb_image_url TEXT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS aliases (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT NOT NULL,
+				alias TEXT NOT NULL,
+				avatar_url TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS votes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				movie_id INTEGER NOT NULL,
+				votes INTEGER NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS current_vote (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				movie_id INTEGER NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE current_vote`,
+			`DROP TABLE votes`,
+			`DROP TABLE aliases`,
+			`DROP TABLE movies`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "ratings_table",
+		Up: []string{
+			`CREATE TABLE ratings (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				movie_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				score DOUBLE PRECISION NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				UNIQUE (movie_id, username)
+			)`,
+			`CREATE INDEX ratings_username ON ratings (username)`,
+			`INSERT INTO ratings (movie_id, username, score, created_at, updated_at)
+				SELECT m.id, j.key, j.value, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+				FROM movies m, json_each(m.ratings) j
+				WHERE json_valid(m.ratings)`,
+			`ALTER TABLE movies DROP COLUMN ratings`,
+		},
+		Down: []string{
+			`ALTER TABLE movies ADD COLUMN ratings TEXT NOT NULL DEFAULT '{}'`,
+			`UPDATE movies SET ratings = (SELECT json_group_object(username, score) FROM ratings WHERE movie_id = movies.id)
+				WHERE id IN (SELECT movie_id FROM ratings)`,
+			`DROP TABLE ratings`,
+		},
+		PostgresUp: []string{
+			`CREATE TABLE ratings (
+				id SERIAL PRIMARY KEY,
+				movie_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				score DOUBLE PRECISION NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				UNIQUE (movie_id, username)
+			)`,
+			`CREATE INDEX ratings_username ON ratings (username)`,
+			`INSERT INTO ratings (movie_id, username, score, created_at, updated_at)
+				SELECT m.id, j.key, j.value::DOUBLE PRECISION, NOW() AT TIME ZONE 'UTC', NOW() AT TIME ZONE 'UTC'
+				FROM movies m, json_each_text(m.ratings::json) j`,
+			`ALTER TABLE movies DROP COLUMN ratings`,
+		},
+		PostgresDown: []string{
+			`ALTER TABLE movies ADD COLUMN ratings TEXT NOT NULL DEFAULT '{}'`,
+			`UPDATE movies SET ratings = (SELECT json_object_agg(username, score)::text FROM ratings WHERE movie_id = movies.id)
+				WHERE id IN (SELECT movie_id FROM ratings)`,
+			`DROP TABLE ratings`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "movie_trash",
+		Up: []string{
+			`ALTER TABLE movies ADD COLUMN deleted_at TIMESTAMP`,
+			`ALTER TABLE movies ADD COLUMN deleted_by TEXT NOT NULL DEFAULT ''`,
+		},
+		Down: []string{
+			`DELETE FROM ratings WHERE movie_id IN (SELECT id FROM movies WHERE deleted_at IS NOT NULL)`,
+			`DELETE FROM movies WHERE deleted_at IS NOT NULL`,
+			`ALTER TABLE movies DROP COLUMN deleted_by`,
+			`ALTER TABLE movies DROP COLUMN deleted_at`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "audit_log",
+		Up: []string{
+			`CREATE TABLE audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor TEXT NOT NULL,
+				action TEXT NOT NULL,
+				movie_id INTEGER NOT NULL DEFAULT 0,
+				before_state TEXT NOT NULL,
+				after_state TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX audit_log_created_at ON audit_log (created_at)`,
+		},
+		Down: []string{
+			`DROP TABLE audit_log`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "groups",
+		// Existing data moves into the default group with id 1.
+		Up: []string{
+			`CREATE TABLE watch_groups (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				slug TEXT NOT NULL UNIQUE,
+				name TEXT NOT NULL,
+				vote_schedule TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`INSERT INTO watch_groups (slug, name, vote_schedule, created_at)
+				VALUES ('default', 'Default', 'CRON_TZ=Europe/Warsaw 0 0 * * 0', CURRENT_TIMESTAMP)`,
+			`ALTER TABLE movies ADD COLUMN group_id INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE aliases ADD COLUMN group_id INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE votes ADD COLUMN group_id INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE current_vote ADD COLUMN group_id INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE audit_log ADD COLUMN group_id INTEGER NOT NULL DEFAULT 1`,
+			`CREATE INDEX movies_group_id ON movies (group_id)`,
+			`CREATE INDEX audit_log_group_id ON audit_log (group_id)`,
+		},
+		Down: []string{
+			`DELETE FROM ratings WHERE movie_id IN (SELECT id FROM movies WHERE group_id <> 1)`,
+			`DELETE FROM movies WHERE group_id <> 1`,
+			`DELETE FROM aliases WHERE group_id <> 1`,
+			`DELETE FROM votes WHERE group_id <> 1`,
+			`DELETE FROM current_vote WHERE group_id <> 1`,
+			`DELETE FROM audit_log WHERE group_id <> 1`,
+			`DROP INDEX audit_log_group_id`,
+			`DROP INDEX movies_group_id`,
+			`ALTER TABLE audit_log DROP COLUMN group_id`,
+			`ALTER TABLE current_vote DROP COLUMN group_id`,
+			`ALTER TABLE votes DROP COLUMN group_id`,
+			`ALTER TABLE aliases DROP COLUMN group_id`,
+			`ALTER TABLE movies DROP COLUMN group_id`,
+			`DROP TABLE watch_groups`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "ballots",
+		// Accumulated vote counters cannot be turned into ballots, so a vote
+		// running during the upgrade starts over with no ballots, and
+		// migrating down leaves every tally at zero.
+		Up: []string{
+			`CREATE TABLE vote_rounds (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				group_id INTEGER NOT NULL,
+				started_at TIMESTAMP NOT NULL,
+				ended_at TIMESTAMP
+			)`,
+			`CREATE INDEX vote_rounds_group_id ON vote_rounds (group_id)`,
+			`CREATE TABLE ballots (
+				round_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				ranking TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (round_id, username)
+			)`,
+			`INSERT INTO vote_rounds (group_id, started_at)
+				SELECT DISTINCT group_id, CURRENT_TIMESTAMP FROM current_vote`,
+			`DROP TABLE votes`,
+		},
+		Down: []string{
+			`CREATE TABLE votes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				movie_id INTEGER NOT NULL,
+				votes INTEGER NOT NULL DEFAULT 0,
+				group_id INTEGER NOT NULL DEFAULT 1
+			)`,
+			`INSERT INTO votes (group_id, movie_id) SELECT group_id, movie_id FROM current_vote ORDER BY id`,
+			`DROP TABLE ballots`,
+			`DROP TABLE vote_rounds`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "voting_methods",
+		Up: []string{
+			`ALTER TABLE watch_groups ADD COLUMN voting_method TEXT NOT NULL DEFAULT 'borda'`,
+			`ALTER TABLE vote_rounds ADD COLUMN voting_method TEXT NOT NULL DEFAULT 'borda'`,
+		},
+		Down: []string{
+			`ALTER TABLE vote_rounds DROP COLUMN voting_method`,
+			`ALTER TABLE watch_groups DROP COLUMN voting_method`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "vote_round_archive",
+		// Rounds closed before the upgrade keep their ballots but have no
+		// recorded results.
+		Up: []string{
+			`CREATE TABLE vote_round_candidates (
+				round_id INTEGER NOT NULL,
+				movie_id INTEGER NOT NULL,
+				place INTEGER NOT NULL,
+				score INTEGER NOT NULL,
+				PRIMARY KEY (round_id, movie_id)
+			)`,
+			`CREATE INDEX vote_round_candidates_movie_id ON vote_round_candidates (movie_id)`,
+			`ALTER TABLE vote_rounds ADD COLUMN winner_id INTEGER`,
+		},
+		Down: []string{
+			`ALTER TABLE vote_rounds DROP COLUMN winner_id`,
+			`DROP TABLE vote_round_candidates`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "vote_deadlines",
+		Up: []string{
+			`ALTER TABLE vote_rounds ADD COLUMN closes_at TIMESTAMP`,
+			`ALTER TABLE vote_rounds ADD COLUMN cancelled BOOLEAN NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE vote_rounds DROP COLUMN cancelled`,
+			`ALTER TABLE vote_rounds DROP COLUMN closes_at`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "candidate_selection",
+		// Movies added before this migration have no added_at.
+		Up: []string{
+			`ALTER TABLE movies ADD COLUMN added_at TIMESTAMP`,
+			`ALTER TABLE watch_groups ADD COLUMN candidate_strategy TEXT NOT NULL DEFAULT 'uniform'`,
+			`ALTER TABLE watch_groups ADD COLUMN candidate_count INTEGER NOT NULL DEFAULT 5`,
+			`ALTER TABLE watch_groups ADD COLUMN retire_after INTEGER NOT NULL DEFAULT 3`,
+		},
+		Down: []string{
+			`ALTER TABLE watch_groups DROP COLUMN retire_after`,
+			`ALTER TABLE watch_groups DROP COLUMN candidate_count`,
+			`ALTER TABLE watch_groups DROP COLUMN candidate_strategy`,
+			`ALTER TABLE movies DROP COLUMN added_at`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "tie_breaks",
+		// Rounds from before this migration break ties by proposal date.
+		Up: []string{
+			`ALTER TABLE vote_rounds ADD COLUMN tie_break TEXT NOT NULL DEFAULT 'earliest'`,
+			`ALTER TABLE vote_rounds ADD COLUMN tie_seed BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE watch_groups ADD COLUMN tie_break TEXT NOT NULL DEFAULT 'earliest'`,
+			`ALTER TABLE watch_groups ADD COLUMN queue_winners INTEGER NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE watch_groups DROP COLUMN queue_winners`,
+			`ALTER TABLE watch_groups DROP COLUMN tie_break`,
+			`ALTER TABLE vote_rounds DROP COLUMN tie_seed`,
+			`ALTER TABLE vote_rounds DROP COLUMN tie_break`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "vote_quorum",
+		Up: []string{
+			`ALTER TABLE watch_groups ADD COLUMN quorum INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE vote_rounds ADD COLUMN no_quorum BOOLEAN NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE vote_rounds DROP COLUMN no_quorum`,
+			`ALTER TABLE watch_groups DROP COLUMN quorum`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "vote_visibility",
+		Up: []string{
+			`ALTER TABLE watch_groups ADD COLUMN visibility TEXT NOT NULL DEFAULT 'open'`,
+			`ALTER TABLE vote_rounds ADD COLUMN visibility TEXT NOT NULL DEFAULT 'open'`,
+		},
+		Down: []string{
+			`ALTER TABLE vote_rounds DROP COLUMN visibility`,
+			`ALTER TABLE watch_groups DROP COLUMN visibility`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "vetoes",
+		Up: []string{
+			`ALTER TABLE watch_groups ADD COLUMN vetoes_per_month INTEGER NOT NULL DEFAULT 1`,
+			`CREATE TABLE vetoes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				group_id INTEGER NOT NULL,
+				round_id INTEGER NOT NULL,
+				movie_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				replacement_id INTEGER,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX vetoes_group_id_username ON vetoes (group_id, username)`,
+			`CREATE INDEX vetoes_round_id ON vetoes (round_id)`,
+		},
+		Down: []string{
+			`DROP TABLE vetoes`,
+			`ALTER TABLE watch_groups DROP COLUMN vetoes_per_month`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "nominations",
+		Up: []string{
+			`ALTER TABLE vote_rounds ADD COLUMN phase TEXT NOT NULL DEFAULT 'voting'`,
+			`ALTER TABLE watch_groups ADD COLUMN nomination_hours INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE watch_groups ADD COLUMN nominations_per_user INTEGER NOT NULL DEFAULT 2`,
+			`CREATE TABLE nominations (
+				round_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				movie_id INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (round_id, username, movie_id)
+			)`,
+			`CREATE INDEX nominations_movie_id ON nominations (movie_id)`,
+		},
+		Down: []string{
+			`DROP TABLE nominations`,
+			`ALTER TABLE watch_groups DROP COLUMN nominations_per_user`,
+			`ALTER TABLE watch_groups DROP COLUMN nomination_hours`,
+			`ALTER TABLE vote_rounds DROP COLUMN phase`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "named_queues",
+		Up: []string{
+			`CREATE TABLE queues (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				group_id INTEGER NOT NULL,
+				slug TEXT NOT NULL,
+				name TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				UNIQUE (group_id, slug)
+			)`,
+			`CREATE TABLE queue_items (
+				queue_id INTEGER NOT NULL,
+				movie_id INTEGER NOT NULL,
+				position INTEGER NOT NULL,
+				added_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (queue_id, movie_id)
+			)`,
+			`CREATE INDEX queue_items_movie_id ON queue_items (movie_id)`,
+			`ALTER TABLE watch_groups ADD COLUMN winner_queue_id INTEGER NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE watch_groups DROP COLUMN winner_queue_id`,
+			`DROP TABLE queue_items`,
+			`DROP TABLE queues`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "watch_plans",
+		Up: []string{
+			`ALTER TABLE watch_groups ADD COLUMN movie_night TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE watch_plans (
+				movie_id INTEGER PRIMARY KEY,
+				group_id INTEGER NOT NULL,
+				planned_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX watch_plans_group_id ON watch_plans (group_id)`,
+		},
+		Down: []string{
+			`DROP TABLE watch_plans`,
+			`ALTER TABLE watch_groups DROP COLUMN movie_night`,
+		},
+	},
+	{
+		Version: 18,
+		Name:    "watch_sessions",
+		Up: []string{
+			`CREATE TABLE watch_sessions (
+				group_id INTEGER PRIMARY KEY,
+				state TEXT NOT NULL,
+				movie_id INTEGER NOT NULL DEFAULT 0,
+				started_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE watch_sessions`,
+		},
+	},
+}
+
+// LatestVersion returns the version the schema reaches after all migrations.
+func LatestVersion() int {
+	if len(Migrations) == 0 {
+		return 0
+	}
+	return Migrations[len(Migrations)-1].Version
+}
+
+func ensureVersionTable(db *DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for an empty
+// database.
+func SchemaVersion(db *DB) (int, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Migrate applies every pending migration.
+func Migrate(db *DB) error {
+	return MigrateTo(db, LatestVersion())
+}
+
+// MigrateTo moves the schema up or down until it is at the target version.
+// Every migration runs in its own transaction, so a failure leaves the schema
+// at the last version that applied cleanly.
+func MigrateTo(db *DB, target int) error {
+	if target < 0 || target > LatestVersion() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestVersion())
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return fmt.Errorf("database schema version %d is newer than this server (latest is %d)", current, LatestVersion())
+	}
+
+	for _, migration := range Migrations {
+		if migration.Version > current && migration.Version <= target {
+			if err := applyMigration(db, migration, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(Migrations) - 1; i >= 0; i-- {
+		migration := Migrations[i]
+		if migration.Version <= current && migration.Version > target {
+			if err := applyMigration(db, migration, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *DB, migration Migration, up bool) (err error) {
+	statements, direction := migration.statements(db.Dialect, up), "down"
+	if up {
+		direction = "up"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement); err != nil {
+			return fmt.Errorf("migration %d_%s %s: %w", migration.Version, migration.Name, direction, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, migration.Version, migration.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("[DB] Migrated %s: %d_%s", direction, migration.Version, migration.Name))
+	return nil
+}
@@ -1,20 +1,28 @@
 package http
 
 import (
+	"crypto/subtle"
 	"net/http"
 
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/config"
 	"github.com/MonkaKokosowa/watchalong-server/http/routes"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
 	"github.com/MonkaKokosowa/watchalong-server/websocket"
 	"github.com/gorilla/mux"
 )
 
-func NewServer(wsManager *websocket.Manager) *http.Server {
+func NewServer(store api.Store, wsManager *websocket.Manager, cfg config.Config) *http.Server {
 	router := mux.NewRouter()
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Hello, World!"))
 	})
 
-	AddRoutes(router)
+	if cfg.AdminToken == "" {
+		logger.Warning("WATCHALONG_ADMIN_TOKEN is not set, /admin routes are unprotected")
+	}
+
+	AddRoutes(router, store, wsManager, cfg)
 	router.HandleFunc("/ws", wsManager.WsHandler)
 
 	return &http.Server{
@@ -23,18 +31,102 @@ func NewServer(wsManager *websocket.Manager) *http.Server {
 	}
 }
 
-func AddRoutes(router *mux.Router) {
-	router.HandleFunc("/movies", routes.GetMovies)
-	router.HandleFunc("/movies/rate", routes.RateMovie).Methods("POST")
-	router.HandleFunc("/movies/{movie_id}", routes.GetMovie)
-	router.HandleFunc("/add/movie", routes.AddMovie).Methods("POST")
-	router.HandleFunc("/alias", routes.AddAlias).Methods("POST")
-	router.HandleFunc("/alias", routes.GetAliases).Methods("GET")
-	router.HandleFunc("/queue/add", routes.AddMovieToQueue).Methods("POST")
-	router.HandleFunc("/queue/remove", routes.RemoveMovieFromQueue).Methods("POST")
-	router.HandleFunc("/queue", routes.GetQueue).Methods("GET")
+func AddRoutes(router *mux.Router, store api.Store, wsManager *websocket.Manager, cfg config.Config) {
+	handler := routes.NewHandler(store, wsManager, cfg)
+
+	router.HandleFunc("/groups", handler.GetGroups).Methods("GET")
+	router.HandleFunc("/groups/{group}", handler.GetGroup).Methods("GET")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(requireAdminToken(cfg.AdminToken))
+	admin.HandleFunc("/backup", handler.CreateBackup).Methods("POST")
+	admin.HandleFunc("/backups", handler.GetBackups).Methods("GET")
+	admin.HandleFunc("/groups", handler.CreateGroup).Methods("POST")
+	admin.HandleFunc("/groups/{group}", handler.UpdateGroup).Methods("PUT")
+
+	// Unprefixed routes serve the default group.
+	addGroupRoutes(router, admin, handler)
+
+	group := router.PathPrefix("/groups/{group}").Subrouter()
+	group.Use(handler.GroupContext)
+	groupAdmin := group.PathPrefix("/admin").Subrouter()
+	groupAdmin.Use(requireAdminToken(cfg.AdminToken))
+	addGroupRoutes(group, groupAdmin, handler)
+	group.HandleFunc("/ws", handler.ServeWebsocket)
+}
+
+func addGroupRoutes(router *mux.Router, admin *mux.Router, handler *routes.Handler) {
+	voting := &votingRoutes{handler: handler}
+
+	router.HandleFunc("/movies", handler.GetMovies)
+	router.HandleFunc("/movies/rate", handler.RateMovie).Methods("POST")
+	router.HandleFunc("/movies/{movie_id}", handler.DeleteMovie).Methods("DELETE")
+	router.HandleFunc("/movies/{movie_id}", handler.GetMovie)
+	router.HandleFunc("/movies/{movie_id}/ratings", handler.GetMovieRatings).Methods("GET")
+	router.HandleFunc("/movies/{movie_id}/votes", voting.GetMovieVoteStats).Methods("GET")
+	router.HandleFunc("/users/{username}/ratings", handler.GetUserRatings).Methods("GET")
+	router.HandleFunc("/add/movie", handler.AddMovie).Methods("POST")
+	router.HandleFunc("/alias", handler.AddAlias).Methods("POST")
+	router.HandleFunc("/alias", handler.GetAliases).Methods("GET")
+	router.HandleFunc("/queue/add", handler.AddMovieToQueue).Methods("POST")
+	router.HandleFunc("/queue/remove", handler.RemoveMovieFromQueue).Methods("POST")
+	router.HandleFunc("/queue", handler.GetQueue).Methods("GET")
+	router.HandleFunc("/queue", handler.ReorderQueue).Methods("PUT")
+	router.HandleFunc("/queue/move", handler.MoveInQueue).Methods("POST")
+	router.HandleFunc("/queue/swap", handler.SwapInQueue).Methods("POST")
+	router.HandleFunc("/queues", handler.GetQueues).Methods("GET")
+	router.HandleFunc("/queue/plan", handler.PlanMovie).Methods("POST")
+	router.HandleFunc("/schedule", handler.GetSchedule).Methods("GET")
+	router.HandleFunc("/calendar.ics", handler.GetCalendar).Methods("GET")
+	router.HandleFunc("/session", handler.GetSession).Methods("GET")
+	router.HandleFunc("/session/start", handler.StartSession).Methods("POST")
+	router.HandleFunc("/session/watch", handler.WatchSession).Methods("POST")
+	router.HandleFunc("/session/finish", handler.FinishSession).Methods("POST")
+	router.HandleFunc("/session/stop", handler.StopSession).Methods("POST")
+	router.HandleFunc("/trash", handler.GetTrash).Methods("GET")
+	router.HandleFunc("/trash/{movie_id}/restore", handler.RestoreMovie).Methods("POST")
 	router.HandleFunc("/callback", routes.Callback).Methods("GET")
-	router.HandleFunc("/vote", GetCurrentVote).Methods("GET")
-	router.HandleFunc("/vote", CastVote).Methods("POST")
+	router.HandleFunc("/vote", voting.GetCurrentVote).Methods("GET")
+	router.HandleFunc("/vote", voting.CastVote).Methods("POST")
+	router.HandleFunc("/vote/ballot", voting.GetBallot).Methods("GET")
+	router.HandleFunc("/vote/results", voting.GetVoteResults).Methods("GET")
+	router.HandleFunc("/vote/veto", voting.VetoCandidate).Methods("POST")
+	router.HandleFunc("/vote/vetoes", voting.GetVetoesLeft).Methods("GET")
+	router.HandleFunc("/vote/nominations", voting.GetNominations).Methods("GET")
+	router.HandleFunc("/vote/nominate", voting.Nominate).Methods("POST")
+	router.HandleFunc("/vote/rounds", voting.GetVoteRounds).Methods("GET")
+	router.HandleFunc("/vote/rounds/{round_id}", voting.GetVoteRound).Methods("GET")
 
+	admin.HandleFunc("/export", handler.ExportState).Methods("GET")
+	admin.HandleFunc("/import", handler.ImportState).Methods("POST")
+	admin.HandleFunc("/trash/{movie_id}", handler.PurgeMovie).Methods("DELETE")
+	admin.HandleFunc("/movies/merge", handler.MergeMovies).Methods("POST")
+	admin.HandleFunc("/queue/check", handler.CheckQueue).Methods("GET")
+	admin.HandleFunc("/queue/repair", handler.RepairQueue).Methods("POST")
+	admin.HandleFunc("/queues", handler.CreateQueue).Methods("POST")
+	admin.HandleFunc("/queues/{queue}", handler.UpdateQueue).Methods("PUT")
+	admin.HandleFunc("/queues/{queue}", handler.DeleteQueue).Methods("DELETE")
+	admin.HandleFunc("/vote/method", voting.SetVotingMethod).Methods("PUT")
+	admin.HandleFunc("/vote/visibility", voting.SetVoteVisibility).Methods("PUT")
+	admin.HandleFunc("/vote/open", voting.OpenVote).Methods("POST")
+	admin.HandleFunc("/vote/close", voting.CloseVote).Methods("POST")
+	admin.HandleFunc("/vote/cancel", voting.CancelVote).Methods("POST")
+	admin.HandleFunc("/vote/extend", voting.ExtendVote).Methods("POST")
+	admin.HandleFunc("/vote/nominations/open", voting.OpenNominations).Methods("POST")
+	admin.HandleFunc("/vote/nominations/close", voting.CloseNominations).Methods("POST")
+	admin.HandleFunc("/audit", handler.GetAuditLog).Methods("GET")
+}
+
+// requireAdminToken rejects requests without "Authorization: Bearer <token>".
+// An empty token leaves the routes open.
+func requireAdminToken(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
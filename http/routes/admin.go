@@ -0,0 +1,236 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/backup"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+func (h *Handler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	source, err := backup.SourceFor(h.Store)
+	if err != nil {
+		logger.Error("Failed to create backup", err)
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	path, err := backup.Create(source, h.Config.BackupDir)
+	if err != nil {
+		logger.Error("Failed to create backup", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		logger.Error("Failed to stat backup", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(backup.Info{Name: filepath.Base(path), Size: stat.Size(), CreatedAt: stat.ModTime().UTC()})
+}
+
+func (h *Handler) GetBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := backup.List(h.Config.BackupDir)
+	if err != nil {
+		logger.Error("Failed to list backups", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(backups)
+	if err != nil {
+		logger.Error("Failed to marshal backups", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func (h *Handler) ExportState(w http.ResponseWriter, r *http.Request) {
+	export, err := api.ExportState(h.GroupStore(r))
+	if err != nil {
+		logger.Error("Failed to export state", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	jsonBytes, err := json.Marshal(export)
+	if err != nil {
+		logger.Error("Failed to marshal export", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="watchalong-export.json"`)
+	w.Write(jsonBytes)
+}
+
+// ImportState loads an export document. The mode query parameter selects
+// replace or merge and defaults to merge, which never drops existing data.
+func (h *Handler) ImportState(w http.ResponseWriter, r *http.Request) {
+	mode := api.ImportMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = api.ImportMerge
+	}
+
+	var export api.StateExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		logger.Error("Failed to decode export", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	report, err := api.ImportState(h.storeFor(r, ""), &export, mode)
+	if errors.Is(err, api.ErrInvalidExport) {
+		logger.Error("Rejected import", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to import state", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) CheckQueue(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.selectQueue(w, r, h.GroupStore(r))
+	if !ok {
+		return
+	}
+	report, err := store.CheckQueue()
+	if err != nil {
+		logger.Error("Failed to check queue", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) RepairQueue(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.selectQueue(w, r, h.storeFor(r, ""))
+	if !ok {
+		return
+	}
+	report, err := store.RepairQueue()
+	if err != nil {
+		logger.Error("Failed to repair queue", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if report.Repaired {
+		h.UpdateClients(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) MergeMovies(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		CanonicalID int `json:"canonical_id"`
+		DuplicateID int `json:"duplicate_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode merge request", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	store := h.storeFor(r, "")
+	if err := store.MergeMovies(body.CanonicalID, body.DuplicateID); err != nil {
+		logger.Error("Failed to merge movies", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	movie, err := store.GetMovie(body.CanonicalID)
+	if err != nil {
+		logger.Error("Failed to get merged movie", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	h.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movie)
+}
+
+const maxAuditLimit = 500
+
+// GetAuditLog lists audit entries newest first. Query parameters actor,
+// action and movie_id filter exactly, since and until take RFC 3339 times,
+// and limit and offset page through the results.
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := api.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Limit:  api.DefaultAuditLimit,
+	}
+
+	var err error
+	parseInt := func(name string, dest *int) {
+		if value := query.Get(name); value != "" && err == nil {
+			if *dest, err = strconv.Atoi(value); err == nil && *dest < 0 {
+				err = fmt.Errorf("%s must not be negative", name)
+			}
+		}
+	}
+	parseTime := func(name string, dest *time.Time) {
+		if value := query.Get(name); value != "" && err == nil {
+			*dest, err = time.Parse(time.RFC3339, value)
+		}
+	}
+	parseInt("movie_id", &filter.MovieID)
+	parseInt("limit", &filter.Limit)
+	parseInt("offset", &filter.Offset)
+	parseTime("since", &filter.Since)
+	parseTime("until", &filter.Until)
+	if err != nil {
+		logger.Error("Failed to parse audit log filter", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	entries, err := h.GroupStore(r).GetAuditLog(filter)
+	if err != nil {
+		logger.Error("Failed to get audit log", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(entries)
+	if err != nil {
+		logger.Error("Failed to marshal audit log", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+// tmdbImageBase completes poster paths stored without a host.
+const tmdbImageBase = "https://image.tmdb.org/t/p/original"
+
+// watchLength is how long a calendar event blocks for a movie or an episode
+// night.
+const watchLength = 2 * time.Hour
+
+func (h *Handler) AnnounceSchedule(r *http.Request) {
+	h.WsManager.BroadcastSchedule(h.GroupStore(r))
+}
+
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := api.WatchSchedule(h.GroupStore(r), time.Now())
+	if err != nil {
+		logger.Error("Failed to get watch schedule", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// PlanMovie sets when a queued movie is watched; a missing planned_at
+// clears the plan so the movie night dates it again.
+func (h *Handler) PlanMovie(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID        int        `json:"id"`
+		PlannedAt *time.Time `json:"planned_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode watch plan", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var at time.Time
+	if body.PlannedAt != nil {
+		at = *body.PlannedAt
+	}
+
+	if err := h.storeFor(r, "").PlanMovie(body.ID, at); err != nil {
+		logger.Error("Failed to plan movie", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	h.AnnounceSchedule(r)
+	h.GetSchedule(w, r)
+}
+
+func (h *Handler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	store := h.GroupStore(r)
+	schedule, err := api.WatchSchedule(store, time.Now())
+	if err != nil {
+		logger.Error("Failed to get watch schedule", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(calendar(store.GroupID(), schedule, time.Now())))
+}
+
+func calendar(groupID int, schedule []api.ScheduledMovie, now time.Time) string {
+	const stamp = "20060102T150405Z"
+	var lines []string
+	lines = append(lines, "BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//watchalong//watchalong-server//EN", "CALSCALE:GREGORIAN")
+	for _, movie := range schedule {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:movie-%d-group-%d@watchalong", movie.ID, groupID),
+			"DTSTAMP:"+now.UTC().Format(stamp),
+			"DTSTART:"+movie.PlannedAt.UTC().Format(stamp),
+			"DTEND:"+movie.PlannedAt.Add(watchLength).UTC().Format(stamp),
+			"SUMMARY:"+escapeText(movie.Name),
+		)
+		description := fmt.Sprintf("#%d in the queue", movie.QueuePosition.Int64)
+		if movie.ProposedBy != "" {
+			description += ", proposed by " + movie.ProposedBy
+		}
+		if poster := posterURL(movie.TmdbImageUrl); poster != "" {
+			description += "\nPoster: " + poster
+			lines = append(lines, "URL:"+poster, "ATTACH;FMTTYPE=image/jpeg:"+poster)
+		}
+		lines = append(lines, "DESCRIPTION:"+escapeText(description), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+func posterURL(image string) string {
+	if strings.HasPrefix(image, "/") {
+		return tmdbImageBase + image
+	}
+	return image
+}
+
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// foldLine splits a content line into 75-octet pieces, continuing each on a
+// line that starts with a space, without breaking UTF-8 sequences.
+func foldLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+	"github.com/gorilla/mux"
+)
+
+type groupContextKey struct{}
+
+// GroupContext resolves the {group} route variable and scopes the rest of the
+// request to that group.
+func (h *Handler) GroupContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group, err := h.Store.GetGroup(mux.Vars(r)["group"])
+		if err != nil {
+			logger.Error("Failed to get group", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), groupContextKey{}, group.ID)))
+	})
+}
+
+// GroupStore returns the Store scoped to the request's group, or to the
+// default group outside /groups/{group}.
+func (h *Handler) GroupStore(r *http.Request) api.Store {
+	if groupID, ok := r.Context().Value(groupContextKey{}).(int); ok {
+		return h.Store.ForGroup(groupID)
+	}
+	return h.Store
+}
+
+func (h *Handler) ServeWebsocket(w http.ResponseWriter, r *http.Request) {
+	h.WsManager.Serve(w, r, h.GroupStore(r).GroupID())
+}
+
+func (h *Handler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.Store.GetGroups()
+	if err != nil {
+		logger.Error("Failed to get groups", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(groups)
+	if err != nil {
+		logger.Error("Failed to marshal groups", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.Store.GetGroup(mux.Vars(r)["group"])
+	if err != nil {
+		logger.Error("Failed to get group", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	// The limits are pointers so that a group can start out with 0.
+	var body struct {
+		api.Group
+		VetoesPerMonth     *int `json:"vetoes_per_month"`
+		NominationsPerUser *int `json:"nominations_per_user"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode group", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	group := body.Group
+	group.VetoesPerMonth = api.DefaultVetoesPerMonth
+	if body.VetoesPerMonth != nil {
+		group.VetoesPerMonth = *body.VetoesPerMonth
+	}
+	group.NominationsPerUser = api.DefaultNominationsPerUser
+	if body.NominationsPerUser != nil {
+		group.NominationsPerUser = *body.NominationsPerUser
+	}
+	if err := group.Validate(); err != nil {
+		logger.Error("Rejected group", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The group owns no named queues until it exists, so any winner queue
+	// belongs to another group.
+	if group.WinnerQueueID != 0 {
+		http.Error(w, fmt.Sprintf("unknown winner queue %d", group.WinnerQueueID), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := api.WithAudit(h.Store, Actor(r)).CreateGroup(&group); err != nil {
+		logger.Error("Failed to create group", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(group)
+}
+
+// UpdateGroup changes a group's settings; fields left out keep their value.
+// The scheduler picks up a new schedule within a minute.
+func (h *Handler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.Store.GetGroup(mux.Vars(r)["group"])
+	if err != nil {
+		logger.Error("Failed to get group", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	var body struct {
+		Name               string  `json:"name"`
+		VoteSchedule       string  `json:"vote_schedule"`
+		VotingMethod       string  `json:"voting_method"`
+		CandidateStrategy  string  `json:"candidate_strategy"`
+		CandidateCount     *int    `json:"candidate_count"`
+		RetireAfter        *int    `json:"retire_after"`
+		TieBreak           string  `json:"tie_break"`
+		QueueWinners       *int    `json:"queue_winners"`
+		Quorum             *int    `json:"quorum"`
+		Visibility         string  `json:"visibility"`
+		VetoesPerMonth     *int    `json:"vetoes_per_month"`
+		NominationHours    *int    `json:"nomination_hours"`
+		NominationsPerUser *int    `json:"nominations_per_user"`
+		WinnerQueueID      *int    `json:"winner_queue_id"`
+		MovieNight         *string `json:"movie_night"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode group", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if body.Name != "" {
+		group.Name = body.Name
+	}
+	if body.VoteSchedule != "" {
+		group.VoteSchedule = body.VoteSchedule
+	}
+	if body.VotingMethod != "" {
+		group.VotingMethod = body.VotingMethod
+	}
+	if body.CandidateStrategy != "" {
+		group.CandidateStrategy = body.CandidateStrategy
+	}
+	if body.CandidateCount != nil {
+		group.CandidateCount = *body.CandidateCount
+	}
+	if body.RetireAfter != nil {
+		group.RetireAfter = *body.RetireAfter
+	}
+	if body.TieBreak != "" {
+		group.TieBreak = body.TieBreak
+	}
+	if body.QueueWinners != nil {
+		group.QueueWinners = *body.QueueWinners
+	}
+	if body.Quorum != nil {
+		group.Quorum = *body.Quorum
+	}
+	if body.Visibility != "" {
+		group.Visibility = body.Visibility
+	}
+	if body.VetoesPerMonth != nil {
+		group.VetoesPerMonth = *body.VetoesPerMonth
+	}
+	if body.NominationHours != nil {
+		group.NominationHours = *body.NominationHours
+	}
+	if body.NominationsPerUser != nil {
+		group.NominationsPerUser = *body.NominationsPerUser
+	}
+	if body.WinnerQueueID != nil {
+		group.WinnerQueueID = *body.WinnerQueueID
+	}
+	rescheduled := body.MovieNight != nil && *body.MovieNight != group.MovieNight
+	if body.MovieNight != nil {
+		group.MovieNight = *body.MovieNight
+	}
+	if err := group.Validate(); err != nil {
+		logger.Error("Rejected group", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if group.WinnerQueueID != 0 && !h.hasQueue(h.Store.ForGroup(group.ID), group.WinnerQueueID) {
+		http.Error(w, fmt.Sprintf("unknown winner queue %d", group.WinnerQueueID), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.WithAudit(h.Store, Actor(r)).UpdateGroup(&group); err != nil {
+		logger.Error("Failed to update group", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	if rescheduled {
+		h.WsManager.BroadcastSchedule(h.Store.ForGroup(group.ID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+	"github.com/gorilla/mux"
+)
+
+// selectQueue scopes store to the queue named by the request's "queue" query
+// parameter, the main queue when it is missing. It answers 404 for a queue
+// the group does not have and reports whether the request can go on.
+func (h *Handler) selectQueue(w http.ResponseWriter, r *http.Request, store api.Store) (api.Store, bool) {
+	store, err := api.QueueStore(store, r.URL.Query().Get("queue"))
+	if err != nil {
+		logger.Error("Failed to get queue", err)
+		w.WriteHeader(errorStatus(err))
+		return nil, false
+	}
+	return store, true
+}
+
+func (h *Handler) hasQueue(store api.Store, queueID int) bool {
+	queues, err := store.GetQueues()
+	if err != nil {
+		logger.Error("Failed to get queues", err)
+		return false
+	}
+	for _, queue := range queues {
+		if queue.ID == queueID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) GetQueues(w http.ResponseWriter, r *http.Request) {
+	queues, err := h.GroupStore(r).GetQueues()
+	if err != nil {
+		logger.Error("Failed to get queues", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queues)
+}
+
+func (h *Handler) CreateQueue(w http.ResponseWriter, r *http.Request) {
+	var queue api.NamedQueue
+	if err := json.NewDecoder(r.Body).Decode(&queue); err != nil {
+		logger.Error("Failed to decode queue", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := queue.Validate(); err != nil {
+		logger.Error("Rejected queue", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.storeFor(r, "").CreateQueue(&queue); err != nil {
+		logger.Error("Failed to create queue", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(queue)
+}
+
+func (h *Handler) UpdateQueue(w http.ResponseWriter, r *http.Request) {
+	store := h.storeFor(r, "")
+	queue, err := store.GetNamedQueue(mux.Vars(r)["queue"])
+	if err != nil {
+		logger.Error("Failed to get queue", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	var body struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode queue", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if body.Slug != "" {
+		queue.Slug = body.Slug
+	}
+	if body.Name != "" {
+		queue.Name = body.Name
+	}
+	if err := queue.Validate(); err != nil {
+		logger.Error("Rejected queue", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := store.UpdateQueue(&queue); err != nil {
+		logger.Error("Failed to update queue", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue)
+}
+
+func (h *Handler) DeleteQueue(w http.ResponseWriter, r *http.Request) {
+	store := h.storeFor(r, "")
+	queue, err := store.GetNamedQueue(mux.Vars(r)["queue"])
+	if err != nil {
+		logger.Error("Failed to get queue", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	if err := store.DeleteQueue(queue.ID); err != nil {
+		logger.Error("Failed to delete queue", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,47 +2,98 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/config"
 	"github.com/MonkaKokosowa/watchalong-server/logger"
 	"github.com/MonkaKokosowa/watchalong-server/websocket"
 	"github.com/gorilla/mux"
 )
 
-func UpdateClients() {
-	movies, err := api.GetMovies()
-	if err != nil {
-		movies = []api.Movie{}
-	}
-	queue, err := api.GetQueue()
-	if err != nil {
-		queue = []api.Movie{}
-	}
-	if queue == nil {
-		queue = []api.Movie{}
+// Handler serves the REST routes on top of a Store and notifies websocket
+// clients after every change. Store is scoped to the default group; routes
+// under /groups/{group} go through GroupContext and use GroupStore instead.
+type Handler struct {
+	Store     api.Store
+	WsManager *websocket.Manager
+	Config    config.Config
+}
+
+func NewHandler(store api.Store, wsManager *websocket.Manager, cfg config.Config) *Handler {
+	return &Handler{Store: store, WsManager: wsManager, Config: cfg}
+}
+
+// ActorHeader names the user making a request. The API has no accounts, so
+// clients send the username they are logged in with.
+const ActorHeader = "X-Watchalong-User"
+
+func Actor(r *http.Request) string {
+	return r.Header.Get(ActorHeader)
+}
+
+// storeFor returns the Store to mutate on behalf of r, recording every change
+// in the audit log. fallback is used as the actor when the request does not
+// name one, e.g. the username of a rating.
+func (h *Handler) storeFor(r *http.Request, fallback string) api.Store {
+	actor := Actor(r)
+	if actor == "" {
+		actor = fallback
 	}
-	if movies == nil {
-		movies = []api.Movie{}
+	return api.WithAudit(h.GroupStore(r), actor)
+}
+
+func (h *Handler) UpdateClients(r *http.Request) {
+	h.WsManager.BroadcastUpdates(h.GroupStore(r))
+}
+
+func (h *Handler) AnnounceVeto(r *http.Request, veto api.Veto) {
+	h.WsManager.BroadcastVeto(h.GroupStore(r), veto)
+}
+
+func (h *Handler) AnnouncePhase(r *http.Request, round api.VoteRound) {
+	h.WsManager.BroadcastPhase(h.GroupStore(r), round)
+}
+
+func (h *Handler) AnnounceNomination(r *http.Request, nomination api.Nomination) {
+	h.WsManager.BroadcastNomination(h.GroupStore(r), nomination)
+}
+
+func (h *Handler) RevealVote(r *http.Request, round api.VoteRound) {
+	h.WsManager.BroadcastReveal(h.GroupStore(r), round)
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, api.ErrNotFound) {
+		return http.StatusNotFound
 	}
-	aliases, err := api.GetAliases()
-	if err != nil {
-		aliases = []api.Alias{}
+	if errors.Is(err, api.ErrConflict) || errors.Is(err, api.ErrInvalidSession) {
+		return http.StatusConflict
 	}
-	vote, err := api.GetCurrentVote()
-	if err != nil {
-		vote = []api.Movie{}
+	if errors.Is(err, api.ErrInvalidQueueOrder) {
+		return http.StatusBadRequest
 	}
-	if vote == nil {
-		vote = []api.Movie{}
+	return http.StatusInternalServerError
+}
+
+// writeDuplicate answers 409 with the id of the existing movie when err is a
+// *api.DuplicateMovieError, and reports whether it did.
+func writeDuplicate(w http.ResponseWriter, err error) bool {
+	var duplicate *api.DuplicateMovieError
+	if !errors.As(err, &duplicate) {
+		return false
 	}
-	websocket.WsManager.BroadcastUpdates(movies, queue, aliases, vote)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	w.Write([]byte(fmt.Sprintf(`{"existing_id": %d}`, duplicate.ExistingID)))
+	return true
 }
 
-func GetMovies(w http.ResponseWriter, r *http.Request) {
-	movies, err := api.GetMovies()
+func (h *Handler) GetMovies(w http.ResponseWriter, r *http.Request) {
+	movies, err := h.GroupStore(r).GetMovies()
 	if err != nil {
 		logger.Error("Failed to get movies", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -60,7 +111,7 @@ func GetMovies(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
-func GetMovie(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetMovie(w http.ResponseWriter, r *http.Request) {
 	movie_id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
 
 	if err != nil {
@@ -69,10 +120,10 @@ func GetMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	retrievedMovie, err := api.GetMovie(movie_id)
+	retrievedMovie, err := h.GroupStore(r).GetMovie(movie_id)
 	if err != nil {
 		logger.Error("Failed to get movie", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		return
 	}
 
@@ -80,7 +131,7 @@ func GetMovie(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(retrievedMovie.ToJSON()))
 }
 
-func AddMovie(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AddMovie(w http.ResponseWriter, r *http.Request) {
 	var newMovie api.Movie
 	if err := json.NewDecoder(r.Body).Decode(&newMovie); err != nil {
 		logger.Error("Failed to decode movie", err)
@@ -88,7 +139,10 @@ func AddMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := newMovie.AddMovie()
+	id, err := h.storeFor(r, newMovie.ProposedBy).AddMovie(&newMovie)
+	if writeDuplicate(w, err) {
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to add movie", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -97,10 +151,10 @@ func AddMovie(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(fmt.Sprintf(`{"id": %d}`, id)))
-	UpdateClients()
+	h.UpdateClients(r)
 }
 
-func RateMovie(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RateMovie(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		MovieID  int    `json:"movieID"`
 		Rating   int    `json:"rating"`
@@ -112,16 +166,61 @@ func RateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := api.RateMovie(body.MovieID, body.Username, float64(body.Rating)); err != nil {
+	if err := h.storeFor(r, body.Username).RateMovie(body.MovieID, body.Username, float64(body.Rating)); err != nil {
 		logger.Error("Failed to rate movie", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-	UpdateClients()
+	h.UpdateClients(r)
 	w.WriteHeader(http.StatusOK)
 }
 
-func AddAlias(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetMovieRatings(w http.ResponseWriter, r *http.Request) {
+	movie_id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
+	if err != nil {
+		logger.Error("Failed to parse movie ID", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ratings, err := h.GroupStore(r).GetMovieRatings(movie_id)
+	if err != nil {
+		logger.Error("Failed to get movie ratings", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	jsonBytes, err := json.Marshal(ratings)
+	if err != nil {
+		logger.Error("Failed to marshal ratings", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func (h *Handler) GetUserRatings(w http.ResponseWriter, r *http.Request) {
+	ratings, err := h.GroupStore(r).GetUserRatings(mux.Vars(r)["username"])
+	if err != nil {
+		logger.Error("Failed to get user ratings", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(ratings)
+	if err != nil {
+		logger.Error("Failed to marshal ratings", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func (h *Handler) AddAlias(w http.ResponseWriter, r *http.Request) {
 	var newAlias api.Alias
 	if err := json.NewDecoder(r.Body).Decode(&newAlias); err != nil {
 		logger.Error("Failed to decode alias", err)
@@ -129,7 +228,7 @@ func AddAlias(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := newAlias.AddAlias(); err != nil {
+	if err := h.storeFor(r, newAlias.Username).AddAlias(&newAlias); err != nil {
 		logger.Error("Failed to add alias", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -138,8 +237,8 @@ func AddAlias(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func GetAliases(w http.ResponseWriter, r *http.Request) {
-	aliases, err := api.GetAliases()
+func (h *Handler) GetAliases(w http.ResponseWriter, r *http.Request) {
+	aliases, err := h.GroupStore(r).GetAliases()
 	if err != nil {
 		logger.Error("Failed to get aliases", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -157,7 +256,7 @@ func GetAliases(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
-func AddMovieToQueue(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AddMovieToQueue(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		ID int `json:"id"`
 	}
@@ -167,23 +266,20 @@ func AddMovieToQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	retrievedMovie, err := api.GetMovie(body.ID)
-	if err != nil {
-		logger.Error("Failed to get movie", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	store, ok := h.selectQueue(w, r, h.storeFor(r, ""))
+	if !ok {
 		return
 	}
-
-	if err := retrievedMovie.AddMovieToQueue(); err != nil {
+	if err := store.AddMovieToQueue(body.ID); err != nil {
 		logger.Error("Failed to add movie to queue", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-	UpdateClients()
+	h.UpdateClients(r)
 	w.WriteHeader(http.StatusOK)
 }
 
-func RemoveMovieFromQueue(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RemoveMovieFromQueue(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		ID      int  `json:"id"`
 		Watched bool `json:"watched"`
@@ -193,20 +289,17 @@ func RemoveMovieFromQueue(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	movie, err := api.GetMovie(body.ID)
-
-	if err != nil {
-		logger.Error("Failed to get movie", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	store, ok := h.selectQueue(w, r, h.storeFor(r, ""))
+	if !ok {
 		return
 	}
-	if err := movie.RemoveMovieFromQueue(); err != nil {
+	if err := store.RemoveMovieFromQueue(body.ID); err != nil {
 		logger.Error("Failed to remove movie from queue", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		return
 	}
 	if body.Watched {
-		err := movie.FinishMovie()
+		err := store.FinishMovie(body.ID)
 		if err != nil {
 			logger.Error("Failed to mark movie as watched", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -214,12 +307,70 @@ func RemoveMovieFromQueue(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	UpdateClients()
+	h.UpdateClients(r)
 	w.WriteHeader(http.StatusOK)
 }
 
-func GetQueue(w http.ResponseWriter, r *http.Request) {
-	queue, err := api.GetQueue()
+func (h *Handler) MoveInQueue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID       int `json:"id"`
+		Position int `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode queue move", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.reorderQueue(w, r, func(store api.Store) error { return store.MoveInQueue(body.ID, body.Position) })
+}
+
+func (h *Handler) SwapInQueue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID      int `json:"id"`
+		OtherID int `json:"other_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode queue swap", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.reorderQueue(w, r, func(store api.Store) error { return store.SwapInQueue(body.ID, body.OtherID) })
+}
+
+func (h *Handler) ReorderQueue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error("Failed to decode queue order", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.reorderQueue(w, r, func(store api.Store) error { return store.ReorderQueue(body.IDs) })
+}
+
+// reorderQueue applies reorder to the request's queue and answers with the
+// new queue, which is also broadcast to the websocket clients.
+func (h *Handler) reorderQueue(w http.ResponseWriter, r *http.Request, reorder func(store api.Store) error) {
+	store, ok := h.selectQueue(w, r, h.storeFor(r, ""))
+	if !ok {
+		return
+	}
+	if err := reorder(store); err != nil {
+		logger.Error("Failed to reorder queue", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	h.UpdateClients(r)
+	h.GetQueue(w, r)
+}
+
+func (h *Handler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.selectQueue(w, r, h.GroupStore(r))
+	if !ok {
+		return
+	}
+	queue, err := store.GetQueue()
 	if err != nil {
 		logger.Error("Failed to get queue", err)
 		w.WriteHeader(http.StatusInternalServerError)
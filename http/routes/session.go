@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+)
+
+func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
+	session, err := api.CurrentSession(h.GroupStore(r))
+	if err != nil {
+		logger.Error("Failed to get watch session", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// StartSession starts movie_id, or the first movie of the queue when the
+// body leaves it out.
+func (h *Handler) StartSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MovieID int `json:"movie_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logger.Error("Failed to decode session start", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	h.changeSession(w, r, func(store api.Store, actor string) (api.Session, error) {
+		return api.StartSession(store, actor, body.MovieID)
+	})
+}
+
+func (h *Handler) WatchSession(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, api.WatchSession)
+}
+
+func (h *Handler) FinishSession(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, api.FinishSession)
+}
+
+func (h *Handler) StopSession(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, api.StopSession)
+}
+
+// changeSession applies change to the request's group, broadcasts the new
+// session and answers with it. Finishing a movie also sends the new queue.
+func (h *Handler) changeSession(w http.ResponseWriter, r *http.Request, change func(store api.Store, actor string) (api.Session, error)) {
+	session, err := change(h.storeFor(r, ""), Actor(r))
+	if err != nil {
+		logger.Error("Failed to change watch session", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	h.WsManager.BroadcastSession(h.GroupStore(r), session)
+	if session.State == api.SessionFinished {
+		h.UpdateClients(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/MonkaKokosowa/watchalong-server/logger"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) DeleteMovie(w http.ResponseWriter, r *http.Request) {
+	movie_id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
+	if err != nil {
+		logger.Error("Failed to parse movie ID", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storeFor(r, "").DeleteMovie(movie_id, Actor(r)); err != nil {
+		logger.Error("Failed to delete movie", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	h.UpdateClients(r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.GroupStore(r).GetTrash()
+	if err != nil {
+		logger.Error("Failed to get trash", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(trash)
+	if err != nil {
+		logger.Error("Failed to marshal trash", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func (h *Handler) RestoreMovie(w http.ResponseWriter, r *http.Request) {
+	movie_id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
+	if err != nil {
+		logger.Error("Failed to parse movie ID", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.storeFor(r, "").RestoreMovie(movie_id)
+	if writeDuplicate(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to restore movie", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	h.UpdateClients(r)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) PurgeMovie(w http.ResponseWriter, r *http.Request) {
+	movie_id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
+	if err != nil {
+		logger.Error("Failed to parse movie ID", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storeFor(r, "").PurgeMovie(movie_id); err != nil {
+		logger.Error("Failed to purge movie", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -2,19 +2,31 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/http/routes"
 	"github.com/MonkaKokosowa/watchalong-server/logger"
+	"github.com/gorilla/mux"
 )
 
 type Vote struct {
 	MovieIDs []int `json:"movie_ids"`
+	// Username identifies the voter when the request has no
+	// X-Watchalong-User header.
+	Username string `json:"username"`
 }
 
-func GetCurrentVote(w http.ResponseWriter, r *http.Request) {
+type votingRoutes struct {
+	handler *routes.Handler
+}
+
+func (v *votingRoutes) GetCurrentVote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	movies, err := api.GetCurrentVote()
+	movies, err := v.handler.GroupStore(r).GetCurrentVote()
 	if err != nil {
 		logger.Error("Error getting current vote: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -23,19 +35,510 @@ func GetCurrentVote(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(movies)
 }
 
-func CastVote(w http.ResponseWriter, r *http.Request) {
+func (v *votingRoutes) CastVote(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var v Vote
-	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+	var vote Vote
+	if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := api.CastVote(v.MovieIDs); err != nil {
+	username := routes.Actor(r)
+	if username == "" {
+		username = vote.Username
+	}
+	if username == "" {
+		http.Error(w, "a ballot needs a username", http.StatusBadRequest)
+		return
+	}
+
+	store := v.handler.GroupStore(r)
+	err := api.WithAudit(store, username).CastVote(username, vote.MovieIDs)
+	if errors.Is(err, api.ErrInvalidBallot) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no vote is open", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		logger.Error("Error casting vote: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The last registered voter closes the round early.
+	if round, closed, err := api.CloseIfComplete(store, username); err != nil {
+		logger.Error("Error closing completed vote: ", err)
+	} else if closed {
+		v.handler.RevealVote(r, round)
+	}
+	v.handler.UpdateClients(r)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetBallot returns a ballot in the open round: the caller's, named by the
+// X-Watchalong-User header, or the one of the username query parameter. Other
+// users' ballots stay secret until the round is revealed.
+func (v *votingRoutes) GetBallot(w http.ResponseWriter, r *http.Request) {
+	actor := routes.Actor(r)
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		username = actor
+	}
+	if username == "" {
+		http.Error(w, "a username is required", http.StatusBadRequest)
+		return
+	}
+
+	store := v.handler.GroupStore(r)
+	if username != actor {
+		round, err := store.GetCurrentVoteRound()
+		if errors.Is(err, api.ErrNotFound) {
+			http.Error(w, "no vote is open", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Error getting current vote round: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !round.Revealed() {
+			http.Error(w, "ballots are secret until the vote is revealed", http.StatusForbidden)
+			return
+		}
+	}
+
+	ballot, err := store.GetBallot(username)
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no ballot cast", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Error getting ballot: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ballot)
+}
+
+func (v *votingRoutes) VetoCandidate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MovieID  int    `json:"movie_id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := routes.Actor(r)
+	if username == "" {
+		username = body.Username
+	}
+	if username == "" {
+		http.Error(w, "a veto needs a username", http.StatusBadRequest)
+		return
+	}
+
+	veto, err := api.VetoCandidate(api.WithAudit(v.handler.GroupStore(r), username), username, body.MovieID)
+	if errors.Is(err, api.ErrNoVetoesLeft) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.AnnounceVeto(r, veto)
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(veto)
+}
+
+func (v *votingRoutes) Nominate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MovieID  int    `json:"movie_id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := routes.Actor(r)
+	if username == "" {
+		username = body.Username
+	}
+	if username == "" {
+		http.Error(w, "a nomination needs a username", http.StatusBadRequest)
+		return
+	}
+
+	store := api.WithAudit(v.handler.GroupStore(r), username)
+	err := store.Nominate(username, body.MovieID)
+	if errors.Is(err, api.ErrNotNominating) || errors.Is(err, api.ErrNominationLimit) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	nominations, err := store.GetNominations()
+	if err != nil {
+		logger.Error("Error getting nominations: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nomination := api.Nomination{MovieID: body.MovieID, Username: username}
+	for _, candidate := range nominations {
+		if candidate.MovieID == body.MovieID && candidate.Username == username {
+			nomination = candidate
+		}
+	}
+	v.handler.AnnounceNomination(r, nomination)
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nomination)
+}
+
+func (v *votingRoutes) GetNominations(w http.ResponseWriter, r *http.Request) {
+	nominations, err := v.handler.GroupStore(r).GetNominations()
+	if err != nil {
+		logger.Error("Error getting nominations: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nominations)
+}
+
+// GetVetoesLeft tells the caller, named like in GetBallot, how many vetoes
+// they can still spend this month.
+func (v *votingRoutes) GetVetoesLeft(w http.ResponseWriter, r *http.Request) {
+	username := routes.Actor(r)
+	if username == "" {
+		username = r.URL.Query().Get("username")
+	}
+	if username == "" {
+		http.Error(w, "a username is required", http.StatusBadRequest)
+		return
+	}
+
+	left, err := api.VetoesLeft(v.handler.GroupStore(r), username)
+	if err != nil {
+		logger.Error("Error counting vetoes: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		VetoesLeft int `json:"vetoes_left"`
+	}{left})
+}
+
+// GetVoteResults ranks the candidates of the open round by its voting method
+// and reports the ties its tie-break policy settled. Hidden rounds only name
+// who has voted and sealed rounds show nothing until they close.
+func (v *votingRoutes) GetVoteResults(w http.ResponseWriter, r *http.Request) {
+	store := v.handler.GroupStore(r)
+	round, err := store.GetCurrentVoteRound()
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no vote is open", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Error getting vote round: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := struct {
+		VotingMethod string          `json:"voting_method"`
+		Visibility   string          `json:"visibility"`
+		TieBreak     string          `json:"tie_break"`
+		TieSeed      int64           `json:"tie_seed"`
+		Results      []api.Movie     `json:"results"`
+		Tallies      []api.VoteTally `json:"tallies"`
+		Ties         [][]int         `json:"ties"`
+		// Voters is only filled in for hidden rounds, whose standings
+		// stay null until they close.
+		Voters []string `json:"voters,omitempty"`
+	}{VotingMethod: round.VotingMethod, Visibility: round.Visibility, TieBreak: round.TieBreak, TieSeed: round.TieSeed}
+
+	switch round.Visibility {
+	case api.VisibilityOpen:
+		if response.Results, err = store.GetVoteResults(); err != nil {
+			logger.Error("Error getting vote results: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if response.Tallies, err = store.GetVoteTallies(); err != nil {
+			logger.Error("Error getting vote tallies: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Ties = round.Ties()
+	case api.VisibilityHidden:
+		participation, err := api.GetParticipation(store)
+		if err != nil {
+			logger.Error("Error getting vote participation: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Voters = participation.Voters
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (v *votingRoutes) SetVotingMethod(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		VotingMethod string `json:"voting_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := api.WithAudit(v.handler.GroupStore(r), routes.Actor(r)).SetVotingMethod(body.VotingMethod)
+	if errors.Is(err, api.ErrUnknownVotingMethod) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no vote is open", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Error setting voting method: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
+
+func (v *votingRoutes) SetVoteVisibility(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := api.WithAudit(v.handler.GroupStore(r), routes.Actor(r)).SetVoteVisibility(body.Visibility)
+	if errors.Is(err, api.ErrUnknownVisibility) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no vote is open", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Error setting vote visibility: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	v.handler.UpdateClients(r)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (v *votingRoutes) GetVoteRounds(w http.ResponseWriter, r *http.Request) {
+	rounds, err := v.handler.GroupStore(r).GetVoteRounds()
+	if err != nil {
+		logger.Error("Error getting vote rounds: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range rounds {
+		rounds[i] = rounds[i].Concealed()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rounds)
+}
+
+func (v *votingRoutes) GetVoteRound(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["round_id"])
+	if err != nil {
+		http.Error(w, "invalid round id", http.StatusBadRequest)
+		return
+	}
+
+	round, err := v.handler.GroupStore(r).GetVoteRound(id)
+	if errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no such vote round", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Error getting vote round: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(round.Concealed())
+}
+
+func (v *votingRoutes) GetMovieVoteStats(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["movie_id"])
+	if err != nil {
+		http.Error(w, "invalid movie id", http.StatusBadRequest)
+		return
+	}
+
+	store := v.handler.GroupStore(r)
+	if _, err := store.GetMovie(id); errors.Is(err, api.ErrNotFound) {
+		http.Error(w, "no such movie", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("Error getting movie: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := store.GetMovieVoteStats(id)
+	if err != nil {
+		logger.Error("Error getting movie vote stats: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func writeVoteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, api.ErrInvalidVote):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, api.ErrNotFound):
+		http.Error(w, "no vote is open", http.StatusNotFound)
+	case errors.Is(err, api.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.Error("Error changing vote: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// OpenVote opens a round on the given candidates, or on random ones when
+// movie_ids is empty. Without closes_at the round runs until the group's
+// next scheduled vote.
+func (v *votingRoutes) OpenVote(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MovieIDs []int     `json:"movie_ids"`
+		ClosesAt time.Time `json:"closes_at"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	round, err := api.OpenVote(v.handler.GroupStore(r), routes.Actor(r), body.MovieIDs, body.ClosesAt)
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(round.Concealed())
+}
+
+// OpenNominations opens a round in the nominating phase. Without closes_at
+// nominations run for the group's nomination_hours.
+func (v *votingRoutes) OpenNominations(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ClosesAt time.Time `json:"closes_at"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	round, err := api.OpenNominations(v.handler.GroupStore(r), routes.Actor(r), body.ClosesAt)
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.AnnouncePhase(r, round)
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(round)
+}
+
+func (v *votingRoutes) CloseNominations(w http.ResponseWriter, r *http.Request) {
+	round, err := api.CloseNominations(v.handler.GroupStore(r), routes.Actor(r))
+	if errors.Is(err, api.ErrNotNominating) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.AnnouncePhase(r, round)
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(round.Concealed())
+}
+
+func (v *votingRoutes) CloseVote(w http.ResponseWriter, r *http.Request) {
+	round, err := api.CloseVote(v.handler.GroupStore(r), routes.Actor(r))
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.RevealVote(r, round)
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(round)
+}
+
+func (v *votingRoutes) CancelVote(w http.ResponseWriter, r *http.Request) {
+	if err := api.CancelVote(v.handler.GroupStore(r), routes.Actor(r)); err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.UpdateClients(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *votingRoutes) ExtendVote(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ClosesAt time.Time `json:"closes_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	round, err := api.ExtendVote(v.handler.GroupStore(r), routes.Actor(r), body.ClosesAt)
+	if err != nil {
+		writeVoteError(w, err)
+		return
+	}
+	v.handler.UpdateClients(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(round.Concealed())
+}
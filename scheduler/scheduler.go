@@ -2,64 +2,220 @@ package scheduler
 
 import (
 	"log"
-	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/backup"
+	"github.com/MonkaKokosowa/watchalong-server/config"
 	"github.com/MonkaKokosowa/watchalong-server/logger"
 	"github.com/robfig/cron/v3"
 )
 
-func StartScheduler() {
+// Broadcaster tells connected clients about scheduled vote changes.
+type Broadcaster interface {
+	BroadcastUpdates(store api.Store)
+	BroadcastReveal(store api.Store, round api.VoteRound)
+	BroadcastPhase(store api.Store, round api.VoteRound)
+}
+
+// StartScheduler runs the vote, backup and trash jobs. broadcaster may be
+// nil.
+func StartScheduler(store api.Store, cfg config.Config, broadcaster Broadcaster) {
 	c := cron.New()
-	_, err := c.AddFunc("CRON_TZ=Europe/Warsaw 0 0 * * 0", func() {
-		logger.Info("Running cron job to update vote")
 
-		// Get vote results
-		winners, err := api.GetVoteResults()
-		if err != nil {
-			logger.Error("Error getting vote results: ", err)
-		} else {
-			// Add winners to queue
-			for _, winner := range winners {
-				if err := winner.AddMovieToQueue(); err != nil {
-					logger.Error("Error adding winner to queue: ", err)
-				}
-			}
+	jobs := &voteJobs{cron: c, store: store, broadcaster: broadcaster, entries: make(map[int]voteJob)}
+	jobs.sync()
+	// Groups can be created or rescheduled at runtime, so their vote jobs
+	// are reconciled every minute.
+	if _, err := c.AddFunc("@every 1m", jobs.sync); err != nil {
+		log.Fatalf("Error adding cron job: %v", err)
+	}
+
+	if cfg.BackupSchedule != "" {
+		addBackupJob(c, store, cfg)
+	}
+	if cfg.TrashRetentionDays > 0 {
+		addTrashJob(c, store, cfg)
+	}
+
+	c.Start()
+}
+
+type voteJob struct {
+	schedule string
+	entry    cron.EntryID
+}
+
+// voteJobs keeps one vote rotation job per group, on the group's schedule.
+// Rounds whose deadline passes between two scheduled rotations, like rounds
+// opened by hand or extended, are closed by sync; the next round still opens
+// on the schedule.
+type voteJobs struct {
+	mu          sync.Mutex
+	cron        *cron.Cron
+	store       api.Store
+	broadcaster Broadcaster
+	entries     map[int]voteJob
+
+	// rotating keeps the schedule and sync from rotating a group twice.
+	rotating sync.Mutex
+}
+
+func (jobs *voteJobs) rotate(store api.Store, slug string) {
+	jobs.rotating.Lock()
+	defer jobs.rotating.Unlock()
+
+	logger.Info("Running cron job to update vote for group " + slug)
+	previous, previousErr := store.GetCurrentVoteRound()
+	if err := api.RotateVote(store); err != nil {
+		logger.Error("Error rotating vote: ", err)
+		return
+	}
+	logger.Info("Cron job finished")
+
+	if jobs.broadcaster == nil {
+		return
+	}
+	if previousErr == nil {
+		if closed, err := store.GetVoteRound(previous.ID); err == nil && closed.EndedAt != nil {
+			jobs.broadcaster.BroadcastReveal(store, closed)
+		}
+	}
+	// Rounds with a nomination phase announce its start and end.
+	if current, err := store.GetCurrentVoteRound(); err == nil {
+		if current.Phase == api.PhaseNominating || (previousErr == nil && previous.ID == current.ID && previous.Phase != current.Phase) {
+			jobs.broadcaster.BroadcastPhase(store, current)
+		}
+	}
+	jobs.broadcaster.BroadcastUpdates(store)
+}
+
+// closeOverdue ends the open rounds that are past their deadline, like a
+// round that closes early on full participation: a nomination phase moves on
+// to its vote and a vote is closed without opening the next one.
+func (jobs *voteJobs) closeOverdue(groups []api.Group) {
+	now := time.Now()
+	for _, group := range groups {
+		groupStore := jobs.store.ForGroup(group.ID)
+		round, err := groupStore.GetCurrentVoteRound()
+		if err != nil || !overdue(round, now) {
+			continue
+		}
+		if round.Phase == api.PhaseNominating {
+			jobs.rotate(groupStore, group.Slug)
+			continue
 		}
+		jobs.close(groupStore, group.Slug, now)
+	}
+}
+
+func overdue(round api.VoteRound, now time.Time) bool {
+	return round.ClosesAt != nil && !round.ClosesAt.After(now)
+}
 
-		// Clear old vote
-		if err := api.ClearCurrentVote(); err != nil {
-			logger.Error("Error clearing current vote: ", err)
+func (jobs *voteJobs) close(store api.Store, slug string, now time.Time) {
+	jobs.rotating.Lock()
+	defer jobs.rotating.Unlock()
+
+	// The scheduled rotation may have replaced the round in the meantime.
+	if round, err := store.GetCurrentVoteRound(); err != nil || !overdue(round, now) {
+		return
+	}
+	logger.Info("Closing overdue vote for group " + slug)
+	round, err := api.CloseVote(store, "scheduler")
+	if err != nil {
+		logger.Error("Error closing vote: ", err)
+		return
+	}
+
+	if jobs.broadcaster == nil {
+		return
+	}
+	jobs.broadcaster.BroadcastReveal(store, round)
+	jobs.broadcaster.BroadcastUpdates(store)
+}
+
+func (jobs *voteJobs) sync() {
+	groups, err := jobs.store.GetGroups()
+	if err != nil {
+		logger.Error("Error loading groups: ", err)
+		return
+	}
+
+	jobs.closeOverdue(groups)
+
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	seen := make(map[int]bool, len(groups))
+	for _, group := range groups {
+		seen[group.ID] = true
+		current, ok := jobs.entries[group.ID]
+		if ok && current.schedule == group.VoteSchedule {
+			continue
 		}
-		if err := api.ClearVotes(); err != nil {
-			logger.Error("Error clearing votes: ", err)
+		if ok {
+			jobs.cron.Remove(current.entry)
+			delete(jobs.entries, group.ID)
 		}
 
-		// Get unwatched movies not in queue
-		movies, err := api.GetUnwatchedMoviesNotInQueue()
+		groupStore := jobs.store.ForGroup(group.ID)
+		slug := group.Slug
+		entry, err := jobs.cron.AddFunc(group.VoteSchedule, func() { jobs.rotate(groupStore, slug) })
 		if err != nil {
-			logger.Error("Error getting unwatched movies: ", err)
-			return
+			logger.Error("Error adding vote cron job for group "+slug+": ", err)
+			continue
 		}
+		jobs.entries[group.ID] = voteJob{schedule: group.VoteSchedule, entry: entry}
+	}
 
-		// Get 5 random movies
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(movies), func(i, j int) { movies[i], movies[j] = movies[j], movies[i] })
+	for groupID, current := range jobs.entries {
+		if !seen[groupID] {
+			jobs.cron.Remove(current.entry)
+			delete(jobs.entries, groupID)
+		}
+	}
+}
+
+func addBackupJob(c *cron.Cron, store api.Store, cfg config.Config) {
+	source, err := backup.SourceFor(store)
+	if err != nil {
+		logger.Warning("Scheduled backups disabled: " + err.Error())
+		return
+	}
 
-		var movieIDs []int
-		for i := 0; i < 5 && i < len(movies); i++ {
-			movieIDs = append(movieIDs, movies[i].ID)
+	_, err = c.AddFunc(cfg.BackupSchedule, func() {
+		logger.Info("Running cron job to back up the database")
+		if _, err := backup.Create(source, cfg.BackupDir); err != nil {
+			logger.Error("Error creating backup: ", err)
+			return
+		}
+		if err := backup.Rotate(cfg.BackupDir, cfg.BackupRetention); err != nil {
+			logger.Error("Error rotating backups: ", err)
 		}
+	})
+	if err != nil {
+		log.Fatalf("Error adding backup cron job: %v", err)
+	}
+}
 
-		// Create new vote
-		if err := api.CreateNewVote(movieIDs); err != nil {
-			logger.Error("Error creating new vote: ", err)
+func addTrashJob(c *cron.Cron, store api.Store, cfg config.Config) {
+	_, err := c.AddFunc("CRON_TZ=Europe/Warsaw 30 4 * * *", func() {
+		logger.Info("Running cron job to empty the trash")
+		groups, err := store.GetGroups()
+		if err != nil {
+			logger.Error("Error loading groups: ", err)
+			return
+		}
+		cutoff := time.Now().AddDate(0, 0, -cfg.TrashRetentionDays)
+		for _, group := range groups {
+			if _, err := store.ForGroup(group.ID).PurgeTrash(cutoff); err != nil {
+				logger.Error("Error emptying trash: ", err)
+			}
 		}
-		logger.Info("Cron job finished")
 	})
 	if err != nil {
-		log.Fatalf("Error adding cron job: %v", err)
+		log.Fatalf("Error adding trash cron job: %v", err)
 	}
-	c.Start()
 }
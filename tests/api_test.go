@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
@@ -8,336 +9,441 @@ import (
 )
 
 func TestAddMovie(t *testing.T) {
-	PrepareDB()
-	newMovie := api.Movie{
-		Name:         "Test Movie",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	if id == 0 {
-		t.Fatalf("AddMovie() returned id 0")
-	}
-
-	retrievedMovie, err := api.GetMovie(id)
-	if err != nil {
-		t.Fatalf("GetMovie() error = %v", err)
-	}
-
-	if retrievedMovie.Name != newMovie.Name {
-		t.Errorf("got %s, want %s", retrievedMovie.Name, newMovie.Name)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		newMovie := api.Movie{
+			Name:         "Test Movie",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		if id == 0 {
+			t.Fatalf("AddMovie() returned id 0")
+		}
+
+		retrievedMovie, err := store.GetMovie(id)
+		if err != nil {
+			t.Fatalf("GetMovie() error = %v", err)
+		}
+
+		if retrievedMovie.Name != newMovie.Name {
+			t.Errorf("got %s, want %s", retrievedMovie.Name, newMovie.Name)
+		}
+	})
 }
 
 func TestGetMovies(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:         "Test Movie 1",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	movie2 := api.Movie{
-		Name:         "Test Movie 2",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       456,
-		TmdbImageUrl: "http://example.com/image2.jpg",
-	}
-
-	_, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	_, err = movie2.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	movies, err := api.GetMovies()
-	if err != nil {
-		t.Fatalf("GetMovies() error = %v", err)
-	}
-
-	if len(movies) != 2 {
-		t.Errorf("got %d movies, want 2", len(movies))
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:         "Test Movie 1",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		movie2 := api.Movie{
+			Name:         "Test Movie 2",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       456,
+			TmdbImageUrl: "http://example.com/image2.jpg",
+		}
+
+		_, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		_, err = store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		movies, err := store.GetMovies()
+		if err != nil {
+			t.Fatalf("GetMovies() error = %v", err)
+		}
+
+		if len(movies) != 2 {
+			t.Errorf("got %d movies, want 2", len(movies))
+		}
+	})
 }
 
 func TestDeleteMovie(t *testing.T) {
-	PrepareDB()
-	newMovie := api.Movie{
-		Name:         "Test Movie",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	newMovie.ID = id
-	if err := newMovie.DeleteMovie(); err != nil {
-		t.Fatalf("DeleteMovie() error = %v", err)
-	}
-
-	_, err = api.GetMovie(id)
-	if err == nil {
-		t.Fatalf("GetMovie() should have failed, but it didn't")
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		newMovie := api.Movie{
+			Name:         "Test Movie",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		newMovie.ID = id
+		if err := store.DeleteMovie(newMovie.ID, "test"); err != nil {
+			t.Fatalf("DeleteMovie() error = %v", err)
+		}
+
+		_, err = store.GetMovie(id)
+		if err == nil {
+			t.Fatalf("GetMovie() should have failed, but it didn't")
+		}
+	})
 }
 
 func TestAddMovieToQueue(t *testing.T) {
-	PrepareDB()
-	newMovie := api.Movie{
-		Name:         "Test Movie",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	newMovie.ID = id
-	if err := newMovie.AddMovieToQueue(); err != nil {
-		t.Fatalf("AddMovieToQueue() error = %v", err)
-	}
-
-	retrievedMovie, err := api.GetMovie(id)
-	if err != nil {
-		t.Fatalf("GetMovie() error = %v", err)
-	}
-
-	if retrievedMovie.QueuePosition.Int64 != 1 {
-		t.Errorf("got queue position %d, want 1", retrievedMovie.QueuePosition.Int64)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		newMovie := api.Movie{
+			Name:         "Test Movie",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		newMovie.ID = id
+		if err := store.AddMovieToQueue(newMovie.ID); err != nil {
+			t.Fatalf("AddMovieToQueue() error = %v", err)
+		}
+
+		retrievedMovie, err := store.GetMovie(id)
+		if err != nil {
+			t.Fatalf("GetMovie() error = %v", err)
+		}
+
+		if retrievedMovie.QueuePosition.Int64 != 1 {
+			t.Errorf("got queue position %d, want 1", retrievedMovie.QueuePosition.Int64)
+		}
+	})
 }
 
 func TestFinishMovie(t *testing.T) {
-	PrepareDB()
-	newMovie := api.Movie{
-		Name:         "Test Movie",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	newMovie.ID = id
-	if err := newMovie.AddMovieToQueue(); err != nil {
-		t.Fatalf("AddMovieToQueue() error = %v", err)
-	}
-
-	if err := newMovie.FinishMovie(); err != nil {
-		t.Fatalf("FinishMovie() error = %v", err)
-	}
-
-	retrievedMovie, err := api.GetMovie(id)
-	if err != nil {
-		t.Fatalf("GetMovie() error = %v", err)
-	}
-
-	if !retrievedMovie.Watched {
-		t.Errorf("got watched %t, want true", retrievedMovie.Watched)
-	}
-
-	if retrievedMovie.QueuePosition.Valid {
-		t.Errorf("got queue position %d, want null", retrievedMovie.QueuePosition.Int64)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		newMovie := api.Movie{
+			Name:         "Test Movie",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		newMovie.ID = id
+		if err := store.AddMovieToQueue(newMovie.ID); err != nil {
+			t.Fatalf("AddMovieToQueue() error = %v", err)
+		}
+
+		if err := store.FinishMovie(newMovie.ID); err != nil {
+			t.Fatalf("FinishMovie() error = %v", err)
+		}
+
+		retrievedMovie, err := store.GetMovie(id)
+		if err != nil {
+			t.Fatalf("GetMovie() error = %v", err)
+		}
+
+		if !retrievedMovie.Watched {
+			t.Errorf("got watched %t, want true", retrievedMovie.Watched)
+		}
+
+		if retrievedMovie.QueuePosition.Valid {
+			t.Errorf("got queue position %d, want null", retrievedMovie.QueuePosition.Int64)
+		}
+	})
 }
 
 func TestRemoveMovieFromQueue(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:         "Test Movie 1",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       123,
-		TmdbImageUrl: "http://example.com/image.jpg",
-	}
-
-	movie2 := api.Movie{
-		Name:         "Test Movie 2",
-		IsMovie:      true,
-		ProposedBy:   "test",
-		TmdbID:       456,
-		TmdbImageUrl: "http://example.com/image2.jpg",
-	}
-
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	id2, err := movie2.AddMovie()
-	if err != nil {
-		t.Fatalf("AddMovie() error = %v", err)
-	}
-
-	movie1.ID = id1
-	movie2.ID = id2
-
-	if err := movie1.AddMovieToQueue(); err != nil {
-		t.Fatalf("AddMovieToQueue() error = %v", err)
-	}
-
-	if err := movie2.AddMovieToQueue(); err != nil {
-		t.Fatalf("AddMovieToQueue() error = %v", err)
-	}
-
-	if err := movie1.RemoveMovieFromQueue(); err != nil {
-		t.Fatalf("RemoveMovieFromQueue() error = %v", err)
-	}
-
-	retrievedMovie2, err := api.GetMovie(id2)
-	if err != nil {
-		t.Fatalf("GetMovie() error = %v", err)
-	}
-
-	if retrievedMovie2.QueuePosition.Int64 != 1 {
-		t.Errorf("got queue position %d, want 1", retrievedMovie2.QueuePosition.Int64)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:         "Test Movie 1",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       123,
+			TmdbImageUrl: "http://example.com/image.jpg",
+		}
+
+		movie2 := api.Movie{
+			Name:         "Test Movie 2",
+			IsMovie:      true,
+			ProposedBy:   "test",
+			TmdbID:       456,
+			TmdbImageUrl: "http://example.com/image2.jpg",
+		}
+
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		id2, err := store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatalf("AddMovie() error = %v", err)
+		}
+
+		movie1.ID = id1
+		movie2.ID = id2
+
+		if err := store.AddMovieToQueue(movie1.ID); err != nil {
+			t.Fatalf("AddMovieToQueue() error = %v", err)
+		}
+
+		if err := store.AddMovieToQueue(movie2.ID); err != nil {
+			t.Fatalf("AddMovieToQueue() error = %v", err)
+		}
+
+		if err := store.RemoveMovieFromQueue(movie1.ID); err != nil {
+			t.Fatalf("RemoveMovieFromQueue() error = %v", err)
+		}
+
+		retrievedMovie2, err := store.GetMovie(id2)
+		if err != nil {
+			t.Fatalf("GetMovie() error = %v", err)
+		}
+
+		if retrievedMovie2.QueuePosition.Int64 != 1 {
+			t.Errorf("got queue position %d, want 1", retrievedMovie2.QueuePosition.Int64)
+		}
+	})
 }
 
 func TestRateMovie(t *testing.T) {
-	PrepareDB()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.RateMovie(id, "test", 5); err != nil {
+			t.Fatal(err)
+		}
+
+		retrievedMovie, err := store.GetMovie(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if retrievedMovie.Ratings != "{\"test\":5}" {
+			t.Errorf("got ratings %s, want {\"test\":5}", retrievedMovie.Ratings)
+		}
+	})
+}
 
-	if err := api.RateMovie(id, "test", 5); err != nil {
-		t.Fatal(err)
-	}
+func TestGetMovieRatings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.RateMovie(id, "bob", 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(id, "alice", 4); err != nil {
+			t.Fatal(err)
+		}
+		// Rating again replaces the previous score.
+		if err := store.RateMovie(id, "bob", 5); err != nil {
+			t.Fatal(err)
+		}
+
+		ratings, err := store.GetMovieRatings(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ratings) != 2 {
+			t.Fatalf("got %d ratings, want 2", len(ratings))
+		}
+		if ratings[0].Username != "alice" || ratings[0].Score != 4 {
+			t.Errorf("got %s=%v, want alice=4", ratings[0].Username, ratings[0].Score)
+		}
+		if ratings[1].Username != "bob" || ratings[1].Score != 5 {
+			t.Errorf("got %s=%v, want bob=5", ratings[1].Username, ratings[1].Score)
+		}
+		if ratings[1].CreatedAt.IsZero() || ratings[1].UpdatedAt.Before(ratings[1].CreatedAt) {
+			t.Errorf("got created_at %v, updated_at %v", ratings[1].CreatedAt, ratings[1].UpdatedAt)
+		}
+	})
+}
 
-	retrievedMovie, err := api.GetMovie(id)
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestGetUserRatings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		movie2 := api.Movie{
+			Name:    "Test Movie 2",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, err := store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.RateMovie(id1, "test", 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(id2, "test", 4); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(id2, "other", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		ratings, err := store.GetUserRatings("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ratings) != 2 {
+			t.Fatalf("got %d ratings, want 2", len(ratings))
+		}
+		for _, rating := range ratings {
+			if rating.Username != "test" {
+				t.Errorf("got rating by %s, want test", rating.Username)
+			}
+		}
+	})
+}
 
-	if retrievedMovie.Ratings != "{\"test\":5}" {
-		t.Errorf("got ratings %s, want {\"test\":5}", retrievedMovie.Ratings)
-	}
+func TestRateMissingMovie(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		if err := store.RateMovie(404, "test", 5); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("got error %v, want ErrNotFound", err)
+		}
+	})
 }
 
 func TestCreateNewVote(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	movie2 := api.Movie{
-		Name:    "Test Movie 2",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	id2, err := movie2.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1, id2}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	currentVote, err := api.GetCurrentVote()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if len(currentVote) != 2 {
-		t.Errorf("got %d movies in current vote, want 2", len(currentVote))
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		movie2 := api.Movie{
+			Name:    "Test Movie 2",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, err := store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1, id2}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		currentVote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(currentVote) != 2 {
+			t.Errorf("got %d movies in current vote, want 2", len(currentVote))
+		}
+	})
 }
 
 func TestGetCurrentVote(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	currentVote, err := api.GetCurrentVote()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if len(currentVote) != 1 {
-		t.Errorf("got %d movies in current vote, want 1", len(currentVote))
-	}
-	if currentVote[0].ID != id1 {
-		t.Errorf("got movie id %d, want %d", currentVote[0].ID, id1)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		currentVote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(currentVote) != 1 {
+			t.Errorf("got %d movies in current vote, want 1", len(currentVote))
+		}
+		if currentVote[0].ID != id1 {
+			t.Errorf("got movie id %d, want %d", currentVote[0].ID, id1)
+		}
+	})
 }
 
 func TestCastVote(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	if err := api.CastVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	winner, err := api.GetVoteWinner()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if winner.ID != id1 {
-		t.Errorf("got winner id %d, want %d", winner.ID, id1)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.CastVote("test", movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		winner, err := store.GetVoteWinner()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if winner.ID != id1 {
+			t.Errorf("got winner id %d, want %d", winner.ID, id1)
+		}
+	})
 }
 
 func reverseInts(input []int) []int {
@@ -348,96 +454,98 @@ func reverseInts(input []int) []int {
 }
 
 func TestGetVoteResults(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	movie2 := api.Movie{
-		Name:    "Test Movie 2",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	id2, err := movie2.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1, id2}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	if err := api.CastVote(reverseInts(movieIDs)); err != nil {
-		t.Fatal(err)
-	}
-
-	results, err := api.GetVoteResults()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if len(results) != 2 {
-		t.Fatalf("expected 2 results, got %d", len(results))
-	}
-
-	if results[0].ID != id2 {
-		t.Errorf("got winner id %d, want %d", results[0].ID, id2)
-	}
-
-	if results[1].ID != id1 {
-		t.Errorf("got second place id %d, want %d", results[1].ID, id1)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		movie2 := api.Movie{
+			Name:    "Test Movie 2",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, err := store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1, id2}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.CastVote("test", reverseInts(movieIDs)); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := store.GetVoteResults()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(results))
+		}
+
+		if results[0].ID != id2 {
+			t.Errorf("got winner id %d, want %d", results[0].ID, id2)
+		}
+
+		if results[1].ID != id1 {
+			t.Errorf("got second place id %d, want %d", results[1].ID, id1)
+		}
+	})
 }
 
 func TestGetUnwatchedMoviesNotInQueue(t *testing.T) {
-	PrepareDB()
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	movie2 := api.Movie{
-		Name:    "Test Movie 2",
-		IsMovie: true,
-	}
-	movie3 := api.Movie{
-		Name:    "Test Movie 3",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	id2, err := movie2.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	movie2.ID = id2
-	if err := movie2.FinishMovie(); err != nil {
-		t.Fatal(err)
-	}
-	id3, err := movie3.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	movie1.ID = id1
-	movie3.ID = id3
-	if err := movie3.AddMovieToQueue(); err != nil {
-		t.Fatal(err)
-	}
-
-	movies, err := api.GetUnwatchedMoviesNotInQueue()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if len(movies) != 1 {
-		t.Errorf("got %d movies, want 1", len(movies))
-	}
-	if movies[0].ID != id1 {
-		t.Errorf("got movie id %d, want %d", movies[0].ID, id1)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		movie2 := api.Movie{
+			Name:    "Test Movie 2",
+			IsMovie: true,
+		}
+		movie3 := api.Movie{
+			Name:    "Test Movie 3",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id2, err := store.AddMovie(&movie2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		movie2.ID = id2
+		if err := store.FinishMovie(movie2.ID); err != nil {
+			t.Fatal(err)
+		}
+		id3, err := store.AddMovie(&movie3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		movie1.ID = id1
+		movie3.ID = id3
+		if err := store.AddMovieToQueue(movie3.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		movies, err := store.GetUnwatchedMoviesNotInQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 1 {
+			t.Errorf("got %d movies, want 1", len(movies))
+		}
+		if movies[0].ID != id1 {
+			t.Errorf("got movie id %d, want %d", movies[0].ID, id1)
+		}
+	})
 }
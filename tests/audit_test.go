@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/http/routes"
+)
+
+func TestAuditLogRecordsMutations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		audited := api.WithAudit(store, "alice")
+
+		id, err := audited.AddMovie(&api.Movie{Name: "Audited", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.RateMovie(id, "alice", 4); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.AddMovieToQueue(id); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.RemoveMovieFromQueue(id); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.FinishMovie(id); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.AddAlias(&api.Alias{Username: "alice", Alias: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateNewVote([]int{id}); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.CastVote("alice", []int{id}); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.RateMovie(id+100, "alice", 4); err == nil {
+			t.Fatal("expected rating a missing movie to fail")
+		}
+
+		entries, err := store.GetAuditLog(api.AuditFilter{})
+		if err != nil {
+			t.Fatalf("GetAuditLog() error = %v", err)
+		}
+		want := []string{api.AuditCastVote, api.AuditAddAlias, api.AuditFinishMovie, api.AuditQueueRemove, api.AuditQueueAdd, api.AuditRateMovie, api.AuditAddMovie}
+		if len(entries) != len(want) {
+			t.Fatalf("expected %d entries, got %+v", len(want), entries)
+		}
+		for i, entry := range entries {
+			if entry.Action != want[i] || entry.Actor != "alice" {
+				t.Errorf("entry %d: expected %s by alice, got %s by %s", i, want[i], entry.Action, entry.Actor)
+			}
+		}
+
+		queueAdd := entries[4]
+		if string(queueAdd.Before) != "[]" || string(queueAdd.After) != "["+jsonInt(id)+"]" {
+			t.Errorf("unexpected queue_add payloads %s -> %s", queueAdd.Before, queueAdd.After)
+		}
+		if string(entries[6].Before) != "null" {
+			t.Errorf("expected add_movie to have no before state, got %s", entries[6].Before)
+		}
+
+		filtered, err := store.GetAuditLog(api.AuditFilter{Action: api.AuditRateMovie, MovieID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(filtered) != 1 {
+			t.Errorf("expected 1 rate_movie entry, got %d", len(filtered))
+		}
+
+		page, err := store.GetAuditLog(api.AuditFilter{Limit: 2, Offset: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || page[0].Action != api.AuditAddAlias || page[1].Action != api.AuditFinishMovie {
+			t.Errorf("unexpected page %+v", page)
+		}
+
+		future, err := store.GetAuditLog(api.AuditFilter{Since: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(future) != 0 {
+			t.Errorf("expected no entries in the future, got %d", len(future))
+		}
+	})
+}
+
+func jsonInt(n int) string {
+	data, _ := json.Marshal(n)
+	return string(data)
+}
+
+func TestRotateVote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"Loser", "Winner", "Next"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if err := store.CreateNewVote(ids[:2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("test", []int{ids[1], ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := api.RotateVote(store); err != nil {
+			t.Fatalf("RotateVote() error = %v", err)
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 2 || queue[0].ID != ids[1] {
+			t.Errorf("expected the winner first in the queue, got %+v", queue)
+		}
+
+		vote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote) != 1 || vote[0].ID != ids[2] {
+			t.Errorf("expected the remaining movie in the new vote, got %+v", vote)
+		}
+
+		entries, err := store.GetAuditLog(api.AuditFilter{Actor: "scheduler"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Action != api.AuditRotateVote {
+			t.Errorf("expected a single rotate_vote entry, got %+v", entries)
+		}
+	})
+}
+
+func TestHTTPAuditLog(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/add/movie", strings.NewReader(`{"name": "Test Movie", "is_movie": true, "proposed_by": "alice"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(routes.ActorHeader, "bob")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		resp, err = http.Get(server.URL + "/admin/audit?actor=bob&action=add_movie")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+		var entries []api.AuditEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Actor != "bob" {
+			t.Errorf("expected one entry by bob, got %+v", entries)
+		}
+
+		resp, err = http.Get(server.URL + "/admin/audit?since=yesterday")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for an invalid time, got %v", resp.Status)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/backup"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+	customhttp "github.com/MonkaKokosowa/watchalong-server/http"
+	"github.com/MonkaKokosowa/watchalong-server/websocket"
+	"github.com/gorilla/mux"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := api.OpenSQLiteStore(filepath.Join(dir, "live.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	newMovie := api.Movie{
+		Name:    "Backed Up",
+		IsMovie: true,
+	}
+	id, err := store.AddMovie(&newMovie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := backup.SourceFor(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := backup.Create(source, filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	restoredPath := filepath.Join(dir, "restored.sqlite")
+	if err := backup.Restore(path, restoredPath); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	restored, err := api.OpenSQLiteStore(restoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	movie, err := restored.GetMovie(id)
+	if err != nil {
+		t.Fatalf("GetMovie() on restored database error = %v", err)
+	}
+	if movie.Name != newMovie.Name {
+		t.Errorf("got %s, want %s", movie.Name, newMovie.Name)
+	}
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	backupPath := filepath.Join(dir, "future.sqlite")
+	db, err := database.InitializeDB(database.SQLite, backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	target := filepath.Join(dir, "target.sqlite")
+	if err := os.WriteFile(target, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backup.Restore(backupPath, target); err == nil {
+		t.Fatalf("Restore() should reject a newer schema version")
+	}
+
+	contents, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "keep me" {
+		t.Errorf("target database was replaced by a rejected backup")
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"watchalong-20240101-000000.sqlite", "watchalong-20240102-000000.sqlite", "watchalong-20240103-000000.sqlite", "unrelated.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := backup.Rotate(dir, 2); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	backups, err := backup.List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+	if backups[0].Name != "watchalong-20240103-000000.sqlite" || backups[1].Name != "watchalong-20240102-000000.sqlite" {
+		t.Errorf("kept the wrong backups: %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unrelated.txt")); err != nil {
+		t.Errorf("unrelated file was removed")
+	}
+}
+
+func TestHTTPCreateBackup(t *testing.T) {
+	store := newSQLiteStore(t)
+	cfg := testConfig(t)
+	cfg.AdminToken = "secret"
+
+	router := mux.NewRouter()
+	customhttp.AddRoutes(router, store, websocket.NewManager(), cfg)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/admin/backup", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status Unauthorized without token, got %v", resp.Status)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/admin/backup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status Created, got %v", resp.Status)
+	}
+
+	var info backup.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.BackupDir, info.Name)); err != nil {
+		t.Errorf("backup file %s not found: %v", info.Name, err)
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/http/routes"
+)
+
+func TestCastVoteReplacesBallot(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"First", "Second", "Third"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		if err := store.CastVote("alice", ids); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound without an open round, got %v", err)
+		}
+		if err := store.CreateNewVote(ids); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ranking := range [][]int{{}, {ids[0], ids[0]}, {ids[0], ids[2] + 100}} {
+			if err := store.CastVote("alice", ranking); !errors.Is(err, api.ErrInvalidBallot) {
+				t.Errorf("CastVote(%v): expected ErrInvalidBallot, got %v", ranking, err)
+			}
+		}
+
+		// Voting again replaces the ballot instead of adding to it.
+		for i := 0; i < 3; i++ {
+			if err := store.CastVote("alice", []int{ids[0], ids[1], ids[2]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.CastVote("alice", []int{ids[2], ids[1], ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("bob", []int{ids[1], ids[2]}); err != nil {
+			t.Fatal(err)
+		}
+
+		ballot, err := store.GetBallot("alice")
+		if err != nil {
+			t.Fatalf("GetBallot() error = %v", err)
+		}
+		if len(ballot.Ranking) != 3 || ballot.Ranking[0] != ids[2] {
+			t.Errorf("expected the latest ranking, got %+v", ballot)
+		}
+		if _, err := store.GetBallot("carol"); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a user without a ballot, got %v", err)
+		}
+
+		tallies, err := store.GetVoteTallies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int{0, 2, 2}
+		for i, tally := range tallies {
+			if tally.MovieID != ids[i] || tally.Votes != want[i] {
+				t.Errorf("tally %d: expected %d votes for %d, got %+v", i, want[i], ids[i], tally)
+			}
+		}
+		results, err := store.GetVoteResults()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 3 || results[0].ID != ids[1] || results[2].ID != ids[0] {
+			t.Errorf("unexpected results %+v", results)
+		}
+
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetBallot("alice"); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected no ballot once the round is closed, got %v", err)
+		}
+	})
+}
+
+func TestHTTPBallot(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		id, err := store.AddMovie(&api.Movie{Name: "Test Movie", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateNewVote([]int{id}); err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := json.Marshal(map[string]any{"movie_ids": []int{id}})
+		resp, err := http.Post(server.URL+"/vote", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for an anonymous ballot, got %v", resp.Status)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/vote", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(routes.ActorHeader, "alice")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		resp, err = http.Get(server.URL + "/vote/ballot?username=alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+		var ballot api.Ballot
+		if err := json.NewDecoder(resp.Body).Decode(&ballot); err != nil {
+			t.Fatal(err)
+		}
+		if ballot.Username != "alice" || len(ballot.Ranking) != 1 || ballot.Ranking[0] != id {
+			t.Errorf("unexpected ballot %+v", ballot)
+		}
+	})
+}
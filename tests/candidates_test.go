@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// candidateGroup creates a group using strategy and adds movies proposed by
+// the given users.
+func candidateGroup(t *testing.T, store api.Store, strategy string, count int, proposers ...string) (api.Store, []int) {
+	groupID, err := store.CreateGroup(&api.Group{Slug: "candidates-" + strategy, CandidateStrategy: strategy, CandidateCount: count, RetireAfter: 1,
+		VetoesPerMonth: api.DefaultVetoesPerMonth, NominationsPerUser: api.DefaultNominationsPerUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = store.ForGroup(groupID)
+
+	var ids []int
+	for i, proposer := range proposers {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true, ProposedBy: proposer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return store, ids
+}
+
+func TestUniformCandidatesAreSeedable(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, _ = candidateGroup(t, store, api.CandidatesUniform, 3, "a", "b", "c", "d", "e", "f")
+
+		first, err := api.SelectCandidates(store, rand.New(rand.NewSource(42)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := api.SelectCandidates(store, rand.New(rand.NewSource(42)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first) != 3 || fmt.Sprint(first) != fmt.Sprint(second) {
+			t.Errorf("expected the same three picks for the same seed, got %v and %v", first, second)
+		}
+	})
+}
+
+func TestProposerFairCandidates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := candidateGroup(t, store, api.CandidatesProposerFair, 3, "alice", "alice", "alice", "bob")
+		proposers := map[int]string{ids[0]: "alice", ids[1]: "alice", ids[2]: "alice", ids[3]: "bob"}
+
+		for seed := int64(0); seed < 10; seed++ {
+			picked, err := api.SelectCandidates(store, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(picked) != 2 || proposers[picked[0]] == proposers[picked[1]] {
+				t.Errorf("seed %d: expected one movie each from alice and bob, got %v", seed, picked)
+			}
+		}
+	})
+}
+
+func TestRetireCandidates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := candidateGroup(t, store, api.CandidatesRetire, 5, "a", "b", "c")
+		if err := store.CreateNewVote(ids[:2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("alice", []int{ids[1], ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+
+		picked, err := api.SelectCandidates(store, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(picked) != 2 {
+			t.Fatalf("expected the two movies that have not lost, got %v", picked)
+		}
+		for _, id := range picked {
+			if id == ids[0] {
+				t.Errorf("expected the movie that lost to be retired, got %v", picked)
+			}
+		}
+	})
+}
+
+func TestWaitedCandidatesFavourOldProposals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := candidateGroup(t, store, api.CandidatesWaited, 1, "new")
+		longAgo := time.Now().UTC().AddDate(-3, 0, 0)
+		export := &api.StateExport{
+			Version: api.ExportFormatVersion,
+			Movies:  []api.Movie{{ID: 1000, Name: "Old", IsMovie: true, ProposedBy: "old", AddedAt: &longAgo}},
+		}
+		if _, err := api.ImportState(store, export, api.ImportMerge); err != nil {
+			t.Fatal(err)
+		}
+
+		newPicks := 0
+		for seed := int64(0); seed < 20; seed++ {
+			picked, err := api.SelectCandidates(store, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(picked) != 1 {
+				t.Fatalf("expected one pick, got %v", picked)
+			}
+			if picked[0] == ids[0] {
+				newPicks++
+			}
+		}
+		if newPicks > 2 {
+			t.Errorf("expected the old proposal to be picked almost always, the new one came up %d of 20 times", newPicks)
+		}
+	})
+}
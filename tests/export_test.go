@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// roundTrip marshals and unmarshals export the way the HTTP routes and CLI do.
+func roundTrip(t *testing.T, export *api.StateExport) *api.StateExport {
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded api.StateExport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return &decoded
+}
+
+func TestExportImportReplace(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"First", "Second", "Third"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true, TmdbID: len(ids) + 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if err := store.RateMovie(ids[0], "test", 4); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddAlias(&api.Alias{Username: "test", Alias: "Tester"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddMovieToQueue(ids[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddMovieToQueue(ids[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateNewVote([]int{ids[1], ids[2]}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("test", []int{ids[2], ids[1]}); err != nil {
+			t.Fatal(err)
+		}
+
+		exported, err := api.ExportState(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		document := roundTrip(t, exported)
+
+		// Diverge from the export before replacing.
+		if _, err := store.AddMovie(&api.Movie{Name: "Extra", IsMovie: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ClearVotes(); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := api.ImportState(store, document, api.ImportReplace)
+		if err != nil {
+			t.Fatalf("ImportState() error = %v", err)
+		}
+		if report.MoviesImported != 3 || report.RatingsImported != 1 || report.QueueImported != 2 || !report.VoteImported {
+			t.Errorf("unexpected report %+v", report)
+		}
+
+		reexported, err := api.ExportState(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reexported.ExportedAt = exported.ExportedAt
+		want, _ := json.Marshal(roundTrip(t, exported))
+		got, _ := json.Marshal(roundTrip(t, reexported))
+		if string(got) != string(want) {
+			t.Errorf("state after replace differs from export\n got: %s\nwant: %s", got, want)
+		}
+
+		id, err := store.AddMovie(&api.Movie{Name: "After Import", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= ids[2] {
+			t.Errorf("expected new movie id above %d, got %d", ids[2], id)
+		}
+	})
+}
+
+func TestImportMergeConflicts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		existingID, err := store.AddMovie(&api.Movie{Name: "Existing", IsMovie: true, TmdbID: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(existingID, "local", 3); err != nil {
+			t.Fatal(err)
+		}
+
+		document := &api.StateExport{
+			Version: api.ExportFormatVersion,
+			Movies: []api.Movie{
+				{ID: 1, Name: "Existing Elsewhere", IsMovie: true, TmdbID: 10},
+				{ID: 2, Name: "New", IsMovie: true, TmdbID: 20},
+				{ID: 3, Name: "Same Id Show", IsMovie: false, TmdbID: 10},
+			},
+			Ratings: []api.Rating{
+				{MovieID: 1, Username: "remote", Score: 5},
+				{MovieID: 1, Username: "local", Score: 1},
+			},
+			Queue: []int{2},
+		}
+
+		report, err := api.ImportState(store, document, api.ImportMerge)
+		if err != nil {
+			t.Fatalf("ImportState() error = %v", err)
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0].ExistingID != existingID || report.Conflicts[0].ImportedID != 1 {
+			t.Fatalf("unexpected conflicts %+v", report.Conflicts)
+		}
+		if report.MoviesImported != 2 {
+			t.Errorf("expected 2 imported movies, got %d", report.MoviesImported)
+		}
+
+		movies, err := store.GetMovies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movies) != 3 {
+			t.Fatalf("expected 3 movies, got %d", len(movies))
+		}
+
+		ratings, err := store.GetMovieRatings(existingID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ratings) != 2 || ratings[0].Username != "local" || ratings[0].Score != 3 || ratings[1].Username != "remote" {
+			t.Errorf("expected existing rating kept and remote rating merged, got %+v", ratings)
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 1 || queue[0].Name != "New" {
+			t.Errorf("expected imported movie queued, got %+v", queue)
+		}
+	})
+}
+
+func TestImportRejectsInvalidDocument(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		if _, err := store.AddMovie(&api.Movie{Name: "Keep Me", IsMovie: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		documents := map[string]*api.StateExport{
+			"version":   {Version: api.ExportFormatVersion + 1},
+			"reference": {Version: api.ExportFormatVersion, Queue: []int{42}},
+			"queue":     {Version: api.ExportFormatVersion, Queues: []api.QueueExport{{Slug: api.MainQueueSlug}}},
+			"session":   {Version: api.ExportFormatVersion, Session: &api.Session{State: "paused"}},
+		}
+		for name, document := range documents {
+			if _, err := api.ImportState(store, document, api.ImportReplace); !errors.Is(err, api.ErrInvalidExport) {
+				t.Errorf("%s: expected ErrInvalidExport, got %v", name, err)
+			}
+		}
+
+		movies, err := store.GetMovies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movies) != 1 {
+			t.Errorf("expected rejected imports to leave the store untouched, got %d movies", len(movies))
+		}
+	})
+}
+
+func TestExportImportGroupState(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := vetoGroup(t, store)
+		if _, err := api.VetoCandidate(store, "bob", ids[0]); err != nil {
+			t.Fatal(err)
+		}
+		queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later", Name: "Later"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []int{ids[2], ids[1]} {
+			if err := store.ForQueue(queueID).AddMovieToQueue(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.AddMovieToQueue(ids[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PlanMovie(ids[2], time.Date(2030, 1, 2, 20, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.StartSession(store, "alice", ids[2]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.WatchSession(store, "alice"); err != nil {
+			t.Fatal(err)
+		}
+
+		exported, err := api.ExportState(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		document := roundTrip(t, exported)
+
+		// Diverge from the export before replacing.
+		if _, err := api.VetoCandidate(store, "alice", ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteQueue(queueID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PlanMovie(ids[2], time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.StopSession(store, "alice"); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := api.ImportState(store, document, api.ImportReplace)
+		if err != nil {
+			t.Fatalf("ImportState() error = %v", err)
+		}
+		if report.VetoesImported != 1 || report.QueueImported != 3 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		reexported, err := api.ExportState(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reexported.ExportedAt = exported.ExportedAt
+		want, _ := json.Marshal(roundTrip(t, exported))
+		got, _ := json.Marshal(roundTrip(t, reexported))
+		if string(got) != string(want) {
+			t.Errorf("state after replace differs from export\n got: %s\nwant: %s", got, want)
+		}
+		for username, want := range map[string]int{"alice": 1, "bob": 0} {
+			if left, err := api.VetoesLeft(store, username); err != nil || left != want {
+				t.Errorf("expected %s to have %d vetoes left, got %d, %v", username, want, left, err)
+			}
+		}
+	})
+}
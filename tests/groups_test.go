@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+func TestGroupsAreIsolated(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		groupID, err := store.CreateGroup(&api.Group{Slug: "friends"})
+		if err != nil {
+			t.Fatalf("CreateGroup() error = %v", err)
+		}
+		if _, err := store.CreateGroup(&api.Group{Slug: "friends"}); !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected ErrConflict for a duplicate slug, got %v", err)
+		}
+		friends := store.ForGroup(groupID)
+
+		defaultID, err := store.AddMovie(&api.Movie{Name: "Default Movie", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		friendsID, err := friends.AddMovie(&api.Movie{Name: "Friends Movie", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := friends.AddMovieToQueue(friendsID); err != nil {
+			t.Fatal(err)
+		}
+		if err := friends.AddMovieToQueue(defaultID); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound queueing another group's movie, got %v", err)
+		}
+		if err := friends.AddAlias(&api.Alias{Username: "alice", Alias: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+
+		movies, err := store.GetMovies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movies) != 1 || movies[0].ID != defaultID {
+			t.Errorf("expected only the default group's movie, got %+v", movies)
+		}
+		if _, err := store.GetMovie(friendsID); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another group's movie, got %v", err)
+		}
+		movie, err := friends.GetMovie(friendsID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.GroupID != groupID {
+			t.Errorf("expected group_id %d, got %d", groupID, movie.GroupID)
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 0 {
+			t.Errorf("expected empty default queue, got %+v", queue)
+		}
+		aliases, err := store.GetAliases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(aliases) != 0 {
+			t.Errorf("expected no default aliases, got %+v", aliases)
+		}
+
+		if err := store.CreateNewVote([]int{defaultID}); err != nil {
+			t.Fatal(err)
+		}
+		vote, err := friends.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote) != 0 {
+			t.Errorf("expected no vote in the new group, got %+v", vote)
+		}
+	})
+}
+
+func TestHTTPGroupRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		body, _ := json.Marshal(api.Group{Slug: "friends", Name: "Friends"})
+		resp, err := http.Post(server.URL+"/admin/groups", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status Created, got %v", resp.Status)
+		}
+
+		movie, _ := json.Marshal(api.Movie{Name: "Friends Movie", IsMovie: true, ProposedBy: "alice"})
+		resp, err = http.Post(server.URL+"/groups/friends/add/movie", "application/json", bytes.NewReader(movie))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status Created, got %v", resp.Status)
+		}
+
+		for path, want := range map[string]int{"/movies": 0, "/groups/friends/movies": 1} {
+			resp, err := http.Get(server.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var movies []api.Movie
+			if err := json.NewDecoder(resp.Body).Decode(&movies); err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if len(movies) != want {
+				t.Errorf("%s: expected %d movies, got %d", path, want, len(movies))
+			}
+		}
+
+		resp, err = http.Get(server.URL + "/groups/unknown/movies")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status Not Found for an unknown group, got %v", resp.Status)
+		}
+	})
+}
+
+func TestHTTPUpdateGroup(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		if _, err := store.CreateGroup(&api.Group{Slug: "settings"}); err != nil {
+			t.Fatal(err)
+		}
+		update := func(body string) api.Group {
+			req, err := http.NewRequest(http.MethodPut, server.URL+"/admin/groups/settings", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: expected status OK, got %v", body, resp.Status)
+			}
+			var group api.Group
+			if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+				t.Fatal(err)
+			}
+			return group
+		}
+
+		if group := update(`{"candidate_count": 3, "retire_after": 1}`); group.CandidateCount != 3 || group.RetireAfter != 1 {
+			t.Errorf("expected the new candidate settings, got %+v", group)
+		}
+		if group := update(`{"name": "Settings"}`); group.CandidateCount != 3 || group.RetireAfter != 1 {
+			t.Errorf("expected settings left out to keep their value, got %+v", group)
+		}
+		if group := update(`{"candidate_count": 0}`); group.CandidateCount != api.VoteCandidates {
+			t.Errorf("expected 0 to restore the default candidate count, got %d", group.CandidateCount)
+		}
+		if group := update(`{"vetoes_per_month": 0, "nominations_per_user": 0}`); group.VetoesPerMonth != 0 || group.NominationsPerUser != 0 {
+			t.Errorf("expected limits of 0 to stick, got %+v", group)
+		}
+		if group, err := store.GetGroup("settings"); err != nil || group.VetoesPerMonth != 0 || group.NominationsPerUser != 0 {
+			t.Errorf("expected the stored group to allow no vetoes or nominations, got %+v, %v", group, err)
+		}
+		if group := update(`{"name": "Renamed"}`); group.VetoesPerMonth != 0 || group.NominationsPerUser != 0 {
+			t.Errorf("expected limits left out to keep their value, got %+v", group)
+		}
+
+		group, err := store.GetGroup("settings")
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := store.ForGroup(group.ID).GetAuditLog(api.AuditFilter{Action: api.AuditUpdateGroup})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 5 || !strings.Contains(string(entries[0].Before), `"name":"Settings"`) || !strings.Contains(string(entries[0].After), `"name":"Renamed"`) {
+			t.Errorf("expected every update in the group's audit log, got %+v", entries)
+		}
+	})
+}
+
+func TestHTTPCreateGroupLimits(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		create := func(body string) api.Group {
+			resp, err := http.Post(server.URL+"/admin/groups", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("%s: expected status Created, got %v", body, resp.Status)
+			}
+			var group api.Group
+			if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+				t.Fatal(err)
+			}
+			return group
+		}
+
+		if group := create(`{"slug": "defaults"}`); group.VetoesPerMonth != api.DefaultVetoesPerMonth || group.NominationsPerUser != api.DefaultNominationsPerUser {
+			t.Errorf("expected the default limits, got %+v", group)
+		}
+		create(`{"slug": "strict", "vetoes_per_month": 0, "nominations_per_user": 0}`)
+		if group, err := store.GetGroup("strict"); err != nil || group.VetoesPerMonth != 0 || group.NominationsPerUser != 0 {
+			t.Errorf("expected a new group to start without vetoes or nominations, got %+v, %v", group, err)
+		}
+		strict, err := store.GetGroup("strict")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries, err := store.ForGroup(strict.ID).GetAuditLog(api.AuditFilter{Action: api.AuditCreateGroup}); err != nil || len(entries) != 1 {
+			t.Errorf("expected the creation in the new group's audit log, got %+v, %v", entries, err)
+		}
+	})
+}
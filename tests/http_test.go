@@ -11,463 +11,500 @@ import (
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
 	customhttp "github.com/MonkaKokosowa/watchalong-server/http"
+	"github.com/MonkaKokosowa/watchalong-server/websocket"
 	"github.com/gorilla/mux"
 	_ "modernc.org/sqlite"
 )
 
-func setup(t *testing.T) (*httptest.Server, func()) {
-	PrepareDB()
+func setup(t *testing.T, store api.Store) (*httptest.Server, func()) {
 	router := mux.NewRouter()
-	customhttp.AddRoutes(router)
+	customhttp.AddRoutes(router, store, websocket.NewManager(), testConfig(t))
 	server := httptest.NewServer(router)
 
 	cleanup := func() {
 		server.Close()
-		CleanupDB()
 	}
 
 	return server, cleanup
 }
 
 func TestHTTPGetMovies(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	_, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Get(server.URL + "/movies")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var movies []api.Movie
-	if err := json.Unmarshal(body, &movies); err != nil {
-		t.Fatal(err)
-	}
-
-	if len(movies) != 1 {
-		t.Fatalf("expected 1 movie, got %d", len(movies))
-	}
-
-	if movies[0].Name != newMovie.Name {
-		t.Errorf("expected movie name %s, got %s", newMovie.Name, movies[0].Name)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		_, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/movies")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var movies []api.Movie
+		if err := json.Unmarshal(body, &movies); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 1 {
+			t.Fatalf("expected 1 movie, got %d", len(movies))
+		}
+
+		if movies[0].Name != newMovie.Name {
+			t.Errorf("expected movie name %s, got %s", newMovie.Name, movies[0].Name)
+		}
+	})
 }
 
 func TestHTTPGetMovie(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Get(server.URL + "/movies/" + fmt.Sprintf("%d", id))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var retrievedMovie api.Movie
-	if err := json.Unmarshal(body, &retrievedMovie); err != nil {
-		t.Fatal(err)
-	}
-
-	if retrievedMovie.Name != newMovie.Name {
-		t.Errorf("expected movie name %s, got %s", newMovie.Name, retrievedMovie.Name)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/movies/" + fmt.Sprintf("%d", id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var retrievedMovie api.Movie
+		if err := json.Unmarshal(body, &retrievedMovie); err != nil {
+			t.Fatal(err)
+		}
+
+		if retrievedMovie.Name != newMovie.Name {
+			t.Errorf("expected movie name %s, got %s", newMovie.Name, retrievedMovie.Name)
+		}
+	})
 }
 
 func TestHTTPAddMovie(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-
-	jsonMovie, err := json.Marshal(newMovie)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/add/movie", "application/json", strings.NewReader(string(jsonMovie)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("expected status Created, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var result map[string]int
-	if err := json.Unmarshal(body, &result); err != nil {
-		t.Fatal(err)
-	}
-
-	if _, ok := result["id"]; !ok {
-		t.Errorf("expected id in response, got %v", result)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+
+		jsonMovie, err := json.Marshal(newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/add/movie", "application/json", strings.NewReader(string(jsonMovie)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status Created, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result map[string]int
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := result["id"]; !ok {
+			t.Errorf("expected id in response, got %v", result)
+		}
+	})
 }
 
 func TestHTTPRateMovie(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	rating := struct {
-		MovieID  int     `json:"movieID"`
-		Rating   float64 `json:"rating"`
-		Username string  `json:"username"`
-	}{
-		MovieID:  id,
-		Rating:   5,
-		Username: "test",
-	}
-
-	jsonRating, err := json.Marshal(rating)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/movies/rate", "application/json", strings.NewReader(string(jsonRating)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		t.Fatalf("expected status OK, got %v. Body: %s", resp.Status, string(body))
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rating := struct {
+			MovieID  int     `json:"movieID"`
+			Rating   float64 `json:"rating"`
+			Username string  `json:"username"`
+		}{
+			MovieID:  id,
+			Rating:   5,
+			Username: "test",
+		}
+
+		jsonRating, err := json.Marshal(rating)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/movies/rate", "application/json", strings.NewReader(string(jsonRating)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("expected status OK, got %v. Body: %s", resp.Status, string(body))
+		}
+
+		rating.MovieID = id + 1
+		jsonRating, err = json.Marshal(rating)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err = http.Post(server.URL+"/movies/rate", "application/json", strings.NewReader(string(jsonRating)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status Not Found for an unknown movie, got %v", resp.Status)
+		}
+	})
 }
 
 func TestHTTPAddAlias(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newAlias := api.Alias{
-		Alias:    "Test Alias",
-		Username: "test",
-	}
-
-	jsonAlias, err := json.Marshal(newAlias)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/alias", "application/json", strings.NewReader(string(jsonAlias)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newAlias := api.Alias{
+			Alias:    "Test Alias",
+			Username: "test",
+		}
+
+		jsonAlias, err := json.Marshal(newAlias)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/alias", "application/json", strings.NewReader(string(jsonAlias)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+	})
 }
 
 func TestHTTPGetAliases(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newAlias := api.Alias{
-		Alias:    "Test Alias",
-		Username: "test",
-	}
-	err := newAlias.AddAlias()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Get(server.URL + "/alias")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var aliases []api.Alias
-	if err := json.Unmarshal(body, &aliases); err != nil {
-		t.Fatal(err)
-	}
-
-	if len(aliases) != 1 {
-		t.Fatalf("expected 1 alias, got %d", len(aliases))
-	}
-
-	if aliases[0].Alias != "Test Alias" || aliases[0].Username != "test" {
-		t.Errorf("expected alias 'Test Alias', got %s", aliases[0].Alias)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newAlias := api.Alias{
+			Alias:    "Test Alias",
+			Username: "test",
+		}
+		err := store.AddAlias(&newAlias)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/alias")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var aliases []api.Alias
+		if err := json.Unmarshal(body, &aliases); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(aliases) != 1 {
+			t.Fatalf("expected 1 alias, got %d", len(aliases))
+		}
+
+		if aliases[0].Alias != "Test Alias" || aliases[0].Username != "test" {
+			t.Errorf("expected alias 'Test Alias', got %s", aliases[0].Alias)
+		}
+	})
 }
 
 func TestHTTPAddMovieToQueue(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	body := struct {
-		ID int `json:"id"`
-	}{
-		ID: id,
-	}
-
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/queue/add", "application/json", strings.NewReader(string(jsonBody)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := struct {
+			ID int `json:"id"`
+		}{
+			ID: id,
+		}
+
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/queue/add", "application/json", strings.NewReader(string(jsonBody)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+	})
 }
 
 func TestHTTPRemoveMovieFromQueue(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:         "Test Movie",
-		IsMovie:      true,
-		ProposedBy:   "Test User",
-		Ratings:      "{}",
-		TmdbID:       00000,
-		TmdbImageUrl: "google.com",
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	newMovie.ID = id
-	err = newMovie.AddMovieToQueue()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	body := struct {
-		ID      int  `json:"id"`
-		Watched bool `json:"watched"`
-	}{
-		ID:      id,
-		Watched: true,
-	}
-
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/queue/remove", "application/json", strings.NewReader(string(jsonBody)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:         "Test Movie",
+			IsMovie:      true,
+			ProposedBy:   "Test User",
+			Ratings:      "{}",
+			TmdbID:       00000,
+			TmdbImageUrl: "google.com",
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newMovie.ID = id
+		err = store.AddMovieToQueue(newMovie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := struct {
+			ID      int  `json:"id"`
+			Watched bool `json:"watched"`
+		}{
+			ID:      id,
+			Watched: true,
+		}
+
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/queue/remove", "application/json", strings.NewReader(string(jsonBody)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+	})
 }
 
 func TestHTTPGetQueue(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-	id, err := newMovie.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-	newMovie.ID = id
-
-	err = newMovie.AddMovieToQueue()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Get(server.URL + "/queue")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var movies []api.Movie
-	if err := json.Unmarshal(body, &movies); err != nil {
-		t.Fatal(err)
-	}
-
-	if len(movies) != 1 {
-		t.Fatalf("expected 1 movie in queue, got %d", len(movies))
-	}
-
-	if movies[0].Name != newMovie.Name {
-		t.Errorf("expected movie name %s, got %s", newMovie.Name, movies[0].Name)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+		id, err := store.AddMovie(&newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newMovie.ID = id
+
+		err = store.AddMovieToQueue(newMovie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var movies []api.Movie
+		if err := json.Unmarshal(body, &movies); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 1 {
+			t.Fatalf("expected 1 movie in queue, got %d", len(movies))
+		}
+
+		if movies[0].Name != newMovie.Name {
+			t.Errorf("expected movie name %s, got %s", newMovie.Name, movies[0].Name)
+		}
+	})
 }
 
 func TestHTTPGetCurrentVote(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Get(server.URL + "/vote")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var movies []api.Movie
-	if err := json.Unmarshal(body, &movies); err != nil {
-		t.Fatal(err)
-	}
-
-	if len(movies) != 1 {
-		t.Fatalf("expected 1 movie, got %d", len(movies))
-	}
-
-	if movies[0].Name != movie1.Name {
-		t.Errorf("expected movie name %s, got %s", movie1.Name, movies[0].Name)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/vote")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var movies []api.Movie
+		if err := json.Unmarshal(body, &movies); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 1 {
+			t.Fatalf("expected 1 movie, got %d", len(movies))
+		}
+
+		if movies[0].Name != movie1.Name {
+			t.Errorf("expected movie name %s, got %s", movie1.Name, movies[0].Name)
+		}
+	})
 }
 
 func TestHTTPCastVote(t *testing.T) {
-	server, cleanup := setup(t)
-	defer cleanup()
-
-	movie1 := api.Movie{
-		Name:    "Test Movie 1",
-		IsMovie: true,
-	}
-	id1, err := movie1.AddMovie()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	movieIDs := []int{id1}
-	if err := api.CreateNewVote(movieIDs); err != nil {
-		t.Fatal(err)
-	}
-
-	vote := struct {
-		MovieID int `json:"movie_id"`
-	}{
-		MovieID: id1,
-	}
-
-	jsonVote, err := json.Marshal(vote)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/vote", "application/json", strings.NewReader(string(jsonVote)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status OK, got %v", resp.Status)
-	}
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		movie1 := api.Movie{
+			Name:    "Test Movie 1",
+			IsMovie: true,
+		}
+		id1, err := store.AddMovie(&movie1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIDs := []int{id1}
+		if err := store.CreateNewVote(movieIDs); err != nil {
+			t.Fatal(err)
+		}
+
+		vote := struct {
+			MovieIDs []int  `json:"movie_ids"`
+			Username string `json:"username"`
+		}{
+			MovieIDs: movieIDs,
+			Username: "test",
+		}
+
+		jsonVote, err := json.Marshal(vote)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/vote", "application/json", strings.NewReader(string(jsonVote)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+	})
 }
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+func TestVoteLifecycle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"First", "Second", "Third"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		for _, candidates := range [][]int{{ids[0], ids[0]}, {ids[2] + 100}} {
+			if _, err := api.OpenVote(store, "admin", candidates, time.Time{}); !errors.Is(err, api.ErrInvalidVote) {
+				t.Errorf("OpenVote(%v): expected ErrInvalidVote, got %v", candidates, err)
+			}
+		}
+
+		round, err := api.OpenVote(store, "admin", ids[:2], time.Time{})
+		if err != nil {
+			t.Fatalf("OpenVote() error = %v", err)
+		}
+		if len(round.Candidates) != 2 || round.ClosesAt == nil || !round.ClosesAt.After(time.Now()) {
+			t.Errorf("expected two candidates and the next scheduled deadline, got %+v", round)
+		}
+		if _, err := api.OpenVote(store, "admin", nil, time.Time{}); !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected ErrConflict while a vote is open, got %v", err)
+		}
+
+		if _, err := api.ExtendVote(store, "admin", round.ClosesAt.Add(-time.Hour)); !errors.Is(err, api.ErrInvalidVote) {
+			t.Errorf("expected ErrInvalidVote for an earlier deadline, got %v", err)
+		}
+		extended, err := api.ExtendVote(store, "admin", round.ClosesAt.Add(24*time.Hour))
+		if err != nil {
+			t.Fatalf("ExtendVote() error = %v", err)
+		}
+		if !extended.ClosesAt.Equal(round.ClosesAt.Add(24 * time.Hour)) {
+			t.Errorf("expected the deadline a day later, got %v", extended.ClosesAt)
+		}
+
+		// The scheduler leaves a round running until its deadline.
+		if err := api.RotateVote(store); err != nil {
+			t.Fatal(err)
+		}
+		if current, err := store.GetCurrentVoteRound(); err != nil || current.ID != round.ID {
+			t.Errorf("expected the extended round to keep running, got %+v, %v", current, err)
+		}
+
+		if err := store.CastVote("alice", []int{ids[1], ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+		closed, err := api.CloseVote(store, "admin")
+		if err != nil {
+			t.Fatalf("CloseVote() error = %v", err)
+		}
+		if closed.EndedAt == nil || closed.WinnerID != ids[1] {
+			t.Errorf("expected a closed round won by %d, got %+v", ids[1], closed)
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 2 || queue[0].ID != ids[1] {
+			t.Errorf("expected the results in the queue, got %+v", queue)
+		}
+		if _, err := api.CloseVote(store, "admin"); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound without an open round, got %v", err)
+		}
+
+		if _, err := api.OpenVote(store, "admin", nil, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := api.CancelVote(store, "admin"); err != nil {
+			t.Fatalf("CancelVote() error = %v", err)
+		}
+		rounds, err := store.GetVoteRounds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rounds) != 2 || !rounds[0].Cancelled || rounds[0].WinnerID != 0 || len(rounds[0].Candidates) != 0 {
+			t.Errorf("expected a cancelled round without results, got %+v", rounds[0])
+		}
+		if queue, _ := store.GetQueue(); len(queue) != 2 {
+			t.Errorf("expected cancelling to leave the queue alone, got %+v", queue)
+		}
+
+		entries, err := store.GetAuditLog(api.AuditFilter{Actor: "admin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 5 {
+			t.Errorf("expected open, extend, close, open and cancel entries, got %+v", entries)
+		}
+	})
+}
+
+func TestHTTPVoteLifecycle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		id, err := store.AddMovie(&api.Movie{Name: "Test Movie", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/admin/vote/close", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status Not Found without an open vote, got %v", resp.Status)
+		}
+
+		resp, err = http.Post(server.URL+"/admin/vote/open", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var round api.VoteRound
+		if err := json.NewDecoder(resp.Body).Decode(&round); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated || len(round.Candidates) != 1 || round.Candidates[0].MovieID != id {
+			t.Fatalf("expected a random vote on the only movie, got %v %+v", resp.Status, round)
+		}
+
+		resp, err = http.Post(server.URL+"/admin/vote/extend", "application/json", strings.NewReader(`{"closes_at": "2000-01-01T00:00:00Z"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for a past deadline, got %v", resp.Status)
+		}
+
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/groups/default/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+		closesAt := time.Now().AddDate(1, 0, 0).UTC().Truncate(time.Second)
+		resp, err = http.Post(server.URL+"/admin/vote/extend", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"closes_at": %q}`, closesAt.Format(time.RFC3339))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK for a later deadline, got %v", resp.Status)
+		}
+		var update struct {
+			Participation *api.Participation `json:"participation"`
+		}
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := ws.ReadJSON(&update); err != nil {
+			t.Fatal(err)
+		}
+		if update.Participation == nil || update.Participation.ClosesAt == nil || !update.Participation.ClosesAt.Equal(closesAt) {
+			t.Errorf("expected the new deadline %v to be broadcast, got %+v", closesAt, update.Participation)
+		}
+
+		resp, err = http.Post(server.URL+"/admin/vote/cancel", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected status No Content, got %v", resp.Status)
+		}
+		if _, err := store.GetCurrentVoteRound(); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected no open round after cancelling, got %v", err)
+		}
+	})
+}
@@ -1,33 +1,95 @@
 package tests
 
 import (
+	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/config"
 	"github.com/MonkaKokosowa/watchalong-server/database"
 )
 
-func PrepareDB() {
-	database.InitializeDB("testing.sqlite")
-	api.ClearMovies()
-	api.ClearAliases()
-	api.ClearVotes()
-	api.ClearCurrentVote()
+// storeFactories lists every Store implementation the suite runs against.
+// Each call must return a fresh, empty store.
+var storeFactories = []struct {
+	name     string
+	newStore func(t *testing.T) api.Store
+}{
+	{"sqlite", newSQLiteStore},
+	{"postgres", newPostgresStore},
+	{"memory", func(t *testing.T) api.Store { return api.NewMemoryStore() }},
 }
 
-func CleanupDB() {
-	database.CloseDatabase()
+func newSQLiteStore(t *testing.T) api.Store {
+	store, err := api.OpenSQLiteStore(filepath.Join(t.TempDir(), "testing.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
 }
 
-func TestMain(m *testing.M) {
-	database.InitializeDB("testing.sqlite")
+// newPostgresStore runs the test inside a throwaway schema of the database
+// named by WATCHALONG_TEST_POSTGRES_DSN, e.g. the container from
+// docker-compose.test.yml. The test is skipped when the variable is unset.
+func newPostgresStore(t *testing.T) api.Store {
+	dsn := os.Getenv("WATCHALONG_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("WATCHALONG_TEST_POSTGRES_DSN not set")
+	}
 
-	code := m.Run()
+	admin, err := database.Open(database.Postgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
 
-	database.CloseDatabase()
+	schema := fmt.Sprintf("test_%d", rand.Int63())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
 
-	os.Remove("testing.sqlite")
+	store, err := api.OpenPostgresStore(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// withSearchPath adds a search_path parameter to a URL or key=value DSN.
+func withSearchPath(dsn string, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		return dsn + separator + "search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
+
+// testConfig returns a configuration that keeps every file the server writes
+// inside the test's temporary directory.
+func testConfig(t *testing.T) config.Config {
+	return config.Config{
+		BackupDir:       filepath.Join(t.TempDir(), "backups"),
+		BackupRetention: 7,
+	}
+}
 
-	os.Exit(code)
+// forEachStore runs test in parallel against every Store implementation.
+func forEachStore(t *testing.T, test func(t *testing.T, store api.Store)) {
+	t.Parallel()
+	for _, factory := range storeFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			t.Parallel()
+			test(t, factory.newStore(t))
+		})
+	}
 }
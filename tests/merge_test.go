@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+func TestAddMovieRejectsDuplicates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		id, err := store.AddMovie(&api.Movie{Name: "Alien", IsMovie: true, TmdbID: 348})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.AddMovie(&api.Movie{Name: "Alien (1979)", IsMovie: true, TmdbID: 348})
+		var duplicate *api.DuplicateMovieError
+		if !errors.As(err, &duplicate) || duplicate.ExistingID != id {
+			t.Fatalf("expected duplicate of movie %d, got %v", id, err)
+		}
+		if !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected duplicate error to match ErrConflict")
+		}
+
+		// The same TMDB id as a series, or no TMDB id at all, is not a duplicate.
+		for _, movie := range []api.Movie{
+			{Name: "Alien", IsMovie: false, TmdbID: 348},
+			{Name: "Alien", IsMovie: true},
+			{Name: "Alien", IsMovie: true},
+		} {
+			if _, err := store.AddMovie(&movie); err != nil {
+				t.Errorf("AddMovie(%+v) error = %v", movie, err)
+			}
+		}
+
+		if err := store.DeleteMovie(id, "test"); err != nil {
+			t.Fatal(err)
+		}
+		newID, err := store.AddMovie(&api.Movie{Name: "Alien (1979)", IsMovie: true, TmdbID: 348})
+		if err != nil {
+			t.Fatalf("expected trashed movie not to block AddMovie, got %v", err)
+		}
+		if err := store.RestoreMovie(id); !errors.As(err, &duplicate) || duplicate.ExistingID != newID {
+			t.Errorf("expected restore to be refused as a duplicate of %d, got %v", newID, err)
+		}
+	})
+}
+
+func TestMergeMovies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"First", "Canonical", "Duplicate", "Last", "Other"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		canonical, duplicate := ids[1], ids[2]
+		for _, id := range []int{ids[0], duplicate, ids[3], canonical} {
+			if err := store.AddMovieToQueue(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.RateMovie(canonical, "alice", 5); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(duplicate, "alice", 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RateMovie(duplicate, "bob", 3); err != nil {
+			t.Fatal(err)
+		}
+		other := ids[4]
+		if err := store.CreateNewVote([]int{canonical, duplicate, other}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("alice", []int{duplicate, other}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("bob", []int{other, canonical, duplicate}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.MergeMovies(canonical, canonical); !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected ErrConflict merging a movie into itself, got %v", err)
+		}
+		if err := store.MergeMovies(canonical, duplicate); err != nil {
+			t.Fatalf("MergeMovies() error = %v", err)
+		}
+
+		if _, err := store.GetMovie(duplicate); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected duplicate to be gone, got %v", err)
+		}
+		movie, err := store.GetMovie(canonical)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.Ratings != `{"alice":5,"bob":3}` {
+			t.Errorf("expected merged ratings, got %s", movie.Ratings)
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var order []int
+		for _, queued := range queue {
+			order = append(order, queued.ID)
+		}
+		if len(order) != 3 || order[0] != ids[0] || order[1] != canonical || order[2] != ids[3] || queue[2].QueuePosition.Int64 != 3 {
+			t.Errorf("expected canonical at the duplicate's position, got %v", order)
+		}
+
+		tallies, err := store.GetVoteTallies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// alice now ranks [canonical, other] and bob [other, canonical].
+		if len(tallies) != 2 || tallies[0].MovieID != canonical || tallies[0].Votes != 1 || tallies[1].Votes != 1 {
+			t.Errorf("expected ballots folded into the canonical movie, got %+v", tallies)
+		}
+		vote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote) != 2 || vote[0].ID != canonical {
+			t.Errorf("expected the duplicate gone from the vote, got %+v", vote)
+		}
+	})
+}
+
+func TestMergeIntoWatchedMovie(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 3)
+		canonicalID, err := store.AddMovie(&api.Movie{Name: "Watched", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddMovieToQueue(canonicalID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.FinishMovie(canonicalID); err != nil {
+			t.Fatal(err)
+		}
+		queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForQueue(queueID).AddMovieToQueue(ids[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.MergeMovies(canonicalID, ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		for _, queueStore := range []api.Store{store, store.ForQueue(queueID)} {
+			queue, err := queueStore.GetQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, movie := range queue {
+				if movie.ID == canonicalID {
+					t.Errorf("expected the watched movie to stay out of queue %d, got %+v", queueStore.QueueID(), queue)
+				}
+			}
+			if report, err := queueStore.CheckQueue(); err != nil || len(report.Problems) != 0 {
+				t.Errorf("expected queue %d to stay clean, got %+v, %v", queueStore.QueueID(), report, err)
+			}
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint([]int{ids[0], ids[2]}) {
+			t.Errorf("expected the duplicate's place to close, got %v", got)
+		}
+	})
+}
+
+func TestHTTPAddDuplicateMovie(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		id, err := store.AddMovie(&api.Movie{Name: "Alien", IsMovie: true, TmdbID: 348})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := json.Marshal(api.Movie{Name: "Alien", IsMovie: true, TmdbID: 348})
+		resp, err := http.Post(server.URL+"/add/movie", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("expected status Conflict, got %v", resp.Status)
+		}
+		var conflict struct {
+			ExistingID int `json:"existing_id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&conflict); err != nil {
+			t.Fatal(err)
+		}
+		if conflict.ExistingID != id {
+			t.Errorf("expected existing_id %d, got %d", id, conflict.ExistingID)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "fresh.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != database.LatestVersion() {
+		t.Errorf("got schema version %d, want %d", version, database.LatestVersion())
+	}
+
+	// Running again must be a no-op.
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+}
+
+func TestOpenSQLiteURI(t *testing.T) {
+	db, err := database.Open(database.SQLite, "file:"+filepath.Join(t.TempDir(), "uri.sqlite")+"?mode=rwc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var timeout int
+	if err := db.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 5000 {
+		t.Errorf("expected a busy timeout of 5000ms, got %d", timeout)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "roundtrip.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MigrateTo(db, 0); err != nil {
+		t.Fatalf("MigrateTo(0) error = %v", err)
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("got schema version %d, want 0", version)
+	}
+
+	if _, err := db.Exec(`SELECT 1 FROM movies`); err == nil {
+		t.Errorf("movies table should have been dropped")
+	}
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() after down error = %v", err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "legacy.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Schema as created before versioned migrations existed.
+	if _, err := db.Exec(`CREATE TABLE movies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		watched BOOLEAN NOT NULL DEFAULT 0,
+		is_movie BOOLEAN NOT NULL,
+		proposed_by TEXT NOT NULL,
+		ratings TEXT NOT NULL DEFAULT '{}',
+		queue_position INTEGER,
+		tmdb_id INTEGER NOT NULL,
+		tmdb_image_url TEXT NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO movies (name, is_movie, proposed_by, tmdb_id, tmdb_image_url) VALUES ('Legacy', 1, 'test', 1, '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM movies`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d movies after migration, want 1", count)
+	}
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "unknown.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := database.MigrateTo(db, database.LatestVersion()+1); err == nil {
+		t.Errorf("MigrateTo() beyond latest version should fail")
+	}
+}
+
+func TestMigrateRatingsBlobs(t *testing.T) {
+	db, err := database.Open(database.SQLite, filepath.Join(t.TempDir(), "ratings.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := database.MigrateTo(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO movies (name, is_movie, proposed_by, ratings, tmdb_id, tmdb_image_url) VALUES ('Rated', 1, 'test', '{"alice":4,"bob":2.5}', 1, '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	store := api.NewSQLStore(db)
+	ratings, err := store.GetMovieRatings(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ratings) != 2 {
+		t.Fatalf("got %d ratings, want 2", len(ratings))
+	}
+	if ratings[0].Username != "alice" || ratings[0].Score != 4 || ratings[1].Username != "bob" || ratings[1].Score != 2.5 {
+		t.Errorf("got ratings %+v", ratings)
+	}
+
+	movie, err := store.GetMovie(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Ratings != `{"alice":4,"bob":2.5}` {
+		t.Errorf("got ratings %s, want {\"alice\":4,\"bob\":2.5}", movie.Ratings)
+	}
+
+	// Going back down restores the blob column.
+	if err := database.MigrateTo(db, 1); err != nil {
+		t.Fatalf("MigrateTo(1) error = %v", err)
+	}
+	var blob string
+	if err := db.QueryRow(`SELECT ratings FROM movies WHERE id = 1`).Scan(&blob); err != nil {
+		t.Fatal(err)
+	}
+	if blob == "{}" {
+		t.Errorf("ratings blob was not restored")
+	}
+}
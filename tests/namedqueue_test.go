@@ -0,0 +1,421 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+)
+
+func TestNamedQueues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 3)
+
+		horror := api.NamedQueue{Slug: "october-horror", Name: "October horror"}
+		horrorID, err := store.CreateQueue(&horror)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.CreateQueue(&api.NamedQueue{Slug: "october-horror"}); !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected ErrConflict for a repeated slug, got %v", err)
+		}
+		if err := (&api.NamedQueue{Slug: api.MainQueueSlug}).Validate(); err == nil {
+			t.Error("expected the main queue slug to be rejected")
+		}
+
+		named := store.ForQueue(horrorID)
+		for _, id := range []int{ids[2], ids[0]} {
+			if err := named.AddMovieToQueue(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := named.AddMovieToQueue(ids[0]); !errors.Is(err, api.ErrConflict) {
+			t.Errorf("expected ErrConflict for a movie already in the named queue, got %v", err)
+		}
+		if err := named.MoveInQueue(ids[0], 1); err != nil {
+			t.Fatal(err)
+		}
+		queue, err := named.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint([]int{ids[0], ids[2]}) {
+			t.Errorf("expected the named queue in its own order, got %v", got)
+		}
+		if main, err := store.GetQueue(); err != nil || len(main) != 3 {
+			t.Errorf("expected the main queue to keep its 3 movies, got %d, %v", len(main), err)
+		}
+
+		if err := store.FinishMovie(ids[0]); err != nil {
+			t.Fatal(err)
+		}
+		if queue, err = named.GetQueue(); err != nil || fmt.Sprint(queueOrder(t, queue)) != fmt.Sprint([]int{ids[2]}) {
+			t.Errorf("expected a watched movie to leave every queue, got %v, %v", queue, err)
+		}
+
+		horror.Name = "Spooky season"
+		if err := store.UpdateQueue(&horror); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := store.GetNamedQueue("october-horror"); err != nil || got.Name != "Spooky season" {
+			t.Errorf("expected the renamed queue, got %+v, %v", got, err)
+		}
+		if err := store.DeleteQueue(horrorID); err != nil {
+			t.Fatal(err)
+		}
+		if queues, err := store.GetQueues(); err != nil || len(queues) != 0 {
+			t.Errorf("expected no queues after the delete, got %+v, %v", queues, err)
+		}
+		if _, err := api.QueueStore(store, "october-horror"); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a deleted queue, got %v", err)
+		}
+	})
+}
+
+func TestVoteWinnerGoesToTargetQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := candidateGroup(t, store, api.CandidatesUniform, 2, "a", "b")
+		queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		group, err := store.GetGroup("candidates-uniform")
+		if err != nil {
+			t.Fatal(err)
+		}
+		group.WinnerQueueID = queueID
+		group.QueueWinners = 1
+		if err := store.UpdateGroup(&group); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := api.OpenVote(store, "admin", ids, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CastVote("alice", []int{ids[1], ids[0]}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.CloseVote(store, "admin"); err != nil {
+			t.Fatal(err)
+		}
+
+		queue, err := store.ForQueue(queueID).GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 1 || queue[0].ID != ids[1] {
+			t.Errorf("expected the winner in the target queue, got %+v", queue)
+		}
+		if main, err := store.GetQueue(); err != nil || len(main) != 0 {
+			t.Errorf("expected the main queue to stay empty, got %+v, %v", main, err)
+		}
+	})
+}
+
+func TestHTTPNamedQueues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := queuedGroup(t, store, 2)
+		groupURL := server.URL + "/groups/queue"
+		send := func(method, path, body string) *http.Response {
+			req, err := http.NewRequest(method, groupURL+path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		}
+
+		resp := send(http.MethodPost, "/admin/queues", `{"slug": "binge", "name": "Series to binge"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status Created, got %d", resp.StatusCode)
+		}
+		resp = send(http.MethodPost, "/admin/queues", `{"slug": "main"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for the main slug, got %d", resp.StatusCode)
+		}
+
+		resp = send(http.MethodPost, "/queue/add?queue=binge", fmt.Sprintf(`{"id": %d}`, ids[1]))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", resp.StatusCode)
+		}
+		resp = send(http.MethodGet, "/queue?queue=binge", "")
+		var queue []api.Movie
+		if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(queue) != 1 || queue[0].ID != ids[1] {
+			t.Errorf("expected the movie in the named queue, got %+v", queue)
+		}
+		resp = send(http.MethodGet, "/queue?queue=unknown", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status Not Found for an unknown queue, got %d", resp.StatusCode)
+		}
+
+		resp = send(http.MethodPut, "/admin/queues/binge", `{"slug": "binge-later"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status OK for the rename, got %d", resp.StatusCode)
+		}
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/admin/groups/queue", strings.NewReader(`{"winner_queue_id": 9999}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for an unknown winner queue, got %d", resp.StatusCode)
+		}
+		resp = send(http.MethodDelete, "/admin/queues/binge-later", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected status No Content, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestCompactNamedQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testing.sqlite")
+	store, err := api.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var ids []int
+	for i := range 3 {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave position 1 empty, storing the later movie first so the
+	// compaction meets it before the earlier one.
+	db, err := database.Open(database.SQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, item := range [][2]int{{ids[1], 3}, {ids[0], 2}} {
+		if _, err := db.Exec(`INSERT INTO queue_items (queue_id, movie_id, position, added_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
+			queueID, item[0], item[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Finishing any movie of the group compacts its named queues.
+	if err := store.FinishMovie(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	named := store.ForQueue(queueID)
+	if report, err := named.CheckQueue(); err != nil || len(report.Problems) != 0 {
+		t.Errorf("expected a clean queue after the compaction, got %+v, %v", report, err)
+	}
+	queue, err := named.GetQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint(ids[:2]) {
+		t.Errorf("expected %v, got %v", ids[:2], got)
+	}
+}
+
+func TestRepairNamedQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testing.sqlite")
+	store, err := api.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var ids []int
+	for i := range 2 {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ids[0] sits before position 1 and the item at position 2 points at a
+	// movie that no longer exists.
+	db, err := database.Open(database.SQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	missing := ids[1] + 100
+	for _, item := range [][2]int{{ids[0], 0}, {ids[1], 1}, {missing, 2}} {
+		if _, err := db.Exec(`INSERT INTO queue_items (queue_id, movie_id, position, added_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
+			queueID, item[0], item[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	named := store.ForQueue(queueID)
+	want := []api.QueueProblem{
+		{Kind: api.QueueGap, Position: 0, MovieID: ids[0]},
+		{Kind: api.QueueDeleted, Position: 2, MovieID: missing},
+	}
+	report, err := named.CheckQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(report.Problems) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %+v", want, report)
+	}
+	if report, err = named.RepairQueue(); err != nil || fmt.Sprint(report.Queue) != fmt.Sprint(ids) {
+		t.Errorf("expected the live movies to stay queued in order, got %+v, %v", report, err)
+	}
+	if report, err = named.CheckQueue(); err != nil || len(report.Problems) != 0 {
+		t.Errorf("expected no problems after the repair, got %+v, %v", report, err)
+	}
+}
+
+func TestFinishMovieFromNamedQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		store, ids := queuedGroup(t, store, 3)
+		queueID, err := store.CreateQueue(&api.NamedQueue{Slug: "later"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		named := store.ForQueue(queueID)
+		for _, id := range ids {
+			if err := named.AddMovieToQueue(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resp, err := http.Post(server.URL+"/groups/queue/queue/remove?queue=later", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"id": %d, "watched": true}`, ids[1])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", resp.StatusCode)
+		}
+
+		for name, queue := range map[string]api.Store{"main": store, "named": named} {
+			if report, err := queue.CheckQueue(); err != nil || len(report.Problems) != 0 {
+				t.Errorf("%s: expected a clean queue, got %+v, %v", name, report, err)
+			}
+			movies, err := queue.GetQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queueOrder(t, movies); fmt.Sprint(got) != fmt.Sprint([]int{ids[0], ids[2]}) {
+				t.Errorf("%s: expected %v, got %v", name, []int{ids[0], ids[2]}, got)
+			}
+		}
+	})
+}
+
+func TestNamedQueuesStayInTheirGroup(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		otherID, err := store.CreateGroup(&api.Group{Slug: "other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		queueID, err := store.ForGroup(otherID).CreateQueue(&api.NamedQueue{Slug: "theirs"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		grouped, ids := queuedGroup(t, store, 1)
+
+		foreign := grouped.ForQueue(queueID)
+		if err := foreign.AddMovieToQueue(ids[0]); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another group's queue, got %v", err)
+		}
+		if queue, err := store.ForGroup(otherID).ForQueue(queueID).GetQueue(); err != nil || len(queue) != 0 {
+			t.Errorf("expected the other group's queue to stay empty, got %+v, %v", queue, err)
+		}
+
+		resp, err := http.Post(server.URL+"/admin/groups", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"slug": "new", "winner_queue_id": %d}`, queueID)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for another group's winner queue, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestAuditNamedQueues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 1)
+		audited := api.WithAudit(store, "alice")
+
+		queue := api.NamedQueue{Slug: "later"}
+		queueID, err := audited.CreateQueue(&queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue.Name = "Later"
+		if err := audited.UpdateQueue(&queue); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ForQueue(queueID).AddMovieToQueue(ids[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := audited.DeleteQueue(queueID); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := store.GetAuditLog(api.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{api.AuditDeleteQueue, api.AuditUpdateQueue, api.AuditCreateQueue}
+		if len(entries) != len(want) {
+			t.Fatalf("expected %d entries, got %+v", len(want), entries)
+		}
+		for i, entry := range entries {
+			if entry.Action != want[i] || entry.Actor != "alice" {
+				t.Errorf("entry %d: expected %s by alice, got %s by %s", i, want[i], entry.Action, entry.Actor)
+			}
+		}
+		var deleted struct {
+			Queue  api.NamedQueue `json:"queue"`
+			Movies []int          `json:"movies"`
+		}
+		if err := json.Unmarshal(entries[0].Before, &deleted); err != nil {
+			t.Fatal(err)
+		}
+		if deleted.Queue.Slug != "later" || fmt.Sprint(deleted.Movies) != fmt.Sprint(ids) {
+			t.Errorf("expected the deleted queue and its movies in the entry, got %s", entries[0].Before)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+func TestNominationPhase(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := candidateGroup(t, store, api.CandidatesUniform, 3, "a", "b", "c", "d", "e")
+
+		round, err := api.OpenNominations(store, "admin", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if round.Phase != api.PhaseNominating || round.ClosesAt == nil || len(round.Candidates) != 0 {
+			t.Errorf("expected a nominating round without candidates, got %+v", round)
+		}
+		if err := store.CastVote("alice", []int{ids[0]}); err == nil {
+			t.Error("expected ballots to be rejected while nominating")
+		}
+
+		for _, nomination := range []struct {
+			username string
+			movieID  int
+		}{{"alice", ids[3]}, {"alice", ids[4]}, {"alice", ids[4]}, {"bob", ids[4]}} {
+			if err := store.Nominate(nomination.username, nomination.movieID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.Nominate("alice", ids[0]); !errors.Is(err, api.ErrNominationLimit) {
+			t.Errorf("expected ErrNominationLimit for a third nomination, got %v", err)
+		}
+		if err := store.Nominate("bob", 9999); !errors.Is(err, api.ErrInvalidVote) {
+			t.Errorf("expected ErrInvalidVote for an unknown movie, got %v", err)
+		}
+		nominations, err := store.GetNominations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nominations) != 3 {
+			t.Errorf("expected 3 nominations, got %+v", nominations)
+		}
+
+		round, err = api.CloseNominations(store, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if round.Phase != api.PhaseVoting {
+			t.Errorf("expected the round to be voting, got %q", round.Phase)
+		}
+		vote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote) != 3 || vote[0].ID != ids[4] || vote[1].ID != ids[3] || vote[2].ID == ids[3] || vote[2].ID == ids[4] {
+			t.Errorf("expected the most nominated movies topped up to 3, got %+v", vote)
+		}
+		if err := store.Nominate("bob", ids[0]); !errors.Is(err, api.ErrNotNominating) {
+			t.Errorf("expected ErrNotNominating once voting opened, got %v", err)
+		}
+		if err := store.CastVote("alice", []int{ids[4]}); err != nil {
+			t.Errorf("expected ballots once voting opened, got %v", err)
+		}
+	})
+}
+
+func TestHTTPNominations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := candidateGroup(t, store, api.CandidatesUniform, 2, "a", "b", "c")
+		groupURL := server.URL + "/groups/candidates-uniform"
+
+		wsURL := "ws" + strings.TrimPrefix(groupURL, "http") + "/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+		// readEvent skips the state updates between events.
+		readEvent := func() (event struct {
+			Event      string         `json:"event"`
+			Round      api.VoteRound  `json:"round"`
+			Nomination api.Nomination `json:"nomination"`
+		}) {
+			for event.Event == "" {
+				if err := ws.ReadJSON(&event); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return event
+		}
+		post := func(path, body string) int {
+			resp, err := http.Post(groupURL+path, "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		if status := post("/admin/vote/nominations/open", ""); status != http.StatusCreated {
+			t.Fatalf("expected status Created, got %d", status)
+		}
+		if event := readEvent(); event.Event != "nominations_open" || event.Round.Phase != api.PhaseNominating {
+			t.Errorf("expected nominations_open, got %+v", event)
+		}
+
+		if status := post("/vote/nominate", fmt.Sprintf(`{"movie_id": %d, "username": "alice"}`, ids[1])); status != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", status)
+		}
+		if event := readEvent(); event.Event != "nomination" || event.Nomination.MovieID != ids[1] || event.Nomination.Username != "alice" {
+			t.Errorf("expected the nomination to be broadcast, got %+v", event)
+		}
+
+		resp, err := http.Get(groupURL + "/vote/nominations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nominations []api.Nomination
+		if err := json.NewDecoder(resp.Body).Decode(&nominations); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(nominations) != 1 || nominations[0].MovieID != ids[1] {
+			t.Errorf("expected alice's nomination, got %+v", nominations)
+		}
+
+		if status := post("/admin/vote/nominations/close", ""); status != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", status)
+		}
+		if event := readEvent(); event.Event != "voting_open" || event.Round.Phase != api.PhaseVoting || len(event.Round.Candidates) != 2 {
+			t.Errorf("expected voting_open on two candidates, got %+v", event)
+		}
+		if status := post("/vote/nominate", fmt.Sprintf(`{"movie_id": %d, "username": "bob"}`, ids[0])); status != http.StatusConflict {
+			t.Errorf("expected status Conflict once voting opened, got %d", status)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/database"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+// queuedGroup queues count new movies in a new group, reached under
+// /groups/queue, and returns their ids in queue order.
+func queuedGroup(t *testing.T, store api.Store, count int) (api.Store, []int) {
+	groupID, err := store.CreateGroup(&api.Group{Slug: "queue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = store.ForGroup(groupID)
+
+	var ids []int
+	for i := range count {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddMovieToQueue(id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return store, ids
+}
+
+// queueOrder returns the ids of the queue, checking that its positions run
+// from 1 without gaps.
+func queueOrder(t *testing.T, queue []api.Movie) []int {
+	var ids []int
+	for i, movie := range queue {
+		if movie.QueuePosition.Int64 != int64(i+1) {
+			t.Errorf("expected %s at position %d, got %d", movie.Name, i+1, movie.QueuePosition.Int64)
+		}
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+func TestReorderQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 4)
+		extra, err := store.AddMovie(&api.Movie{Name: "Unqueued", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		steps := []struct {
+			name    string
+			reorder func() error
+			want    []int
+		}{
+			{"move to front", func() error { return store.MoveInQueue(ids[3], 1) }, []int{ids[3], ids[0], ids[1], ids[2]}},
+			{"move to back", func() error { return store.MoveInQueue(ids[3], 4) }, []int{ids[0], ids[1], ids[2], ids[3]}},
+			{"swap", func() error { return store.SwapInQueue(ids[0], ids[2]) }, []int{ids[2], ids[1], ids[0], ids[3]}},
+			{"reorder", func() error { return store.ReorderQueue([]int{ids[1], ids[3], ids[0], ids[2]}) }, []int{ids[1], ids[3], ids[0], ids[2]}},
+		}
+		for _, step := range steps {
+			if err := step.reorder(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			queue, err := store.GetQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint(step.want) {
+				t.Errorf("%s: expected %v, got %v", step.name, step.want, got)
+			}
+		}
+
+		for name, err := range map[string]error{
+			"position 0":       store.MoveInQueue(ids[0], 0),
+			"position 5":       store.MoveInQueue(ids[0], 5),
+			"missing movie":    store.ReorderQueue([]int{ids[0], ids[1], ids[2]}),
+			"repeated movie":   store.ReorderQueue([]int{ids[0], ids[0], ids[1], ids[2]}),
+			"unqueued in list": store.ReorderQueue([]int{ids[0], ids[1], ids[2], extra}),
+		} {
+			if !errors.Is(err, api.ErrInvalidQueueOrder) {
+				t.Errorf("%s: expected ErrInvalidQueueOrder, got %v", name, err)
+			}
+		}
+		if err := store.SwapInQueue(ids[0], extra); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for an unqueued movie, got %v", err)
+		}
+	})
+}
+
+func TestHTTPReorderQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := queuedGroup(t, store, 3)
+		groupURL := server.URL + "/groups/queue"
+
+		wsURL := "ws" + strings.TrimPrefix(groupURL, "http") + "/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+
+		req, err := http.NewRequest(http.MethodPut, groupURL+"/queue", strings.NewReader(fmt.Sprintf(`{"ids": [%d, %d, %d]}`, ids[2], ids[0], ids[1])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var queue []api.Movie
+		if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		want := fmt.Sprint([]int{ids[2], ids[0], ids[1]})
+		if got := queueOrder(t, queue); fmt.Sprint(got) != want {
+			t.Errorf("expected the new order %s, got %v", want, got)
+		}
+
+		var update struct {
+			Queue []api.Movie `json:"queue"`
+		}
+		if err := ws.ReadJSON(&update); err != nil {
+			t.Fatal(err)
+		}
+		if got := queueOrder(t, update.Queue); fmt.Sprint(got) != want {
+			t.Errorf("expected the new order to be broadcast, got %v", got)
+		}
+
+		resp, err = http.Post(groupURL+"/queue/move", "application/json", strings.NewReader(fmt.Sprintf(`{"id": %d, "position": 9}`, ids[0])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status Bad Request for a position past the end, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestAddMovieToQueueRejectsInvalid(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		store, ids := queuedGroup(t, store, 1)
+		watched, err := store.AddMovie(&api.Movie{Name: "Watched", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.FinishMovie(watched); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, id := range map[string]int{"queued": ids[0], "watched": watched} {
+			if err := store.AddMovieToQueue(id); !errors.Is(err, api.ErrConflict) {
+				t.Errorf("%s: expected ErrConflict, got %v", name, err)
+			}
+			resp, err := http.Post(server.URL+"/groups/queue/queue/add", "application/json", strings.NewReader(fmt.Sprintf(`{"id": %d}`, id)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusConflict {
+				t.Errorf("%s: expected status Conflict, got %d", name, resp.StatusCode)
+			}
+		}
+		if err := store.AddMovieToQueue(9999); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for an unknown movie, got %v", err)
+		}
+	})
+}
+
+func TestRepairQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testing.sqlite")
+	store, err := api.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var ids []int
+	for i := range 5 {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Break the queue behind the store's back: ids[1] and ids[2] share
+	// position 2, position 4 is missing, ids[3] is watched and ids[4] is in
+	// the trash.
+	db, err := database.Open(database.SQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range []string{
+		fmt.Sprintf(`UPDATE movies SET queue_position = 1 WHERE id = %d`, ids[0]),
+		fmt.Sprintf(`UPDATE movies SET queue_position = 2 WHERE id IN (%d, %d)`, ids[1], ids[2]),
+		fmt.Sprintf(`UPDATE movies SET queue_position = 3, watched = TRUE WHERE id = %d`, ids[3]),
+		fmt.Sprintf(`UPDATE movies SET queue_position = 5, deleted_at = CURRENT_TIMESTAMP WHERE id = %d`, ids[4]),
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []api.QueueProblem{
+		{Kind: api.QueueDuplicatePosition, Position: 2, MovieID: ids[2]},
+		{Kind: api.QueueWatched, Position: 3, MovieID: ids[3]},
+		{Kind: api.QueueGap, Position: 4},
+		{Kind: api.QueueDeleted, Position: 5, MovieID: ids[4]},
+	}
+	report, err := store.CheckQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(report.Problems) != fmt.Sprint(want) || report.Repaired {
+		t.Errorf("expected %v, got %+v", want, report)
+	}
+
+	if report, err = store.RepairQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Repaired || fmt.Sprint(report.Queue) != fmt.Sprint(ids[:3]) {
+		t.Errorf("expected the live movies to stay queued in order, got %+v", report)
+	}
+	queue, err := store.GetQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint(ids[:3]) {
+		t.Errorf("expected the repaired queue %v, got %v", ids[:3], got)
+	}
+	if report, err = store.CheckQueue(); err != nil || len(report.Problems) != 0 {
+		t.Errorf("expected no problems after the repair, got %+v, %v", report, err)
+	}
+}
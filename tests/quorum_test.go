@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+func TestVoteWithoutQuorum(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := tiedVote(t, store, api.Group{Slug: "quorum", Quorum: 5})
+
+		participation, err := api.GetParticipation(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if participation.Ballots != 4 || participation.Quorum != 5 || participation.ClosesAt == nil {
+			t.Errorf("unexpected participation %+v", participation)
+		}
+
+		round, err := api.CloseVote(store, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !round.NoQuorum || round.WinnerID != 0 || len(round.Candidates) != 3 {
+			t.Errorf("expected a round without quorum that keeps its results, got %+v", round)
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 0 {
+			t.Errorf("expected nothing to be queued, got %+v", queue)
+		}
+		stats, err := store.GetMovieVoteStats(ids[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Rounds != 0 {
+			t.Errorf("expected rounds without quorum to stay out of the stats, got %+v", stats)
+		}
+	})
+}
+
+func TestHTTPVoteClosesWhenEveryoneVoted(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		var ids []int
+		for _, name := range []string{"alice", "bob"} {
+			if err := store.AddAlias(&api.Alias{Username: name, Alias: name}); err != nil {
+				t.Fatal(err)
+			}
+			id, err := store.AddMovie(&api.Movie{Name: "Movie of " + name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if _, err := api.OpenVote(store, "admin", ids, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		vote := func(username string) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/vote", strings.NewReader(fmt.Sprintf(`{"movie_ids": [%d, %d]}`, ids[1], ids[0])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Watchalong-User", username)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status OK, got %v", resp.Status)
+			}
+		}
+
+		vote("alice")
+		vote("carol")
+		participation, err := api.GetParticipation(store)
+		if err != nil {
+			t.Fatalf("expected the round to stay open until bob votes: %v", err)
+		}
+		if participation.Voted != 1 || participation.Registered != 2 || participation.Ballots != 2 {
+			t.Errorf("unexpected participation %+v", participation)
+		}
+
+		vote("bob")
+		if _, err := store.GetCurrentVoteRound(); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected the round to close once every alias voted, got %v", err)
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 2 || queue[0].ID != ids[1] {
+			t.Errorf("expected the results to be queued, got %+v", queue)
+		}
+	})
+}
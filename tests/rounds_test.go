@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+func TestVoteRoundArchive(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		a, b, c := castBallots(t, store)
+
+		rounds, err := store.GetVoteRounds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rounds) != 1 || rounds[0].EndedAt != nil || rounds[0].WinnerID != 0 {
+			t.Fatalf("expected one open round, got %+v", rounds)
+		}
+		if len(rounds[0].Candidates) != 3 || rounds[0].Candidates[0].MovieID != b {
+			t.Errorf("expected the open round to show the live ranking, got %+v", rounds[0].Candidates)
+		}
+		first := rounds[0].ID
+
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateNewVote([]int{a, c}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+
+		rounds, err = store.GetVoteRounds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rounds) != 2 || rounds[0].ID == first || rounds[1].ID != first {
+			t.Fatalf("expected two rounds newest first, got %+v", rounds)
+		}
+		if rounds[0].WinnerID != a || rounds[0].Ballots != nil {
+			t.Errorf("expected the unvoted round to fall to its first candidate without ballots, got %+v", rounds[0])
+		}
+
+		round, err := store.GetVoteRound(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if round.EndedAt == nil || round.WinnerID != b || round.VotingMethod != api.VotingBorda {
+			t.Errorf("unexpected archived round %+v", round)
+		}
+		want := []api.RoundCandidate{{MovieID: b, Place: 1, Score: 12}, {MovieID: a, Place: 2, Score: 8}, {MovieID: c, Place: 3, Score: 7}}
+		if fmt.Sprint(round.Candidates) != fmt.Sprint(want) {
+			t.Errorf("expected candidates %v, got %v", want, round.Candidates)
+		}
+		if len(round.Ballots) != 9 {
+			t.Errorf("expected the round's 9 ballots, got %d", len(round.Ballots))
+		}
+
+		for movieID, want := range map[int]api.MovieVoteStats{
+			a: {MovieID: a, Rounds: 2, Wins: 1, Losses: 1},
+			b: {MovieID: b, Rounds: 1, Wins: 1, Losses: 0},
+			c: {MovieID: c, Rounds: 2, Wins: 0, Losses: 2},
+		} {
+			stats, err := store.GetMovieVoteStats(movieID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats != want {
+				t.Errorf("expected %+v, got %+v", want, stats)
+			}
+		}
+
+		groupID, err := store.CreateGroup(&api.Group{Slug: "others"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ForGroup(groupID).GetVoteRound(first); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for another group's round, got %v", err)
+		}
+	})
+}
+
+func TestHTTPVoteRounds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		a, _, _ := castBallots(t, store)
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Get(server.URL + "/vote/rounds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rounds []api.VoteRound
+		if err := json.NewDecoder(resp.Body).Decode(&rounds); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(rounds) != 1 {
+			t.Fatalf("expected one round, got %+v", rounds)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/vote/rounds/%d", server.URL, rounds[0].ID+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status Not Found for an unknown round, got %v", resp.Status)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/movies/%d/votes", server.URL, a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var stats api.MovieVoteStats
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Rounds != 1 || stats.Losses != 1 {
+			t.Errorf("expected one lost round, got %+v", stats)
+		}
+	})
+}
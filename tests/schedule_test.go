@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+func TestWatchSchedule(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 3)
+		group, err := store.GetGroup("queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		group.MovieNight = "CRON_TZ=UTC 0 20 * * 5"
+		if err := store.UpdateGroup(&group); err != nil {
+			t.Fatal(err)
+		}
+
+		// The second movie takes the first Friday by hand, so the others
+		// move on to the following ones.
+		now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+		planned := time.Date(2030, 1, 4, 21, 0, 0, 0, time.UTC)
+		if err := store.PlanMovie(ids[1], planned); err != nil {
+			t.Fatal(err)
+		}
+		schedule, err := api.WatchSchedule(store, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			id        int
+			at        time.Time
+			recurring bool
+		}{
+			{ids[0], time.Date(2030, 1, 11, 20, 0, 0, 0, time.UTC), true},
+			{ids[1], planned, false},
+			{ids[2], time.Date(2030, 1, 18, 20, 0, 0, 0, time.UTC), true},
+		}
+		if len(schedule) != len(want) {
+			t.Fatalf("expected %d scheduled movies, got %+v", len(want), schedule)
+		}
+		for i, entry := range want {
+			got := schedule[i]
+			if got.ID != entry.id || !got.PlannedAt.Equal(entry.at) || got.Recurring != entry.recurring {
+				t.Errorf("%d: expected movie %d at %s (recurring %t), got %d at %s (recurring %t)",
+					i, entry.id, entry.at, entry.recurring, got.ID, got.PlannedAt, got.Recurring)
+			}
+		}
+
+		if err := store.FinishMovie(ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		if plans, err := store.GetPlans(); err != nil || len(plans) != 0 {
+			t.Errorf("expected a watched movie to lose its plan, got %v, %v", plans, err)
+		}
+		if err := store.PlanMovie(ids[1], planned); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a movie that is not queued, got %v", err)
+		}
+	})
+}
+
+func TestHTTPCalendar(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		store, _ = queuedGroup(t, store, 0)
+		id, err := store.AddMovie(&api.Movie{Name: "Alien, Director's Cut", IsMovie: true, TmdbImageUrl: "/alien.jpg"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddMovieToQueue(id); err != nil {
+			t.Fatal(err)
+		}
+		groupURL := server.URL + "/groups/queue"
+
+		wsURL := "ws" + strings.TrimPrefix(groupURL, "http") + "/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+
+		planned := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+		resp, err := http.Post(groupURL+"/queue/plan", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"id": %d, "planned_at": %q}`, id, planned.Format(time.RFC3339))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", resp.StatusCode)
+		}
+		var event struct {
+			Event    string               `json:"event"`
+			Schedule []api.ScheduledMovie `json:"schedule"`
+		}
+		if err := ws.ReadJSON(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event != "schedule" || len(event.Schedule) != 1 || !event.Schedule[0].PlannedAt.Equal(planned) {
+			t.Errorf("expected the new schedule to be broadcast, got %+v", event)
+		}
+
+		resp, err = http.Get(groupURL + "/calendar.ics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar") {
+			t.Errorf("expected a calendar, got %q", resp.Header.Get("Content-Type"))
+		}
+		for _, line := range []string{
+			"BEGIN:VEVENT",
+			"DTSTART:" + planned.Format("20060102T150405Z"),
+			`SUMMARY:Alien\, Director's Cut`,
+			"URL:https://image.tmdb.org/t/p/original/alien.jpg",
+		} {
+			if !strings.Contains(string(body), line+"\r\n") {
+				t.Errorf("expected the calendar to contain %q, got:\n%s", line, body)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+func TestWatchSession(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := queuedGroup(t, store, 2)
+
+		if session, err := api.CurrentSession(store); err != nil || session.State != api.SessionIdle {
+			t.Errorf("expected an idle session, got %+v, %v", session, err)
+		}
+		for name, err := range map[string]error{
+			"watch":  func() error { _, err := api.WatchSession(store, "alice"); return err }(),
+			"finish": func() error { _, err := api.FinishSession(store, "alice"); return err }(),
+		} {
+			if !errors.Is(err, api.ErrInvalidSession) {
+				t.Errorf("%s while idle: expected ErrInvalidSession, got %v", name, err)
+			}
+		}
+
+		session, err := api.StartSession(store, "alice", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.State != api.SessionStarting || session.MovieID != ids[0] || session.Movie == nil {
+			t.Errorf("expected the first queued movie to be starting, got %+v", session)
+		}
+		if _, err := api.StartSession(store, "alice", ids[1]); !errors.Is(err, api.ErrInvalidSession) {
+			t.Errorf("expected ErrInvalidSession while a movie is starting, got %v", err)
+		}
+		if session, err = api.WatchSession(store, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if session.State != api.SessionWatching || session.StartedAt == nil {
+			t.Errorf("expected the movie to be watching, got %+v", session)
+		}
+
+		if session, err = api.FinishSession(store, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if session.State != api.SessionFinished || session.Movie == nil || !session.Movie.Watched {
+			t.Errorf("expected a finished session on the watched movie, got %+v", session)
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := queueOrder(t, queue); fmt.Sprint(got) != fmt.Sprint(ids[1:]) {
+			t.Errorf("expected the queue to move on to %v, got %v", ids[1:], got)
+		}
+
+		if session, err = api.StartSession(store, "alice", 0); err != nil || session.MovieID != ids[1] {
+			t.Errorf("expected the next movie to start, got %+v, %v", session, err)
+		}
+		if session, err = api.StopSession(store, "alice"); err != nil || session.State != api.SessionIdle || session.MovieID != 0 {
+			t.Errorf("expected an idle session after the stop, got %+v, %v", session, err)
+		}
+	})
+}
+
+func TestHTTPWatchSession(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := queuedGroup(t, store, 2)
+		groupURL := server.URL + "/groups/queue"
+
+		wsURL := "ws" + strings.TrimPrefix(groupURL, "http") + "/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+		post := func(path string) int {
+			resp, err := http.Post(groupURL+path, "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		type event struct {
+			Event   string      `json:"event"`
+			Session api.Session `json:"session"`
+			Movie   api.Movie   `json:"movie"`
+			Queue   []api.Movie `json:"queue"`
+		}
+		read := func() (e event) {
+			if err := ws.ReadJSON(&e); err != nil {
+				t.Fatal(err)
+			}
+			return e
+		}
+
+		for _, step := range []struct {
+			path  string
+			state string
+		}{{"/session/start", api.SessionStarting}, {"/session/watch", api.SessionWatching}, {"/session/finish", api.SessionFinished}} {
+			if status := post(step.path); status != http.StatusOK {
+				t.Fatalf("%s: expected status OK, got %d", step.path, status)
+			}
+			if e := read(); e.Event != "session" || e.Session.State != step.state || e.Session.MovieID != ids[0] {
+				t.Errorf("%s: expected the %s session to be broadcast, got %+v", step.path, step.state, e)
+			}
+		}
+		if e := read(); e.Event != "rating_prompt" || e.Movie.ID != ids[0] {
+			t.Errorf("expected a rating prompt for the finished movie, got %+v", e)
+		}
+		if e := read(); len(e.Queue) != 1 || e.Queue[0].ID != ids[1] {
+			t.Errorf("expected the advanced queue to be broadcast, got %+v", e.Queue)
+		}
+
+		if status := post("/session/watch"); status != http.StatusConflict {
+			t.Errorf("expected status Conflict without a started movie, got %d", status)
+		}
+	})
+}
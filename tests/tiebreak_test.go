@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// tiedVote opens a borda vote in a new group on three movies, the first
+// proposed earliest, in which the first two tie on 2 points and the second
+// wins their runoff.
+func tiedVote(t *testing.T, store api.Store, group api.Group) (api.Store, []int) {
+	groupID, err := store.CreateGroup(&group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = store.ForGroup(groupID)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		id, err := store.AddMovie(&api.Movie{Name: fmt.Sprintf("Movie %d", i), IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := api.OpenVote(store, "admin", ids, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	early, late, other := ids[0], ids[1], ids[2]
+	for username, ranking := range map[string][]int{
+		"alice": {other, late, early},
+		"bob":   {other, early, late},
+		"carol": {late, early},
+		"dave":  {early, other},
+	} {
+		if err := store.CastVote(username, ranking); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, ids
+}
+
+func TestTieBreakPolicies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		for policy, winner := range map[string]int{api.TieBreakEarliest: 0, api.TieBreakRunoff: 1} {
+			store, ids := tiedVote(t, store, api.Group{Slug: "ties-" + policy, TieBreak: policy})
+			round, err := api.CloseVote(store, "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if round.TieBreak != policy || round.Candidates[0].MovieID != ids[2] {
+				t.Fatalf("%s: unexpected round %+v", policy, round)
+			}
+			if round.Candidates[1].MovieID != ids[winner] || round.Candidates[1].Score != round.Candidates[2].Score {
+				t.Errorf("%s: expected movie %d to come out of the tie ahead, got %+v", policy, ids[winner], round.Candidates)
+			}
+			if ties := round.Ties(); len(ties) != 1 || len(ties[0]) != 2 {
+				t.Errorf("%s: expected one tie of two movies, got %v", policy, ties)
+			}
+		}
+	})
+}
+
+func TestRandomTieBreakIsRepeatable(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, _ = tiedVote(t, store, api.Group{Slug: "ties-random", TieBreak: api.TieBreakRandom})
+		open, err := store.GetCurrentVoteRound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := store.GetCurrentVoteRound()
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed, err := api.CloseVote(store, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if closed.TieSeed != open.TieSeed {
+			t.Errorf("expected the seed %d to be recorded, got %d", open.TieSeed, closed.TieSeed)
+		}
+		if fmt.Sprint(open.Candidates) != fmt.Sprint(again.Candidates) || fmt.Sprint(open.Candidates) != fmt.Sprint(closed.Candidates) {
+			t.Errorf("expected the same order every count, got %v, %v and %v", open.Candidates, again.Candidates, closed.Candidates)
+		}
+	})
+}
+
+func TestQueueWinners(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := tiedVote(t, store, api.Group{Slug: "ties-queue", QueueWinners: 1})
+		if _, err := api.CloseVote(store, "admin"); err != nil {
+			t.Fatal(err)
+		}
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 1 || queue[0].ID != ids[2] {
+			t.Errorf("expected only the winner to be queued, got %+v", queue)
+		}
+	})
+}
+
+func TestHTTPVoteResultsReportTies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := tiedVote(t, store, api.Group{Slug: "ties-http", TieBreak: api.TieBreakRunoff})
+
+		resp, err := http.Get(server.URL + "/groups/ties-http/vote/results")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			TieBreak string      `json:"tie_break"`
+			Results  []api.Movie `json:"results"`
+			Ties     [][]int     `json:"ties"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.TieBreak != api.TieBreakRunoff || len(body.Results) != 3 || body.Results[1].ID != ids[1] {
+			t.Errorf("unexpected results %+v", body)
+		}
+		if fmt.Sprint(body.Ties) != fmt.Sprint([][]int{{ids[1], ids[0]}}) {
+			t.Errorf("expected the runoff order in ties, got %v", body.Ties)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/http/routes"
+)
+
+func TestDeleteMovieMovesToTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"Kept", "Trashed", "Also Kept", "Candidate"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		for _, id := range ids[:3] {
+			if err := store.AddMovieToQueue(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.RateMovie(ids[1], "test", 4); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeleteMovie(ids[1], "alice"); err != nil {
+			t.Fatalf("DeleteMovie() error = %v", err)
+		}
+		if err := store.DeleteMovie(ids[1], "alice"); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+
+		movies, err := store.GetMovies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movies) != 3 {
+			t.Errorf("expected 3 movies outside the trash, got %d", len(movies))
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queue) != 2 || queue[1].ID != ids[2] || queue[1].QueuePosition.Int64 != 2 {
+			t.Errorf("expected trashed movie removed from queue without a gap, got %+v", queue)
+		}
+
+		candidates, err := store.GetUnwatchedMoviesNotInQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 1 || candidates[0].ID != ids[3] {
+			t.Errorf("expected only the untrashed candidate, got %+v", candidates)
+		}
+
+		trash, err := store.GetTrash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trash) != 1 || trash[0].DeletedBy != "alice" || trash[0].DeletedAt == nil {
+			t.Fatalf("unexpected trash %+v", trash)
+		}
+
+		if err := store.RestoreMovie(ids[1]); err != nil {
+			t.Fatalf("RestoreMovie() error = %v", err)
+		}
+		movie, err := store.GetMovie(ids[1])
+		if err != nil {
+			t.Fatalf("GetMovie() after restore error = %v", err)
+		}
+		if movie.Ratings != `{"test":4}` || movie.DeletedAt != nil {
+			t.Errorf("expected restored movie with its ratings, got %+v", movie)
+		}
+		if err := store.RestoreMovie(ids[1]); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound restoring a movie outside the trash, got %v", err)
+		}
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		var ids []int
+		for _, name := range []string{"Old", "Recent"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RateMovie(id, "test", 3); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		if err := store.PurgeMovie(ids[0]); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound purging a movie outside the trash, got %v", err)
+		}
+
+		if err := store.DeleteMovie(ids[0], "test"); err != nil {
+			t.Fatal(err)
+		}
+		cutoff := time.Now().Add(time.Second)
+		purged, err := store.PurgeTrash(cutoff)
+		if err != nil {
+			t.Fatalf("PurgeTrash() error = %v", err)
+		}
+		if purged != 1 {
+			t.Errorf("expected 1 purged movie, got %d", purged)
+		}
+
+		ratings, err := store.GetMovieRatings(ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ratings) != 0 {
+			t.Errorf("expected ratings of purged movie to be gone, got %+v", ratings)
+		}
+
+		if err := store.DeleteMovie(ids[1], "test"); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := store.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("expected recent trash to be kept, purged %d, err %v", purged, err)
+		}
+		if err := store.PurgeMovie(ids[1]); err != nil {
+			t.Fatalf("PurgeMovie() error = %v", err)
+		}
+
+		trash, err := store.GetTrash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trash) != 0 {
+			t.Errorf("expected empty trash, got %+v", trash)
+		}
+	})
+}
+
+func TestHTTPDeleteAndRestoreMovie(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+
+		id, err := store.AddMovie(&api.Movie{Name: "Test Movie", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/movies/"+strconv.Itoa(id), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(routes.ActorHeader, "alice")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		resp, err = http.Get(server.URL + "/trash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trash []api.Movie
+		if err := json.NewDecoder(resp.Body).Decode(&trash); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(trash) != 1 || trash[0].ID != id || trash[0].DeletedBy != "alice" {
+			t.Fatalf("unexpected trash %+v", trash)
+		}
+
+		resp, err = http.Post(server.URL+"/trash/"+strconv.Itoa(id)+"/restore", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+
+		if _, err := store.GetMovie(id); err != nil {
+			t.Errorf("expected restored movie, got %v", err)
+		}
+	})
+}
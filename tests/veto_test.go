@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+// vetoGroup opens a vote on the first two of three movies in a new group,
+// reached under /groups/candidates-uniform.
+func vetoGroup(t *testing.T, store api.Store) (api.Store, []int) {
+	store, ids := candidateGroup(t, store, api.CandidatesUniform, 2, "a", "b", "c")
+	if _, err := api.OpenVote(store, "admin", ids[:2], time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	return store, ids
+}
+
+func TestVetoCandidate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := vetoGroup(t, store)
+		if err := store.CastVote("alice", []int{ids[0], ids[1]}); err != nil {
+			t.Fatal(err)
+		}
+
+		veto, err := api.VetoCandidate(store, "bob", ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if veto.MovieID != ids[0] || veto.ReplacementID != ids[2] || veto.Username != "bob" {
+			t.Errorf("unexpected veto %+v", veto)
+		}
+		vote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote) != 2 || vote[0].ID != ids[1] || vote[1].ID != ids[2] {
+			t.Errorf("expected the replacement to take the vetoed movie's place, got %+v", vote)
+		}
+		ballot, err := store.GetBallot("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ballot.Ranking) != fmt.Sprint([]int{ids[1]}) {
+			t.Errorf("expected the vetoed movie to leave the ballots, got %v", ballot.Ranking)
+		}
+
+		if _, err := api.VetoCandidate(store, "bob", ids[1]); !errors.Is(err, api.ErrNoVetoesLeft) {
+			t.Errorf("expected ErrNoVetoesLeft for a second veto, got %v", err)
+		}
+		if _, err := api.VetoCandidate(store, "alice", ids[0]); !errors.Is(err, api.ErrInvalidVote) {
+			t.Errorf("expected ErrInvalidVote for a movie that is not a candidate, got %v", err)
+		}
+		for username, want := range map[string]int{"alice": 1, "bob": 0} {
+			left, err := api.VetoesLeft(store, username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left != want {
+				t.Errorf("expected %s to have %d vetoes left, got %d", username, want, left)
+			}
+		}
+
+		round, err := api.CloseVote(store, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(round.Vetoes) != 1 || round.Vetoes[0] != veto {
+			t.Errorf("expected the veto in the round's history, got %+v", round.Vetoes)
+		}
+	})
+}
+
+func TestVetoReplacement(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		store, ids := vetoGroup(t, store)
+		if _, err := api.VetoCandidate(store, "bob", ids[0]); err != nil {
+			t.Fatal(err)
+		}
+		veto, err := api.VetoCandidate(store, "alice", ids[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if veto.ReplacementID != 0 {
+			t.Errorf("expected no replacement once the pool only holds a vetoed movie, got %d", veto.ReplacementID)
+		}
+
+		other, err := store.ForGroup(api.DefaultGroupID).AddMovie(&api.Movie{Name: "Elsewhere", IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, replacementID := range map[string]int{"candidate": ids[2], "other group": other, "unknown": 999} {
+			if _, err := store.VetoCandidate("carol", ids[2], replacementID); !errors.Is(err, api.ErrInvalidVote) {
+				t.Errorf("%s replacement: expected ErrInvalidVote, got %v", name, err)
+			}
+		}
+	})
+}
+
+func TestHTTPVetoCandidate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := vetoGroup(t, store)
+
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/groups/candidates-uniform/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+
+		veto := func(movieID int) int {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/groups/candidates-uniform/vote/veto", strings.NewReader(fmt.Sprintf(`{"movie_id": %d}`, movieID)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Watchalong-User", "bob")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		if status := veto(ids[0]); status != http.StatusOK {
+			t.Fatalf("expected status OK, got %d", status)
+		}
+		var event struct {
+			Event string   `json:"event"`
+			Veto  api.Veto `json:"veto"`
+		}
+		if err := ws.ReadJSON(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event != "veto" || event.Veto.MovieID != ids[0] || event.Veto.Username != "bob" {
+			t.Errorf("expected the veto to be broadcast, got %+v", event)
+		}
+		if status := veto(ids[1]); status != http.StatusConflict {
+			t.Errorf("expected status Conflict once the vetoes are spent, got %d", status)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+	"github.com/MonkaKokosowa/watchalong-server/http/routes"
+	gwebsocket "github.com/gorilla/websocket"
+)
+
+// voteResults decodes GET /vote/results of a group.
+func voteResults(t *testing.T, url string) (results struct {
+	Visibility string          `json:"visibility"`
+	Results    []api.Movie     `json:"results"`
+	Tallies    []api.VoteTally `json:"tallies"`
+	Voters     []string        `json:"voters"`
+}) {
+	resp, err := http.Get(url + "/vote/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestHTTPVoteVisibility(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		groupStore, _ := tiedVote(t, store, api.Group{Slug: "hidden", Visibility: api.VisibilityHidden})
+		groupURL := server.URL + "/groups/hidden"
+
+		hidden := voteResults(t, groupURL)
+		if hidden.Visibility != api.VisibilityHidden || hidden.Results != nil || hidden.Tallies != nil {
+			t.Errorf("expected hidden standings, got %+v", hidden)
+		}
+		if fmt.Sprint(hidden.Voters) != "[alice bob carol dave]" {
+			t.Errorf("expected the voters of a hidden round, got %v", hidden.Voters)
+		}
+
+		resp, err := http.Get(groupURL + "/vote/rounds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rounds []api.VoteRound
+		if err := json.NewDecoder(resp.Body).Decode(&rounds); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		for _, candidate := range rounds[0].Candidates {
+			if candidate.Place != 0 || candidate.Score != 0 {
+				t.Errorf("expected the open round's standings to be concealed, got %+v", rounds[0].Candidates)
+			}
+		}
+
+		for _, c := range []struct {
+			actor  string
+			query  string
+			status int
+		}{{"", "?username=alice", http.StatusForbidden}, {"bob", "?username=alice", http.StatusForbidden}, {"alice", "", http.StatusOK}} {
+			req, err := http.NewRequest(http.MethodGet, groupURL+"/vote/ballot"+c.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.actor != "" {
+				req.Header.Set(routes.ActorHeader, c.actor)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Errorf("ballot%s as %q: expected status %d, got %v", c.query, c.actor, c.status, resp.Status)
+			}
+		}
+
+		resp, err = http.Post(groupURL+"/admin/vote/extend", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"closes_at": %q}`, time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var extended api.VoteRound
+		if err := json.NewDecoder(resp.Body).Decode(&extended); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		for _, candidate := range extended.Candidates {
+			if candidate.Place != 0 || candidate.Score != 0 {
+				t.Errorf("expected the extended round's standings to be concealed, got %+v", extended.Candidates)
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodPut, groupURL+"/admin/vote/visibility", strings.NewReader(`{"visibility": "sealed"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK, got %v", resp.Status)
+		}
+		if sealed := voteResults(t, groupURL); sealed.Visibility != api.VisibilitySealed || sealed.Voters != nil {
+			t.Errorf("expected nothing of a sealed round, got %+v", sealed)
+		}
+
+		round, err := api.CloseVote(groupStore, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if concealed := round.Concealed(); concealed.Candidates[0].Score == 0 {
+			t.Errorf("expected a closed round to be shown in full, got %+v", concealed.Candidates)
+		}
+	})
+}
+
+func TestWebSocketRevealOnClose(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		server, cleanup := setup(t, store)
+		defer cleanup()
+		_, ids := tiedVote(t, store, api.Group{Slug: "sealed", Visibility: api.VisibilitySealed})
+
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/groups/sealed/ws"
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+
+		resp, err := http.Post(server.URL+"/groups/sealed/admin/vote/close", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		var reveal struct {
+			Event string        `json:"event"`
+			Round api.VoteRound `json:"round"`
+		}
+		if err := ws.ReadJSON(&reveal); err != nil {
+			t.Fatal(err)
+		}
+		if reveal.Event != "reveal" || reveal.Round.WinnerID != ids[2] || len(reveal.Round.Candidates) != 3 {
+			t.Errorf("expected the reveal of the closed round, got %+v", reveal)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MonkaKokosowa/watchalong-server/api"
+)
+
+// castBallots opens a vote on three movies and casts four A>B>C, three
+// B>C>A and two C>B>A ballots, on which the voting methods disagree.
+func castBallots(t *testing.T, store api.Store) (a int, b int, c int) {
+	var ids []int
+	for _, name := range []string{"A", "B", "C"} {
+		id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	a, b, c = ids[0], ids[1], ids[2]
+	if err := store.CreateNewVote(ids); err != nil {
+		t.Fatal(err)
+	}
+
+	voter := 0
+	for _, group := range []struct {
+		count   int
+		ranking []int
+	}{
+		{4, []int{a, b, c}},
+		{3, []int{b, c, a}},
+		{2, []int{c, b, a}},
+	} {
+		for i := 0; i < group.count; i++ {
+			voter++
+			if err := store.CastVote(fmt.Sprintf("voter%d", voter), group.ranking); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return a, b, c
+}
+
+func TestVotingMethods(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		a, b, c := castBallots(t, store)
+
+		method, err := store.GetVotingMethod()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if method != api.DefaultVotingMethod {
+			t.Errorf("expected the default voting method, got %s", method)
+		}
+
+		for name, want := range map[string][]int{
+			api.VotingBorda:         {b, a, c},
+			api.VotingPlurality:     {a, b, c},
+			api.VotingInstantRunoff: {b, a, c},
+			api.VotingSchulze:       {b, c, a},
+			api.VotingApproval:      {a, b, c},
+		} {
+			if err := store.SetVotingMethod(name); err != nil {
+				t.Fatalf("SetVotingMethod(%s) error = %v", name, err)
+			}
+			results, err := store.GetVoteResults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, movie := range results {
+				got = append(got, movie.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: expected ranking %v, got %v", name, want, got)
+			}
+			winner, err := store.GetVoteWinner()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if winner.ID != want[0] {
+				t.Errorf("%s: expected winner %d, got %d", name, want[0], winner.ID)
+			}
+		}
+
+		if err := store.SetVotingMethod("dictatorship"); !errors.Is(err, api.ErrUnknownVotingMethod) {
+			t.Errorf("expected ErrUnknownVotingMethod, got %v", err)
+		}
+		if err := store.ClearCurrentVote(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetVotingMethod(api.VotingSchulze); !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("expected ErrNotFound without an open round, got %v", err)
+		}
+	})
+}
+
+func TestApprovalIgnoresOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		groupID, err := store.CreateGroup(&api.Group{Slug: "approvers", VotingMethod: api.VotingApproval})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store = store.ForGroup(groupID)
+
+		var ids []int
+		for _, name := range []string{"A", "B", "C"} {
+			id, err := store.AddMovie(&api.Movie{Name: name, IsMovie: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if err := store.CreateNewVote(ids); err != nil {
+			t.Fatal(err)
+		}
+		for username, ranking := range map[string][]int{
+			"alice": {ids[0]},
+			"bob":   {ids[1], ids[2]},
+			"carol": {ids[2]},
+		} {
+			if err := store.CastVote(username, ranking); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		method, err := store.GetVotingMethod()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if method != api.VotingApproval {
+			t.Errorf("expected the round to use the group's method, got %s", method)
+		}
+		winner, err := store.GetVoteWinner()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if winner.ID != ids[2] {
+			t.Errorf("expected the most approved movie to win, got %d", winner.ID)
+		}
+	})
+}
@@ -16,133 +16,138 @@ import (
 )
 
 func TestWebSocketUpdate(t *testing.T) {
-	PrepareDB()
-	router := mux.NewRouter()
-	customhttp.AddRoutes(router)
-	router.HandleFunc("/ws", websocket.WsManager.WsHandler)
-	server := httptest.NewServer(router)
-	defer server.Close()
-
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
-
-	ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
-	}
-	defer ws.Close()
-
-	// 1. Add a movie
-	newMovie := api.Movie{
-		Name:    "Test Movie",
-		IsMovie: true,
-	}
-
-	jsonMovie, err := json.Marshal(newMovie)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err := http.Post(server.URL+"/add/movie", "application/json", strings.NewReader(string(jsonMovie)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	// Read the first message
-	_, _, err = ws.ReadMessage()
-	if err != nil {
-		t.Fatalf("could not read message: %v", err)
-	}
-
-	var addMovieResponse struct {
-		ID int `json:"id"`
-	}
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if err := json.Unmarshal(bodyBytes, &addMovieResponse); err != nil {
-		t.Fatal(err)
-	}
-
-	// 2. Add movie to queue
-	body := struct {
-		ID int `json:"id"`
-	}{
-		ID: addMovieResponse.ID,
-	}
-
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	resp, err = http.Post(server.URL+"/queue/add", "application/json", strings.NewReader(string(jsonBody)))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	// 3. Check for websocket message
-	_, p, err := ws.ReadMessage()
-	if err != nil {
-		t.Fatalf("could not read message: %v", err)
-	}
-
-	allMovies, err := api.GetMovies()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	queue, err := api.GetQueue()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	aliases, err := api.GetAliases()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if aliases == nil {
-		aliases = []api.Alias{}
-	}
-
-	vote, err := api.GetCurrentVote()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if vote == nil {
-		vote = []api.Movie{}
-	}
-
-	expectedResponse := struct {
-		Movies  []api.Movie `json:"movies"`
-		Queue   []api.Movie `json:"queue"`
-		Aliases []api.Alias `json:"aliases"`
-		Vote    []api.Movie `json:"vote"`
-	}{
-		Movies:  allMovies,
-		Queue:   queue,
-		Aliases: aliases,
-		Vote:    vote,
-	}
-
-	expected, err := json.Marshal(expectedResponse)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if string(p) != string(expected) {
-		t.Errorf("got %s, want %s", string(p), string(expected))
-	}
-
-	// Gracefully close the connection
-	err = ws.WriteMessage(gwebsocket.CloseMessage, gwebsocket.FormatCloseMessage(gwebsocket.CloseNormalClosure, ""))
-	if err != nil {
-		t.Fatalf("could not write close message: %v", err)
-	}
-	defer ws.Close()
-
+	forEachStore(t, func(t *testing.T, store api.Store) {
+		wsManager := websocket.NewManager()
+		router := mux.NewRouter()
+		customhttp.AddRoutes(router, store, wsManager, testConfig(t))
+		router.HandleFunc("/ws", wsManager.WsHandler)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+		ws, _, err := gwebsocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("could not open a ws connection on %s: %v", wsURL, err)
+		}
+		defer ws.Close()
+
+		// 1. Add a movie
+		newMovie := api.Movie{
+			Name:    "Test Movie",
+			IsMovie: true,
+		}
+
+		jsonMovie, err := json.Marshal(newMovie)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.Post(server.URL+"/add/movie", "application/json", strings.NewReader(string(jsonMovie)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		// Read the first message
+		_, _, err = ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+
+		var addMovieResponse struct {
+			ID int `json:"id"`
+		}
+
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := json.Unmarshal(bodyBytes, &addMovieResponse); err != nil {
+			t.Fatal(err)
+		}
+
+		// 2. Add movie to queue
+		body := struct {
+			ID int `json:"id"`
+		}{
+			ID: addMovieResponse.ID,
+		}
+
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = http.Post(server.URL+"/queue/add", "application/json", strings.NewReader(string(jsonBody)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		// 3. Check for websocket message
+		_, p, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+
+		allMovies, err := store.GetMovies()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		queue, err := store.GetQueue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		aliases, err := store.GetAliases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if aliases == nil {
+			aliases = []api.Alias{}
+		}
+
+		vote, err := store.GetCurrentVote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vote == nil {
+			vote = []api.Movie{}
+		}
+
+		expectedResponse := struct {
+			Movies  []api.Movie `json:"movies"`
+			Queue   []api.Movie `json:"queue"`
+			Aliases []api.Alias `json:"aliases"`
+			Vote    []api.Movie `json:"vote"`
+			// No vote is open, so there is no participation.
+			Participation *api.Participation `json:"participation"`
+			Tallies       []api.VoteTally    `json:"tallies"`
+		}{
+			Movies:  allMovies,
+			Queue:   queue,
+			Aliases: aliases,
+			Vote:    vote,
+		}
+
+		expected, err := json.Marshal(expectedResponse)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(p) != string(expected) {
+			t.Errorf("got %s, want %s", string(p), string(expected))
+		}
+
+		// Gracefully close the connection
+		err = ws.WriteMessage(gwebsocket.CloseMessage, gwebsocket.FormatCloseMessage(gwebsocket.CloseNormalClosure, ""))
+		if err != nil {
+			t.Fatalf("could not write close message: %v", err)
+		}
+		defer ws.Close()
+
+	})
 }
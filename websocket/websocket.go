@@ -5,29 +5,35 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/MonkaKokosowa/watchalong-server/api"
 	"github.com/MonkaKokosowa/watchalong-server/logger"
 	"github.com/gorilla/websocket"
 )
 
-var WsManager = NewManager()
-
+// Manager keeps track of connected clients and the group each one follows.
 type Manager struct {
-	clients   map[*websocket.Conn]bool
-	upgrader  websocket.Upgrader
-	broadcast chan []byte
+	mu       sync.Mutex
+	clients  map[*websocket.Conn]int
+	upgrader websocket.Upgrader
 }
 
 func NewManager() *Manager {
 	return &Manager{
-		clients:   make(map[*websocket.Conn]bool),
-		upgrader:  websocket.Upgrader{},
-		broadcast: make(chan []byte),
+		clients:  make(map[*websocket.Conn]int),
+		upgrader: websocket.Upgrader{},
 	}
 }
 
+// WsHandler subscribes a client to the default group.
 func (m *Manager) WsHandler(w http.ResponseWriter, r *http.Request) {
+	m.Serve(w, r, api.DefaultGroupID)
+}
+
+// Serve upgrades the connection and subscribes it to updates of groupID.
+func (m *Manager) Serve(w http.ResponseWriter, r *http.Request, groupID int) {
 	conn, err := m.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error("Failed to upgrade websocket ", err)
@@ -35,18 +41,19 @@ func (m *Manager) WsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	m.clients[conn] = true
+	m.mu.Lock()
+	m.clients[conn] = groupID
+	m.mu.Unlock()
 
 	for {
 		_, message, err := conn.ReadMessage()
-
-		// HACKY FIX FIND A BETTER WAY TO HANDLE CLOSE
-		if err.Error() == "websocket: close 1000 (normal)" {
-			delete(m.clients, conn)
-			break
-		} else if err != nil {
-			logger.Error("Failed to read message", err)
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				logger.Error("Failed to read message", err)
+			}
+			m.mu.Lock()
 			delete(m.clients, conn)
+			m.mu.Unlock()
 			break
 		}
 		logger.Info(fmt.Sprint("Received message: ", string(message)))
@@ -54,26 +61,144 @@ func (m *Manager) WsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (m *Manager) BroadcastUpdates(movies []api.Movie, queue []api.Movie, aliases []api.Alias, vote []api.Movie) {
+// BroadcastUpdates sends the current movies, queue, aliases and vote, with
+// the vote's deadline and participation, from store to every client
+// following the store's group. Live tallies are only sent for open rounds
+// whose visibility is open.
+func (m *Manager) BroadcastUpdates(store api.Store) {
+	movies, err := store.GetMovies()
+	if err != nil || movies == nil {
+		movies = []api.Movie{}
+	}
+	queue, err := store.GetQueue()
+	if err != nil || queue == nil {
+		queue = []api.Movie{}
+	}
+	aliases, err := store.GetAliases()
+	if err != nil || aliases == nil {
+		aliases = []api.Alias{}
+	}
+	vote, err := store.GetCurrentVote()
+	if err != nil || vote == nil {
+		vote = []api.Movie{}
+	}
+	// Participation and tallies stay null while no vote is open.
+	var participation *api.Participation
+	var tallies []api.VoteTally
+	if current, err := api.GetParticipation(store); err == nil {
+		concealed := current.Concealed()
+		participation = &concealed
+		if current.Visibility == api.VisibilityOpen {
+			tallies, _ = store.GetVoteTallies()
+		}
+	}
+
 	response := struct {
 		Movies  []api.Movie `json:"movies"`
 		Queue   []api.Movie `json:"queue"`
 		Aliases []api.Alias `json:"aliases"`
 		Vote    []api.Movie `json:"vote"`
+		// Participation carries the vote's deadline and ballot counts.
+		Participation *api.Participation `json:"participation"`
+		Tallies       []api.VoteTally    `json:"tallies"`
 	}{
-		Movies:  movies,
-		Queue:   queue,
-		Aliases: aliases,
-		Vote:    vote,
+		Movies:        movies,
+		Queue:         queue,
+		Aliases:       aliases,
+		Vote:          vote,
+		Participation: participation,
+		Tallies:       tallies,
+	}
+	m.send(store.GroupID(), response)
+}
+
+// BroadcastReveal sends the results of a closed round to every client
+// following the store's group, as {"event": "reveal", "round": ...}.
+func (m *Manager) BroadcastReveal(store api.Store, round api.VoteRound) {
+	m.send(store.GroupID(), struct {
+		Event string        `json:"event"`
+		Round api.VoteRound `json:"round"`
+	}{"reveal", round})
+}
+
+// BroadcastVeto tells every client following the store's group that a
+// candidate was vetoed, as {"event": "veto", "veto": ...}.
+func (m *Manager) BroadcastVeto(store api.Store, veto api.Veto) {
+	m.send(store.GroupID(), struct {
+		Event string   `json:"event"`
+		Veto  api.Veto `json:"veto"`
+	}{"veto", veto})
+}
+
+// BroadcastPhase tells every client following the store's group that round
+// started its phase: "nominations_open" for a nominating round and
+// "voting_open" once its nominations close.
+func (m *Manager) BroadcastPhase(store api.Store, round api.VoteRound) {
+	event := "voting_open"
+	if round.Phase == api.PhaseNominating {
+		event = "nominations_open"
+	}
+	m.send(store.GroupID(), struct {
+		Event string        `json:"event"`
+		Round api.VoteRound `json:"round"`
+	}{event, round.Concealed()})
+}
+
+// BroadcastNomination tells every client following the store's group about
+// a new nomination.
+func (m *Manager) BroadcastNomination(store api.Store, nomination api.Nomination) {
+	m.send(store.GroupID(), struct {
+		Event      string         `json:"event"`
+		Nomination api.Nomination `json:"nomination"`
+	}{"nomination", nomination})
+}
+
+// BroadcastSchedule sends the dated queue of the store's group to every
+// client following it, as {"event": "schedule", "schedule": [...]}, after a
+// movie is planned or the movie night changes.
+func (m *Manager) BroadcastSchedule(store api.Store) {
+	schedule, err := api.WatchSchedule(store, time.Now())
+	if err != nil {
+		logger.Error("Failed to get watch schedule", err)
+		return
+	}
+	m.send(store.GroupID(), struct {
+		Event    string               `json:"event"`
+		Schedule []api.ScheduledMovie `json:"schedule"`
+	}{"schedule", schedule})
+}
+
+// BroadcastSession tells every client following the store's group that its
+// watch session changed, as {"event": "session", "session": ...}. A finished
+// session is followed by {"event": "rating_prompt", "movie": ...} asking
+// the group to rate the movie.
+func (m *Manager) BroadcastSession(store api.Store, session api.Session) {
+	m.send(store.GroupID(), struct {
+		Event   string      `json:"event"`
+		Session api.Session `json:"session"`
+	}{"session", session})
+	if session.State == api.SessionFinished && session.Movie != nil {
+		m.send(store.GroupID(), struct {
+			Event string    `json:"event"`
+			Movie api.Movie `json:"movie"`
+		}{"rating_prompt", *session.Movie})
 	}
+}
 
-	jsonBytes, err := json.Marshal(response)
+// send writes message as JSON to every client following groupID.
+func (m *Manager) send(groupID int, message any) {
+	jsonBytes, err := json.Marshal(message)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	for client := range m.clients {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for client, clientGroup := range m.clients {
+		if clientGroup != groupID {
+			continue
+		}
 		if err := client.WriteMessage(websocket.TextMessage, jsonBytes); err != nil {
 			log.Println(err)
 			client.Close()